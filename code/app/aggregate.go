@@ -0,0 +1,229 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Calculate all the BotGroup.Aggregates.  Group level results go into BotGroup.AggregateValues, Peer relative results
+// go into each Bot.VariableValues.  Must run after all the Query and Synthetic Variables are set.
+func UpdateBotGroupAggregates(botGroup *data.BotGroup) {
+	aggregateValues := make(map[string]float64)
+
+	for _, aggregate := range botGroup.Aggregates {
+		// Peer relative aggregates set a value in every Bot, instead of the BotGroup
+		if aggregate.Type.IsPeerRelative() {
+			SetBotPeerRelativeValues(botGroup, aggregate)
+			continue
+		}
+
+		value, err := CalculateBotGroupAggregate(botGroup, aggregate)
+		if util.Check(err) {
+			// No value is set, so any evaluation using this will fail and the Consideration is invalid
+			continue
+		}
+
+		aggregateValues[aggregate.Name] = value
+	}
+
+	botGroup.AggregateValues = aggregateValues
+}
+
+// Calculate a single Group level BotGroupAggregate
+func CalculateBotGroupAggregate(botGroup *data.BotGroup, aggregate data.BotGroupAggregate) (float64, error) {
+	switch aggregate.Type {
+	case data.AggregateCount:
+		return float64(len(botGroup.Bots)), nil
+	case data.AggregateCountInState:
+		stateName, stateLabel, err := SplitStateKey(aggregate.State)
+		if util.Check(err) {
+			return 0, err
+		}
+		return float64(len(GetBotsInState(botGroup, stateName, stateLabel))), nil
+	}
+
+	values := GetBotGroupVariableValues(botGroup, aggregate.Variable)
+	if len(values) == 0 {
+		return 0, errors.New(fmt.Sprintf("No Bots have variable: %s  Aggregate: %s  Bot Group: %s", aggregate.Variable, aggregate.Name, botGroup.Name))
+	}
+
+	switch aggregate.Type {
+	case data.AggregateSum:
+		return SumFloat64(values), nil
+	case data.AggregateMean:
+		return SumFloat64(values) / float64(len(values)), nil
+	case data.AggregateMin:
+		sort.Float64s(values)
+		return values[0], nil
+	case data.AggregateMax:
+		sort.Float64s(values)
+		return values[len(values)-1], nil
+	case data.AggregatePercentile:
+		return PercentileFloat64(values, aggregate.Percentile), nil
+	}
+
+	return 0, errors.New(fmt.Sprintf("Unknown Aggregate Type: %d  Aggregate: %s  Bot Group: %s", aggregate.Type, aggregate.Name, botGroup.Name))
+}
+
+// Set the Peer relative BotGroupAggregate values into each Bot.VariableValues.  Bots missing the Variable have their
+// previous value removed, so a stale value isn't evaluated.
+func SetBotPeerRelativeValues(botGroup *data.BotGroup, aggregate data.BotGroupAggregate) {
+	values := GetBotGroupVariableValues(botGroup, aggregate.Variable)
+
+	mean := 0.0
+	if len(values) > 0 {
+		mean = SumFloat64(values) / float64(len(values))
+	}
+	stdDev := StdDevFloat64(values, mean)
+
+	for botIndex := range botGroup.Bots {
+		bot := &botGroup.Bots[botIndex]
+
+		util.LockAcquire(bot.LockKey)
+
+		value, ok := bot.VariableValues[aggregate.Variable]
+		if ok {
+			switch aggregate.Type {
+			case data.AggregateZScore:
+				// If all the Bots have the same value, no Bot is different from its peers
+				zScore := 0.0
+				if stdDev != 0 {
+					zScore = (value - mean) / stdDev
+				}
+				bot.VariableValues[aggregate.Name] = zScore
+			case data.AggregateRank:
+				// Competition ranking, highest value is 1, and ties share a rank
+				rank := 1
+				for _, peerValue := range values {
+					if peerValue > value {
+						rank++
+					}
+				}
+				bot.VariableValues[aggregate.Name] = float64(rank)
+			}
+		} else {
+			delete(bot.VariableValues, aggregate.Name)
+		}
+
+		util.LockRelease(bot.LockKey)
+	}
+}
+
+// Returns the values of a Variable, for all the Bots in the BotGroup that have it
+func GetBotGroupVariableValues(botGroup *data.BotGroup, varName string) []float64 {
+	var values []float64
+
+	for botIndex := range botGroup.Bots {
+		bot := &botGroup.Bots[botIndex]
+
+		util.LockAcquire(bot.LockKey)
+		value, ok := bot.VariableValues[varName]
+		util.LockRelease(bot.LockKey)
+
+		if ok {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Get a BotGroupAggregate definition from BotGroup, by name
+func GetBotGroupAggregate(botGroup *data.BotGroup, name string) (data.BotGroupAggregate, error) {
+	for _, aggregate := range botGroup.Aggregates {
+		if aggregate.Name == name {
+			return aggregate, nil
+		}
+	}
+	return data.BotGroupAggregate{}, errors.New(fmt.Sprintf("Bot Group: %s  Missing Aggregate: %s", botGroup.Name, name))
+}
+
+// Returns a list of the Group level BotGroupAggregates and their values, formatted for human readability.  Handlebars helper
+func GetBotGroupAggregateValuesFormatted(botGroup data.BotGroup) []map[string]string {
+	output := []map[string]string{}
+
+	for _, aggregate := range botGroup.Aggregates {
+		if aggregate.Type.IsPeerRelative() {
+			continue
+		}
+
+		formatted := "Missing"
+		valueRaw := ""
+		value, ok := botGroup.AggregateValues[aggregate.Name]
+		if ok {
+			formatted = FormatBotVariable(aggregate.Format, value)
+			valueRaw = fmt.Sprintf("%.4f", value)
+		}
+
+		output = append(output, map[string]string{
+			"name":      aggregate.Name,
+			"info":      aggregate.Info,
+			"type":      aggregate.Type.String(),
+			"variable":  aggregate.Variable,
+			"value":     formatted,
+			"value_raw": valueRaw,
+		})
+	}
+
+	return output
+}
+
+// Split a "(State.Name).(Label)" string into its State.Name and Label
+func SplitStateKey(stateKey string) (string, string, error) {
+	if !strings.Contains(stateKey, ".") {
+		return "", "", errors.New(fmt.Sprintf("Invalid State, must be formatted as (State.Name).(Label): %s", stateKey))
+	}
+
+	stateSplit := strings.SplitN(stateKey, ".", 2)
+	return stateSplit[0], stateSplit[1], nil
+}
+
+// Sum all the float64 values
+func SumFloat64(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+// Population Standard Deviation of the values, with an already calculated mean
+func StdDevFloat64(values []float64, mean float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	variance /= float64(len(values))
+
+	return math.Sqrt(variance)
+}
+
+// Returns the percentile (0-100) of the values, interpolating linearly between the closest ranks
+func PercentileFloat64(values []float64, percentile float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	position := util.Clamp(percentile, 0, 100) / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+
+	if lower == upper {
+		return sorted[lower]
+	}
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Returns a BotGroup with 4 Bots with a load Variable, one of them Degraded, and a Bot without the Variable
+func getAggregateTestBotGroup() data.BotGroup {
+	return data.BotGroup{
+		Name:   "App",
+		States: []data.BotForwardSequenceState{{Name: "Health", Labels: []string{"Healthy", "Degraded"}}},
+		Bots: []data.Bot{
+			{Name: "web1", LockKey: "App.web1", StateValues: []string{"Health.Healthy"}, VariableValues: map[string]float64{"load": 2}},
+			{Name: "web2", LockKey: "App.web2", StateValues: []string{"Health.Healthy"}, VariableValues: map[string]float64{"load": 4}},
+			{Name: "web3", LockKey: "App.web3", StateValues: []string{"Health.Degraded"}, VariableValues: map[string]float64{"load": 4}},
+			{Name: "web4", LockKey: "App.web4", StateValues: []string{"Health.Healthy"}, VariableValues: map[string]float64{"load": 6}},
+			{Name: "web5", LockKey: "App.web5", StateValues: []string{"Health.Healthy"}, VariableValues: map[string]float64{}},
+		},
+	}
+}
+
+func TestCalculateBotGroupAggregate(t *testing.T) {
+	botGroup := getAggregateTestBotGroup()
+
+	calculate := func(aggregate data.BotGroupAggregate) float64 {
+		value, err := CalculateBotGroupAggregate(&botGroup, aggregate)
+		assert.Nil(t, err)
+		return value
+	}
+
+	assert.Equal(t, 5.0, calculate(data.BotGroupAggregate{Type: data.AggregateCount}), "Count is all the Bots")
+	assert.Equal(t, 1.0, calculate(data.BotGroupAggregate{Type: data.AggregateCountInState, State: "Health.Degraded"}))
+	assert.Equal(t, 16.0, calculate(data.BotGroupAggregate{Type: data.AggregateSum, Variable: "load"}))
+	assert.Equal(t, 4.0, calculate(data.BotGroupAggregate{Type: data.AggregateMean, Variable: "load"}), "Bots without the Variable are skipped")
+	assert.Equal(t, 2.0, calculate(data.BotGroupAggregate{Type: data.AggregateMin, Variable: "load"}))
+	assert.Equal(t, 6.0, calculate(data.BotGroupAggregate{Type: data.AggregateMax, Variable: "load"}))
+	assert.Equal(t, 4.5, calculate(data.BotGroupAggregate{Type: data.AggregatePercentile, Variable: "load", Percentile: 75}))
+
+	_, err := CalculateBotGroupAggregate(&botGroup, data.BotGroupAggregate{Name: "missing", Type: data.AggregateSum, Variable: "missing"})
+	assert.NotNil(t, err, "No Bots have the Variable")
+
+	_, err = CalculateBotGroupAggregate(&botGroup, data.BotGroupAggregate{Type: data.AggregateCountInState, State: "Health"})
+	assert.NotNil(t, err, "State must have a label")
+}
+
+func TestUpdateBotGroupAggregates(t *testing.T) {
+	botGroup := getAggregateTestBotGroup()
+	botGroup.AggregateValues = map[string]float64{"removed": 1}
+	botGroup.Aggregates = []data.BotGroupAggregate{
+		{Name: "load_mean", Type: data.AggregateMean, Variable: "load"},
+		{Name: "missing_sum", Type: data.AggregateSum, Variable: "missing"},
+		{Name: "load_zscore", Type: data.AggregateZScore, Variable: "load"},
+		{Name: "load_rank", Type: data.AggregateRank, Variable: "load"},
+	}
+
+	UpdateBotGroupAggregates(&botGroup)
+
+	assert.Equal(t, map[string]float64{"load_mean": 4}, botGroup.AggregateValues, "Only Group level values that could be calculated are set")
+
+	var zScores, ranks []float64
+	for _, bot := range botGroup.Bots[:4] {
+		zScores = append(zScores, bot.VariableValues["load_zscore"])
+		ranks = append(ranks, bot.VariableValues["load_rank"])
+	}
+	assert.InDeltaSlice(t, []float64{-1.4142, 0, 0, 1.4142}, zScores, 0.0001)
+	assert.Equal(t, []float64{4, 2, 2, 1}, ranks, "Competition rank, highest is 1, and ties share a rank")
+	assert.Empty(t, botGroup.Bots[4].VariableValues, "Bots without the Variable get no Peer relative values")
+}
+
+func TestSetBotPeerRelativeValues(t *testing.T) {
+	botGroup := getAggregateTestBotGroup()
+	for botIndex := range botGroup.Bots[:4] {
+		botGroup.Bots[botIndex].VariableValues["load"] = 3
+	}
+	zScore := data.BotGroupAggregate{Name: "load_zscore", Type: data.AggregateZScore, Variable: "load"}
+
+	SetBotPeerRelativeValues(&botGroup, zScore)
+	assert.Equal(t, 0.0, botGroup.Bots[0].VariableValues["load_zscore"], "A zero stddev is a zero z-score")
+
+	// The Variable disappears from a Bot, so its previous z-score is stale
+	delete(botGroup.Bots[0].VariableValues, "load")
+	SetBotPeerRelativeValues(&botGroup, zScore)
+	_, ok := botGroup.Bots[0].VariableValues["load_zscore"]
+	assert.False(t, ok, "Stale Peer relative values are removed")
+	_, ok = botGroup.Bots[1].VariableValues["load_zscore"]
+	assert.True(t, ok)
+}
+
+func TestStdDevFloat64(t *testing.T) {
+	assert.Equal(t, 0.0, StdDevFloat64(nil, 0))
+	assert.Equal(t, 0.0, StdDevFloat64([]float64{3, 3, 3}, 3))
+	assert.Equal(t, 2.0, StdDevFloat64([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 5), "Population standard deviation")
+}
+
+func TestPercentileFloat64(t *testing.T) {
+	values := []float64{40, 10, 30, 20}
+
+	assert.Equal(t, 0.0, PercentileFloat64(nil, 50))
+	assert.Equal(t, 10.0, PercentileFloat64(values, 0))
+	assert.Equal(t, 25.0, PercentileFloat64(values, 50), "Interpolates between the closest ranks")
+	assert.Equal(t, 40.0, PercentileFloat64(values, 100))
+	assert.Equal(t, 40.0, PercentileFloat64(values, 150), "Percentile is clamped to 0-100")
+	assert.Equal(t, []float64{40, 10, 30, 20}, values, "Values aren't sorted in place")
+}
@@ -1,7 +1,6 @@
 package app
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ghowland/sireus/code/data"
@@ -9,6 +8,7 @@ import (
 	"github.com/ghowland/sireus/code/util"
 	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -16,44 +16,157 @@ import (
 
 // Load the BotGroup config from a path
 func LoadBotGroupConfig(path string) data.BotGroup {
-	botGroupData, err := os.ReadFile(path)
-	util.CheckPanic(err)
-
-	var botGroup data.BotGroup
-	err = json.Unmarshal(botGroupData, &botGroup)
+	botGroup, err := LoadBotGroupConfigFile(path)
 	util.CheckPanic(err)
 
 	return botGroup
 }
 
-// Load our Site config for a path
-func LoadSiteConfig(appConfig data.AppConfig) data.Site {
-	siteData, err := os.ReadFile(appConfig.SiteConfigPath)
-	util.CheckPanic(err)
+// Load the Site config from a path, returning read and parse errors, so they can be reported by validation
+func LoadSiteConfigFile(path string) (*data.Site, error) {
+	site := &data.Site{}
+	document, includePaths, err := UnmarshalConfigFileDocument(path, site)
+	if util.Check(err) {
+		return nil, err
+	}
 
-	var site data.Site
-	err = json.Unmarshal(siteData, &site)
-	util.CheckPanic(err)
+	site.IncludePaths = includePaths
+
+	// Instances are interpolated when their BotGroups are loaded, after their BotGroup.ResolvedConfig is kept, so it
+	// doesn't show secrets
+	site.BotGroupInstances = GetSiteBotGroupInstanceDocuments(document)
+
+	for index := range site.QueryServers {
+		site.QueryServers[index].SiteName = site.Name
+	}
+
+	return site, nil
+}
+
+// Returns the "bot_group_instances" of a Site config document, before interpolation.  The document was already
+// unmarshalled into a Site, so its types are correct.
+func GetSiteBotGroupInstanceDocuments(document interface{}) []map[string]interface{} {
+	documentMap, _ := document.(map[string]interface{})
+	instances, _ := documentMap["bot_group_instances"].([]interface{})
+
+	var instanceDocuments []map[string]interface{}
+	for _, instance := range instances {
+		instanceDocument, _ := instance.(map[string]interface{})
+		instanceDocuments = append(instanceDocuments, instanceDocument)
+	}
+
+	return instanceDocuments
+}
+
+// Load all the Sites in the AppConfig, in order.  Invalid configs panic, see LoadSiteConfig()
+func LoadSiteConfigs(appConfig data.AppConfig) []*data.Site {
+	var sites []*data.Site
+	for _, sitePath := range GetSiteConfigPaths(appConfig) {
+		sites = append(sites, LoadSiteConfig(appConfig, sitePath))
+	}
+	return sites
+}
+
+// Load all of a Site's BotGroup configs: the Site.BotGroupPaths files, then the Site.BotGroupInstances, whose template
+// paths are relative to the Site config.  Returns the BotGroups with their BotGroup.ConfigSource, for error reporting, and any errors loading them
+func LoadSiteBotGroupConfigs(sitePath string, site *data.Site) ([]data.BotGroup, []string, []data.ConfigValidationError) {
+	var botGroups []data.BotGroup
+	var botGroupSources []string
+	var validationErrors []data.ConfigValidationError
+
+	for index, botGroupPath := range site.BotGroupPaths {
+		botGroup, err := LoadBotGroupConfigFile(botGroupPath)
+		if util.Check(err) {
+			if os.IsNotExist(err) {
+				validationErrors = append(validationErrors, data.ConfigValidationError{Path: sitePath, JsonPath: fmt.Sprintf("$.bot_group_paths[%d]", index), Message: fmt.Sprintf("Bot Group config not found: %s", botGroupPath)})
+			} else {
+				validationErrors = append(validationErrors, GetConfigParseError(botGroupPath, err))
+			}
+			continue
+		}
+
+		botGroups = append(botGroups, botGroup)
+		botGroupSources = append(botGroupSources, botGroup.ConfigSource)
+	}
+
+	for index, instance := range site.BotGroupInstances {
+		source := fmt.Sprintf("%s#bot_group_instances[%d]", sitePath, index)
+		botGroup, err := GetBotGroupFromConfigDocument(source, filepath.Dir(sitePath), instance)
+		if util.Check(err) {
+			validationErrors = append(validationErrors, data.ConfigValidationError{Path: sitePath, JsonPath: fmt.Sprintf("$.bot_group_instances[%d]", index), Message: err.Error()})
+			continue
+		}
+
+		botGroups = append(botGroups, botGroup)
+		botGroupSources = append(botGroupSources, botGroup.ConfigSource)
+	}
+
+	return botGroups, botGroupSources, validationErrors
+}
+
+// Load our Site config for a path.  Invalid configs are logged with all their errors and panic, so a bad config
+// can't start.  Use ValidateAppConfig() to check a config without starting.
+func LoadSiteConfig(appConfig data.AppConfig, sitePath string) *data.Site {
+	site, err := LoadSiteConfigFile(sitePath)
+	if util.Check(err) {
+		panic(GetConfigParseError(sitePath, err).String())
+	}
 
 	// Initialize data that isn't auto-initialized or loaded from JSON
+	site.ConfigPath = sitePath
 	site.ProductionControl = GetProductionInteractiveControl()
 	site.InteractiveSessionCache.Sessions = make(map[data.SessionUUID]data.InteractiveSession)
+	site.BotGroupWatches.Watched = make(map[string]time.Time)
 	site.QueryResultCache = data.QueryResultPool{
 		PoolItems:  make(map[string]data.QueryResultPoolItem),
 		QueryLocks: make(map[string]time.Time),
 	}
 
 	// Load all our Bot Groups.  We keep these cached for cloning, so we don't have to parse JSON all the time, but put nothing dynamic into them
-	for _, botGroupPath := range site.BotGroupPaths {
-		botGroup := LoadBotGroupConfig(botGroupPath)
-		botGroup.LockKey = fmt.Sprintf("%s.%s", site.Name, botGroup.Name)
+	botGroupConfigs, botGroupSources, validationErrors := LoadSiteBotGroupConfigs(sitePath, site)
+
+	// Check every cross-reference before anything uses the config
+	validationErrors = append(validationErrors, ValidateSite(appConfig, sitePath, site, botGroupConfigs, botGroupSources)...)
+	if len(validationErrors) > 0 {
+		for _, validationError := range validationErrors {
+			log.Printf("Config Invalid: %s", validationError.String())
+		}
+		panic(fmt.Sprintf("Config Invalid: %d errors, see log", len(validationErrors)))
+	}
+
+	for _, botGroup := range botGroupConfigs {
+		err = PrepareBotGroup(site, &botGroup)
+		util.CheckPanic(err)
 
 		site.LoadedBotGroups = append(site.LoadedBotGroups, botGroup)
 	}
 
+	// BotGroups that reference each other must be able to be processed in order
+	err = ValidateBotGroupDependencies(site.LoadedBotGroups)
+	util.CheckPanic(err)
+
 	return site
 }
 
+// Prepare a loaded BotGroup config to be used in a Site.  Sets the LockKey, compiles all the expressions once, so they
+// aren't compiled for every Bot on every loop, and orders the Synthetic Variables, because they can reference each other
+func PrepareBotGroup(site *data.Site, botGroup *data.BotGroup) error {
+	botGroup.LockKey = fmt.Sprintf("%s.%s", site.Name, botGroup.Name)
+	botGroup.SiteName = site.Name
+
+	err := CompileBotGroupExpressions(botGroup)
+	if util.Check(err) {
+		return err
+	}
+
+	botGroup.SyntheticVariableOrder, err = GetSyntheticVariableOrder(botGroup)
+	if util.Check(err) {
+		return err
+	}
+
+	return nil
+}
+
 // Takes an InteractiveControl struct, and creates a InteractiveSession, which is used everywhere and contains live BotGroups
 func GetInteractiveSession(interactiveControl data.InteractiveControl, site *data.Site) data.InteractiveSession {
 	site.InteractiveSessionCache.AccessLock.Lock()
@@ -64,8 +177,9 @@ func GetInteractiveSession(interactiveControl data.InteractiveControl, site *dat
 	if !ok {
 		// Couldn't find it, so create one
 		session = data.InteractiveSession{
-			UUID:      interactiveControl.SessionUUID,
-			BotGroups: site.LoadedBotGroups,
+			UUID:        interactiveControl.SessionUUID,
+			BotGroups:   GetSiteLoadedBotGroups(site),
+			TimeCreated: util.GetTimeNow(),
 		}
 		site.InteractiveSessionCache.Sessions[interactiveControl.SessionUUID] = session
 	}
@@ -92,6 +206,15 @@ func GetInteractiveSession(interactiveControl data.InteractiveControl, site *dat
 	return session
 }
 
+// Returns "now" for this session.  Backtest sessions step through time with InteractiveSession.SimulatedTime, all
+// others use the wall clock.  Anything that compares times during BotGroup updates must use this.
+func GetSessionTimeNow(session *data.InteractiveSession) time.Time {
+	if !session.SimulatedTime.IsZero() {
+		return session.SimulatedTime
+	}
+	return util.GetTimeNow()
+}
+
 // GetProductionInteractiveControl returns a SessionUUID==0 data set for production data.
 // TODO(ghowland): These should be altered by AppConfig
 func GetProductionInteractiveControl() data.InteractiveControl {
@@ -109,7 +232,7 @@ func GetProductionInteractiveControl() data.InteractiveControl {
 
 // Returns a QueryServer, scope is per Site
 func GetQueryServer(site *data.Site, name string) (data.QueryServer, error) {
-	for _, queryServer := range site.QueryServers {
+	for _, queryServer := range GetSiteQueryServers(site) {
 		if queryServer.Name == name {
 			return queryServer, nil
 		}
@@ -174,7 +297,7 @@ func GetConditionLastExecuteTime(session *data.InteractiveSession, botGroup *dat
 		}
 
 		// If this is past our time to stop looking, then this hasn't been run in the time we care about
-		if util.GetTimeNow().Sub(commandResult.Started) > time.Duration(stopLookingAfter) {
+		if GetSessionTimeNow(session).Sub(commandResult.Started) > time.Duration(stopLookingAfter) {
 			return time.Time{}, errors.New(fmt.Sprintf("This command has not been run since the timeout: %d  Bot Group: %s  Bot: %s  Condition: %s  Timeout: %v", session.UUID, botGroup.Name, bot.Name, action.Name, stopLookingAfter))
 		}
 	}
@@ -182,10 +305,27 @@ func GetConditionLastExecuteTime(session *data.InteractiveSession, botGroup *dat
 	return time.Time{}, errors.New(fmt.Sprintf("This command has not been in the entire command history: %d  Bot Group: %s  Bot: %s  Condition: %s  Timeout: %v", session.UUID, botGroup.Name, bot.Name, action.Name, stopLookingAfter))
 }
 
-// For a given Condition, does this Bot have all the RequiredStates active?
-func AreAllConditionStatesActive(action data.Condition, bot *data.Bot) bool {
-	for _, state := range action.RequiredStates {
-		if !util.StringInSlice(bot.StateValues, state) {
+// For a given Condition, does this Bot have all the RequiredStates active?  RequiredStates can be negated, and can
+// reference other BotGroups, which are active if any of their Bots have the State.  See ParseRequiredState()
+func AreAllConditionStatesActive(action data.Condition, bot *data.Bot, botGroups []data.BotGroup) bool {
+	for _, requiredState := range action.RequiredStates {
+		stateBotGroupName, state, isNegated := ParseRequiredState(requiredState)
+
+		isActive := false
+		if stateBotGroupName == "" {
+			isActive = util.StringInSlice(bot.StateValues, state)
+		} else {
+			stateBotGroup, err := GetBotGroupFromSlice(botGroups, stateBotGroupName)
+			if util.Check(err) {
+				log.Printf("Missing Bot Group: %s  Invalid configuration, will never activate Condition: %s", stateBotGroupName, action.Name)
+				return false
+			}
+
+			stateCounts := GetBotGroupStateCounts(stateBotGroup)
+			isActive = stateCounts[state] > 0
+		}
+
+		if isActive == isNegated {
 			return false
 		}
 	}
@@ -193,9 +333,9 @@ func AreAllConditionStatesActive(action data.Condition, bot *data.Bot) bool {
 }
 
 // For a given Condition, does this Bot Group have all the Lock Timers available to be locked?
-func AreAllConditionLockTimersAvailable(action data.Condition, botGroup *data.BotGroup) bool {
+func AreAllConditionLockTimersAvailable(action data.Condition, botGroup *data.BotGroup, now time.Time) bool {
 	for _, lockTimerName := range action.RequiredLockTimers {
-		lockTimer, err := GetLockTimer(botGroup, lockTimerName)
+		lockTimer, err := GetLockTimer(botGroup, lockTimerName, now)
 		if util.Check(err) {
 			log.Printf("Missing Lock Timer: %s  Invalid configuration, will never activate Condition: %s  Bot Group: %s", lockTimerName, action.Name, botGroup.Name)
 			return false
@@ -210,9 +350,9 @@ func AreAllConditionLockTimersAvailable(action data.Condition, botGroup *data.Bo
 }
 
 // When executing a Condition, we will set all the Lock Timers that Condition required, for the duration specified in the ConditionCommand
-func SetAllConditionLockTimers(action data.Condition, botGroup *data.BotGroup, duration data.Duration) {
+func SetAllConditionLockTimers(action data.Condition, botGroup *data.BotGroup, duration data.Duration, now time.Time) {
 	for _, lockTimerName := range action.RequiredLockTimers {
-		SetLockTimer(botGroup, lockTimerName, duration)
+		SetLockTimer(botGroup, lockTimerName, duration, now)
 	}
 }
 
@@ -362,27 +502,32 @@ func GetStateIndex(botGroup *data.BotGroup, state string) (int, error) {
 	return -1, errors.New(fmt.Sprintf("Missing State: %s  Bot Group: %s", state, botGroup.Name))
 }
 
-// Get a BotLockTimer from the BotGroup
-func GetLockTimer(botGroup *data.BotGroup, lockTimerName string) (*data.BotLockTimer, error) {
-	for _, lockTimer := range botGroup.LockTimers {
+// Get a BotLockTimer from the BotGroup.  If it is active and timed out at the time now, it is set inactive.  Returns a
+// pointer into BotGroup.LockTimers, so the BotGroup's Lock Timer is changed, not a copy
+func GetLockTimer(botGroup *data.BotGroup, lockTimerName string, now time.Time) (*data.BotLockTimer, error) {
+	for index := range botGroup.LockTimers {
+		lockTimer := &botGroup.LockTimers[index]
 		if lockTimer.Name == lockTimerName {
 			// If the lock timer is active, but it has timed out, then set to inactive
-			if lockTimer.IsActive && lockTimer.Timeout.Unix() < util.GetTimeNow().Unix() {
+			if lockTimer.IsActive && lockTimer.Timeout.Unix() < now.Unix() {
 				lockTimer.IsActive = false
 			}
 
-			return &lockTimer, nil
+			return lockTimer, nil
 		}
 	}
 
 	return &data.BotLockTimer{}, errors.New(fmt.Sprintf("Lock Timer Not Found: %s  Bot Group: %s", lockTimerName, botGroup.Name))
 }
 
-func SetLockTimer(botGroup *data.BotGroup, lockTimerName string, duration data.Duration) {
-	for _, lockTimer := range botGroup.LockTimers {
+// Set the BotGroup's BotLockTimer active for the duration, from the time now.  It stays active in the BotGroup, so
+// Conditions requiring it are blocked until it times out
+func SetLockTimer(botGroup *data.BotGroup, lockTimerName string, duration data.Duration, now time.Time) {
+	for index := range botGroup.LockTimers {
+		lockTimer := &botGroup.LockTimers[index]
 		if lockTimer.Name == lockTimerName {
 			lockTimer.IsActive = true
-			lockTimer.Timeout = util.GetTimeNow().Add(time.Duration(duration))
+			lockTimer.Timeout = now.Add(time.Duration(duration))
 			return
 		}
 	}
@@ -449,17 +594,19 @@ func GetCommandHistoryAll(session *data.InteractiveSession, count int) []data.Co
 	return history
 }
 
-// ADMIN: Clear the Command History to make the demo look nicer.  Only available if Demo is enabled
+// ADMIN: Clear the Command History of all Sites to make the demo look nicer.  Only available if Demo is enabled
 func AdminClearCommandHistory() {
 	if !data.SireusData.AppConfig.EnableDemo {
 		log.Printf("Clearing the command history is not allowed when the Demo is not active.  It is not suitable for a production use case.")
 	}
 
-	session := GetInteractiveSession(data.SireusData.Site.ProductionControl, &data.SireusData.Site)
-	for botGroupIndex := range session.BotGroups {
-		for botIndex := range session.BotGroups[botGroupIndex].Bots {
-			bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
-			bot.CommandHistory = []data.ConditionCommandResult{}
+	for _, site := range GetSites() {
+		session := GetInteractiveSession(site.ProductionControl, site)
+		for botGroupIndex := range session.BotGroups {
+			for botIndex := range session.BotGroups[botGroupIndex].Bots {
+				bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
+				bot.CommandHistory = []data.ConditionCommandResult{}
+			}
 		}
 	}
 }
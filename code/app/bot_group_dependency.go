@@ -0,0 +1,171 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"strings"
+)
+
+// Returns the indexes of the BotGroups in the order they must be processed, so every BotGroup is processed after all
+// of its BotGroup.DependsOn BotGroups.  BotGroups without dependencies keep their config order.  Returns an error if a
+// dependency is missing, or the dependencies create a cycle.
+func GetBotGroupDependencyOrder(botGroups []data.BotGroup) ([]int, error) {
+	nameIndex := make(map[string]int)
+	for index, botGroup := range botGroups {
+		nameIndex[botGroup.Name] = index
+	}
+
+	// Count how many distinct dependencies each BotGroup is waiting on.  Duplicate names are only counted once, as they
+	// are only released once below.
+	waiting := make([]int, len(botGroups))
+	for index, botGroup := range botGroups {
+		var dependNames []string
+		for _, dependName := range botGroup.DependsOn {
+			if _, ok := nameIndex[dependName]; !ok {
+				return nil, errors.New(fmt.Sprintf("Bot Group: %s  Depends on missing Bot Group: %s", botGroup.Name, dependName))
+			}
+			if dependName == botGroup.Name {
+				return nil, errors.New(fmt.Sprintf("Bot Group: %s  Depends on itself", botGroup.Name))
+			}
+			if !util.StringInSlice(dependNames, dependName) {
+				dependNames = append(dependNames, dependName)
+			}
+		}
+		waiting[index] = len(dependNames)
+	}
+
+	var order []int
+	processed := make([]bool, len(botGroups))
+
+	// Each pass takes the first BotGroup in config order that has no unprocessed dependencies.  N is small.
+	for len(order) < len(botGroups) {
+		found := false
+		for index := range botGroups {
+			if processed[index] || waiting[index] > 0 {
+				continue
+			}
+
+			order = append(order, index)
+			processed[index] = true
+			found = true
+
+			// Everything depending on this BotGroup is waiting on one less dependency
+			for otherIndex, other := range botGroups {
+				if util.StringInSlice(other.DependsOn, botGroups[index].Name) {
+					waiting[otherIndex]--
+				}
+			}
+			break
+		}
+
+		if !found {
+			var cycle []string
+			for index, botGroup := range botGroups {
+				if !processed[index] {
+					cycle = append(cycle, botGroup.Name)
+				}
+			}
+			return nil, errors.New(fmt.Sprintf("Bot Group dependency cycle between: %s", util.PrintStringArrayCSV(cycle)))
+		}
+	}
+
+	return order, nil
+}
+
+// Validates the BotGroup dependencies can be ordered, and that all Condition.RequiredStates that reference another
+// BotGroup are in BotGroup.DependsOn.  Called at config load time.
+func ValidateBotGroupDependencies(botGroups []data.BotGroup) error {
+	_, err := GetBotGroupDependencyOrder(botGroups)
+	if util.Check(err) {
+		return err
+	}
+
+	for _, botGroup := range botGroups {
+		for _, condition := range botGroup.Conditions {
+			for _, requiredState := range condition.RequiredStates {
+				stateBotGroupName, _, _ := ParseRequiredState(requiredState)
+				if stateBotGroupName != "" && !util.StringInSlice(botGroup.DependsOn, stateBotGroupName) {
+					return errors.New(fmt.Sprintf("Bot Group: %s  Condition: %s  Required State references Bot Group not in depends_on: %s", botGroup.Name, condition.Name, requiredState))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Parses a Condition.RequiredStates entry into the BotGroup.Name it references (empty for this Bot), the
+// "(State.Name).(Label)" and if it is negated.  Format: "[!][(BotGroup.Name):](State.Name).(Label)"
+func ParseRequiredState(requiredState string) (string, string, bool) {
+	isNegated := false
+	if strings.HasPrefix(requiredState, "!") {
+		isNegated = true
+		requiredState = requiredState[1:]
+	}
+
+	botGroupName := ""
+	if strings.Contains(requiredState, ":") {
+		stateSplit := strings.SplitN(requiredState, ":", 2)
+		botGroupName = stateSplit[0]
+		requiredState = stateSplit[1]
+	}
+
+	return botGroupName, requiredState, isNegated
+}
+
+// Returns the number of Bots in every State label for this BotGroup, key is "(State.Name).(Label)".  All the labels
+// are present, so a 0 count can be evaluated.
+func GetBotGroupStateCounts(botGroup *data.BotGroup) map[string]float64 {
+	stateCounts := make(map[string]float64)
+
+	for _, state := range botGroup.States {
+		for _, label := range state.Labels {
+			stateCounts[fmt.Sprintf("%s.%s", state.Name, label)] = 0
+		}
+	}
+
+	for _, bot := range botGroup.Bots {
+		for _, stateValue := range bot.StateValues {
+			stateCounts[stateValue]++
+		}
+	}
+
+	return stateCounts
+}
+
+// Update BotGroup.DependencyValues from the Aggregates and State counts of every BotGroup.DependsOn BotGroup.  The
+// dependencies must already be processed this loop, see GetBotGroupDependencyOrder()
+func UpdateBotGroupDependencyValues(botGroups []data.BotGroup, botGroupIndex int) {
+	botGroup := &botGroups[botGroupIndex]
+
+	dependencyValues := make(map[string]float64)
+
+	for _, dependName := range botGroup.DependsOn {
+		dependBotGroup, err := GetBotGroupFromSlice(botGroups, dependName)
+		if util.Check(err) {
+			continue
+		}
+
+		for aggregateName, value := range dependBotGroup.AggregateValues {
+			dependencyValues[fmt.Sprintf("%s.%s", dependName, aggregateName)] = value
+		}
+
+		for stateKey, count := range GetBotGroupStateCounts(dependBotGroup) {
+			dependencyValues[fmt.Sprintf("%s.%s", dependName, stateKey)] = count
+		}
+	}
+
+	botGroup.DependencyValues = dependencyValues
+}
+
+// Returns a BotGroup pointer from a slice of BotGroups, by name
+func GetBotGroupFromSlice(botGroups []data.BotGroup, botGroupName string) (*data.BotGroup, error) {
+	for index := range botGroups {
+		if botGroups[index].Name == botGroupName {
+			return &botGroups[index], nil
+		}
+	}
+	return &data.BotGroup{}, errors.New(fmt.Sprintf("Bot Group Missing: %s", botGroupName))
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// Returns a Database BotGroup with an Operation state and a Bot in each label, and an App BotGroup that depends on it
+func getDependencyTestBotGroups() []data.BotGroup {
+	return []data.BotGroup{
+		{
+			Name:      "App",
+			DependsOn: []string{"Database"},
+			States:    []data.BotForwardSequenceState{{Name: "Operation", Labels: []string{"Default", "Problem"}}},
+			Bots:      []data.Bot{{Name: "web1", StateValues: []string{"Operation.Default"}}},
+		},
+		{
+			Name:            "Database",
+			States:          []data.BotForwardSequenceState{{Name: "Operation", Labels: []string{"Default", "Problem", "Failed"}}},
+			AggregateValues: map[string]float64{"load_mean": 0.5},
+			Bots: []data.Bot{
+				{Name: "db1", StateValues: []string{"Operation.Default"}},
+				{Name: "db2", StateValues: []string{"Operation.Problem"}},
+				{Name: "db3", StateValues: []string{"Operation.Problem"}},
+			},
+		},
+	}
+}
+
+func TestGetBotGroupDependencyOrder(t *testing.T) {
+	order, err := GetBotGroupDependencyOrder(getDependencyTestBotGroups())
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 0}, order, "Dependencies are processed first")
+
+	order, err = GetBotGroupDependencyOrder([]data.BotGroup{{Name: "A"}, {Name: "B"}, {Name: "C", DependsOn: []string{"A"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 2}, order, "Config order is kept when it satisfies the dependencies")
+
+	order, err = GetBotGroupDependencyOrder([]data.BotGroup{{Name: "A", DependsOn: []string{"B", "B"}}, {Name: "B"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 0}, order, "Duplicate dependencies are not a cycle")
+
+	_, err = GetBotGroupDependencyOrder([]data.BotGroup{{Name: "A", DependsOn: []string{"A"}}})
+	assert.EqualError(t, err, "Bot Group: A  Depends on itself")
+
+	_, err = GetBotGroupDependencyOrder([]data.BotGroup{{Name: "A", DependsOn: []string{"Missing"}}})
+	assert.EqualError(t, err, "Bot Group: A  Depends on missing Bot Group: Missing")
+
+	_, err = GetBotGroupDependencyOrder([]data.BotGroup{
+		{Name: "A"},
+		{Name: "B", DependsOn: []string{"C"}},
+		{Name: "C", DependsOn: []string{"B"}},
+	})
+	assert.EqualError(t, err, "Bot Group dependency cycle between: B, C")
+}
+
+func TestParseRequiredState(t *testing.T) {
+	botGroupName, state, isNegated := ParseRequiredState("Operation.Default")
+	assert.Equal(t, []interface{}{"", "Operation.Default", false}, []interface{}{botGroupName, state, isNegated})
+
+	botGroupName, state, isNegated = ParseRequiredState("!Operation.Problem")
+	assert.Equal(t, []interface{}{"", "Operation.Problem", true}, []interface{}{botGroupName, state, isNegated})
+
+	botGroupName, state, isNegated = ParseRequiredState("Database:Operation.Problem")
+	assert.Equal(t, []interface{}{"Database", "Operation.Problem", false}, []interface{}{botGroupName, state, isNegated})
+
+	botGroupName, state, isNegated = ParseRequiredState("!Database:Operation.Problem")
+	assert.Equal(t, []interface{}{"Database", "Operation.Problem", true}, []interface{}{botGroupName, state, isNegated})
+}
+
+func TestGetBotGroupStateCounts(t *testing.T) {
+	botGroups := getDependencyTestBotGroups()
+
+	assert.Equal(t, map[string]float64{
+		"Operation.Default": 1,
+		"Operation.Problem": 2,
+		"Operation.Failed":  0,
+	}, GetBotGroupStateCounts(&botGroups[1]), "Every label is present, including unused ones")
+}
+
+func TestUpdateBotGroupDependencyValues(t *testing.T) {
+	botGroups := getDependencyTestBotGroups()
+
+	UpdateBotGroupDependencyValues(botGroups, 0)
+
+	assert.Equal(t, map[string]float64{
+		"Database.load_mean":         0.5,
+		"Database.Operation.Default": 1,
+		"Database.Operation.Problem": 2,
+		"Database.Operation.Failed":  0,
+	}, botGroups[0].DependencyValues)
+
+	UpdateBotGroupDependencyValues(botGroups, 1)
+	assert.Empty(t, botGroups[1].DependencyValues, "No DependsOn gives no values")
+}
+
+func TestAreAllConditionStatesActiveDependsOn(t *testing.T) {
+	botGroups := getDependencyTestBotGroups()
+	bot := &botGroups[0].Bots[0]
+
+	isActive := func(requiredStates ...string) bool {
+		return AreAllConditionStatesActive(data.Condition{Name: "Test", RequiredStates: requiredStates}, bot, botGroups)
+	}
+
+	assert.True(t, isActive("Operation.Default", "Database:Operation.Problem"), "Any Bot in the other BotGroup can have the State")
+	assert.False(t, isActive("Database:Operation.Failed"), "No Bot in the other BotGroup has the State")
+	assert.True(t, isActive("!Database:Operation.Failed"))
+	assert.False(t, isActive("!Database:Operation.Problem"))
+	assert.False(t, isActive("Missing:Operation.Problem"), "A missing BotGroup never activates")
+
+	assert.Nil(t, ValidateBotGroupDependencies(botGroups))
+
+	botGroups[1].Conditions = []data.Condition{{Name: "Failover", RequiredStates: []string{"App:Operation.Problem"}}}
+	assert.EqualError(t, ValidateBotGroupDependencies(botGroups), "Bot Group: Database  Condition: Failover  Required State references Bot Group not in depends_on: App:Operation.Problem")
+}
+
+func TestValidateBotGroupDependsOnDuplicate(t *testing.T) {
+	botGroups := getDependencyTestBotGroups()
+	botGroups[0].DependsOn = []string{"Database", "Missing", "Database"}
+
+	var messages []string
+	for _, validationError := range ValidateBotGroup(data.AppConfig{}, "app.json", &botGroups[0], nil, botGroups) {
+		if strings.HasPrefix(validationError.JsonPath, "$.depends_on") {
+			messages = append(messages, validationError.JsonPath+": "+validationError.Message)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"$.depends_on[1]: Bot Group not found: Missing",
+		"$.depends_on[2]: Duplicate Bot Group: Database",
+	}, messages)
+}
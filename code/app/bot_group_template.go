@@ -0,0 +1,313 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	BotGroupTemplateExtendsKey = "extends" // Path of the BotGroup template this config extends, relative to the config's directory.  Templates can extend other templates
+	BotGroupTemplateParamsKey  = "params"  // Template parameters, used in any string as "${param:NAME}".  Configs override their template's params
+	BotGroupTemplateRemoveKey  = "remove"  // If true in a named item, like a State or Query, the template's item with the same name is removed
+)
+
+var (
+	// Matches a template parameter in a string, ex: "${param:job}"
+	botGroupTemplateParamRegex = regexp.MustCompile(`\$\{param:([A-Za-z0-9_.\-]+)}`)
+)
+
+// Load the BotGroup config from a path, returning read and parse errors, so they can be reported by validation.
+// Templates the config extends are resolved, see ResolveBotGroupTemplates()
+func LoadBotGroupConfigFile(path string) (data.BotGroup, error) {
+	document, includePaths, err := loadBotGroupConfigDocument(path)
+	if util.Check(err) {
+		return data.BotGroup{}, err
+	}
+
+	// Configs without templates are checked as written, so type errors are reported with their line and column
+	if !IsBotGroupTemplateDocument(document) {
+		var botGroup data.BotGroup
+		err = UnmarshalConfigFile(path, &botGroup)
+		if util.Check(err) {
+			return data.BotGroup{}, err
+		}
+	}
+
+	botGroup, err := GetBotGroupFromConfigDocument(path, filepath.Dir(path), document)
+	if util.Check(err) {
+		return data.BotGroup{}, err
+	}
+
+	botGroup.IncludePaths = append(includePaths, botGroup.IncludePaths...)
+
+	return botGroup, nil
+}
+
+// Returns true if a BotGroup config document uses a template or template parameters
+func IsBotGroupTemplateDocument(document map[string]interface{}) bool {
+	_, extends := document[BotGroupTemplateExtendsKey]
+	_, params := document[BotGroupTemplateParamsKey]
+	return extends || params
+}
+
+// Resolve a BotGroup config document's templates, and return the BotGroup.  source is where the document came from,
+// a file path or a Site's "bot_group_instances" entry, for the web app and errors.  Template paths are relative to
+// baseDir.  The BotGroup.ResolvedConfig is kept before interpolation, so secrets aren't shown in the web app.
+func GetBotGroupFromConfigDocument(source string, baseDir string, document map[string]interface{}) (data.BotGroup, error) {
+	resolved, templatePaths, includePaths, err := ResolveBotGroupTemplates(document, baseDir)
+	if util.Check(err) {
+		return data.BotGroup{}, err
+	}
+
+	interpolated, err := InterpolateConfigDocument(resolved)
+	if util.Check(err) {
+		return data.BotGroup{}, err
+	}
+
+	var botGroup data.BotGroup
+	err = UnmarshalConfigDocument(interpolated, &botGroup)
+	if util.Check(err) {
+		return data.BotGroup{}, err
+	}
+
+	botGroup.ConfigSource = source
+	botGroup.TemplatePaths = templatePaths
+	botGroup.IncludePaths = includePaths
+	botGroup.ResolvedConfig = util.PrintJson(resolved)
+
+	return botGroup, nil
+}
+
+// Resolve a BotGroup config document's templates.  The "extends" template is resolved first, and the document is deep
+// merged over it, see MergeBotGroupConfig().  Then every "${param:NAME}" is replaced with its parameter.  Returns the
+// resolved document without the template keys, the paths of all the templates used, nearest first, and the paths of
+// the files the templates include.  Template paths are relative to baseDir.
+func ResolveBotGroupTemplates(document map[string]interface{}, baseDir string) (map[string]interface{}, []string, []string, error) {
+	includePaths := []string{}
+	merged, templatePaths, err := mergeBotGroupTemplates(document, baseDir, []string{}, &includePaths)
+	if util.Check(err) {
+		return nil, nil, nil, err
+	}
+
+	params, ok := merged[BotGroupTemplateParamsKey].(map[string]interface{})
+	if _, found := merged[BotGroupTemplateParamsKey]; found && !ok {
+		return nil, nil, nil, errors.New(fmt.Sprintf("Template \"%s\" must be an object", BotGroupTemplateParamsKey))
+	}
+	delete(merged, BotGroupTemplateParamsKey)
+
+	resolved, err := substituteBotGroupTemplateParams(merged, params, "$")
+	if util.Check(err) {
+		return nil, nil, nil, err
+	}
+
+	return resolved.(map[string]interface{}), templatePaths, includePaths, nil
+}
+
+// Merge the document over the template it extends, recursively.  extendsChain are the template paths already being
+// resolved, to detect templates extending each other.  Files the templates include are added to includePaths.
+func mergeBotGroupTemplates(document map[string]interface{}, baseDir string, extendsChain []string, includePaths *[]string) (map[string]interface{}, []string, error) {
+	extends, found := document[BotGroupTemplateExtendsKey]
+	if !found {
+		return document, []string{}, nil
+	}
+
+	templatePath, ok := extends.(string)
+	if !ok || templatePath == "" {
+		return nil, nil, errors.New(fmt.Sprintf("Template \"%s\" must be a path", BotGroupTemplateExtendsKey))
+	}
+	if !filepath.IsAbs(templatePath) {
+		templatePath = filepath.Join(baseDir, templatePath)
+	}
+
+	if util.StringInSlice(extendsChain, templatePath) {
+		return nil, nil, errors.New(fmt.Sprintf("Template extends itself: %s -> %s", strings.Join(extendsChain, " -> "), templatePath))
+	}
+
+	template, templateIncludePaths, err := loadBotGroupConfigDocument(templatePath)
+	if util.Check(err) {
+		return nil, nil, errors.New(fmt.Sprintf("Template could not be loaded: %s", GetConfigParseError(templatePath, err).String()))
+	}
+	*includePaths = append(*includePaths, templateIncludePaths...)
+
+	chain := append(append([]string{}, extendsChain...), templatePath)
+	base, templatePaths, err := mergeBotGroupTemplates(template, filepath.Dir(templatePath), chain, includePaths)
+	if util.Check(err) {
+		return nil, nil, err
+	}
+
+	override := make(map[string]interface{})
+	for key, value := range document {
+		if key != BotGroupTemplateExtendsKey {
+			override[key] = value
+		}
+	}
+
+	merged := MergeBotGroupConfig(base, override).(map[string]interface{})
+
+	return merged, append([]string{templatePath}, templatePaths...), nil
+}
+
+// Deep merge a BotGroup config over its template.  Objects are merged by key.  Lists of named items, like States,
+// Queries, Variables and Conditions, are merged by name: items with the same name are merged, new items are added
+// after the template's, and items with "remove" set to true remove the template's item.  An empty list clears the
+// template's list.  All other values replace the template's.
+func MergeBotGroupConfig(base interface{}, override interface{}) interface{} {
+	switch overrideValue := override.(type) {
+	case map[string]interface{}:
+		baseMap, _ := base.(map[string]interface{})
+		merged := make(map[string]interface{})
+		for key, value := range baseMap {
+			merged[key] = value
+		}
+		for key, value := range overrideValue {
+			merged[key] = MergeBotGroupConfig(baseMap[key], value)
+		}
+		return merged
+
+	case []interface{}:
+		baseList, _ := base.([]interface{})
+		if len(overrideValue) > 0 && isBotGroupConfigNamedList(baseList) && isBotGroupConfigNamedList(overrideValue) {
+			return mergeBotGroupConfigNamedList(baseList, overrideValue)
+		}
+		return overrideValue
+
+	default:
+		return override
+	}
+}
+
+// Merge lists of named items by name, keeping the template's order
+func mergeBotGroupConfigNamedList(baseList []interface{}, overrideList []interface{}) []interface{} {
+	merged := append([]interface{}{}, baseList...)
+
+	for _, overrideItem := range overrideList {
+		item := overrideItem.(map[string]interface{})
+		name := item["name"].(string)
+
+		index := -1
+		for mergedIndex, mergedItem := range merged {
+			if mergedItem.(map[string]interface{})["name"] == name {
+				index = mergedIndex
+				break
+			}
+		}
+
+		if remove, _ := item[BotGroupTemplateRemoveKey].(bool); remove {
+			if index != -1 {
+				merged = append(merged[:index], merged[index+1:]...)
+			}
+			continue
+		}
+
+		if index == -1 {
+			merged = append(merged, MergeBotGroupConfig(nil, item))
+		} else {
+			merged[index] = MergeBotGroupConfig(merged[index], item)
+		}
+	}
+
+	return merged
+}
+
+// Returns true if every item in the list is an object with a "name".  Empty lists are named, so a config can add
+// named items where the template has none
+func isBotGroupConfigNamedList(list []interface{}) bool {
+	for _, item := range list {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := itemMap["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Replace every "${param:NAME}" in the document's strings with its parameter.  A string that is only a parameter is
+// replaced with the parameter's value, so numbers and bools can be parameters.  Unset parameters are an error.
+func substituteBotGroupTemplateParams(value interface{}, params map[string]interface{}, jsonPath string) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		// Sorted, so the first error is always the same
+		var keys []string
+		for key := range typedValue {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		result := make(map[string]interface{})
+		for _, key := range keys {
+			// Items marked for removal only exist in the template merge
+			if key == BotGroupTemplateRemoveKey {
+				continue
+			}
+			item, err := substituteBotGroupTemplateParams(typedValue[key], params, jsonPath+"."+key)
+			if util.Check(err) {
+				return nil, err
+			}
+			result[key] = item
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(typedValue))
+		for index, item := range typedValue {
+			var err error
+			result[index], err = substituteBotGroupTemplateParams(item, params, fmt.Sprintf("%s[%d]", jsonPath, index))
+			if util.Check(err) {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	case string:
+		if match := botGroupTemplateParamRegex.FindStringSubmatch(typedValue); match != nil && match[0] == typedValue {
+			param, ok := params[match[1]]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("Template parameter not set: %s  At: %s", match[1], jsonPath))
+			}
+			return param, nil
+		}
+
+		missingParam := ""
+		result := botGroupTemplateParamRegex.ReplaceAllStringFunc(typedValue, func(text string) string {
+			name := botGroupTemplateParamRegex.FindStringSubmatch(text)[1]
+			param, ok := params[name]
+			if !ok {
+				missingParam = name
+				return text
+			}
+			return fmt.Sprint(param)
+		})
+		if missingParam != "" {
+			return nil, errors.New(fmt.Sprintf("Template parameter not set: %s  At: %s", missingParam, jsonPath))
+		}
+		return result, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// Load a BotGroup config or template document, and the paths of the files it includes, see LoadConfigDocument().
+// BotGroups must be objects
+func loadBotGroupConfigDocument(path string) (map[string]interface{}, []string, error) {
+	document, includePaths, err := LoadConfigDocument(path)
+	if util.Check(err) {
+		return nil, nil, err
+	}
+
+	documentMap, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, nil, errors.New("Bot Group config must be an object")
+	}
+
+	return documentMap, includePaths, nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes an "http service" BotGroup template into a temp dir, and returns its path
+func writeBotGroupTemplate(t *testing.T) string {
+	templatePath := filepath.Join(t.TempDir(), "http_service.json")
+	templateJson := `{
+  "params": {"threshold": 0.5},
+  "states": [
+    {"name": "Operation", "labels": ["Default", "Problem"]},
+    {"name": "Traffic", "labels": ["Default", "High"]}
+  ],
+  "bot_timeout_stale": 60,
+  "action_threshold": "${param:threshold}",
+  "bot_extractor": {"query_name": "Requests", "key": "instance"},
+  "queries": [
+    {"query_server": "prom", "name": "Requests", "query": "rate(http_requests{job=\"${param:job}\"}[1m])", "interval": "5s"},
+    {"query_server": "prom", "name": "Errors", "query": "rate(http_errors{job=\"${param:job}\"}[1m])", "interval": "5s"}
+  ]
+}`
+	assert.Nil(t, os.WriteFile(templatePath, []byte(templateJson), 0644))
+	return templatePath
+}
+
+func TestLoadBotGroupConfigFileTemplate(t *testing.T) {
+	templatePath := writeBotGroupTemplate(t)
+
+	botGroupPath := filepath.Join(t.TempDir(), "api.json")
+	botGroupJson := fmt.Sprintf(`{
+  "name": "API",
+  "extends": "%s",
+  "params": {"job": "api"},
+  "states": [
+    {"name": "Traffic", "remove": true},
+    {"name": "Operation", "labels": ["Default", "Problem", "Escalate"]}
+  ],
+  "queries": [
+    {"name": "Errors", "interval": "10s"},
+    {"query_server": "prom", "name": "Latency", "query": "latency{job=\"${param:job}\"}"}
+  ]
+}`, templatePath)
+	assert.Nil(t, os.WriteFile(botGroupPath, []byte(botGroupJson), 0644))
+
+	botGroup, err := LoadBotGroupConfigFile(botGroupPath)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "API", botGroup.Name)
+	assert.Equal(t, botGroupPath, botGroup.ConfigSource)
+	assert.Equal(t, []string{templatePath}, botGroup.TemplatePaths)
+	assert.Equal(t, 0.5, botGroup.ConditionThreshold)
+	assert.Equal(t, "instance", botGroup.BotExtractor.Key)
+
+	assert.Len(t, botGroup.States, 1)
+	assert.Equal(t, []string{"Default", "Problem", "Escalate"}, botGroup.States[0].Labels)
+
+	assert.Len(t, botGroup.Queries, 3)
+	assert.Equal(t, "rate(http_requests{job=\"api\"}[1m])", botGroup.Queries[0].Query)
+	assert.Equal(t, "rate(http_errors{job=\"api\"}[1m])", botGroup.Queries[1].Query)
+	assert.Equal(t, data.Duration(10*time.Second), botGroup.Queries[1].Interval)
+	assert.Equal(t, "Latency", botGroup.Queries[2].Name)
+	assert.Equal(t, "latency{job=\"api\"}", botGroup.Queries[2].Query)
+
+	assert.NotContains(t, botGroup.ResolvedConfig, "${param:")
+	assert.NotContains(t, botGroup.ResolvedConfig, BotGroupTemplateExtendsKey)
+}
+
+func TestLoadSiteBotGroupConfigsInstances(t *testing.T) {
+	templatePath := writeBotGroupTemplate(t)
+
+	site := data.Site{
+		Name: "Test",
+		BotGroupInstances: []map[string]interface{}{
+			{"extends": templatePath, "name": "Checkout", "params": map[string]interface{}{"job": "checkout", "threshold": 0.8}},
+			{"extends": templatePath, "name": "Search", "params": map[string]interface{}{"job": "search"}},
+			{"extends": templatePath, "name": "Broken"},
+		},
+	}
+
+	botGroups, botGroupSources, validationErrors := LoadSiteBotGroupConfigs("site.json", &site)
+
+	assert.Len(t, botGroups, 2)
+	assert.Equal(t, []string{"site.json#bot_group_instances[0]", "site.json#bot_group_instances[1]"}, botGroupSources)
+	assert.Equal(t, 0.8, botGroups[0].ConditionThreshold)
+	assert.Equal(t, "rate(http_requests{job=\"checkout\"}[1m])", botGroups[0].Queries[0].Query)
+	assert.Equal(t, 0.5, botGroups[1].ConditionThreshold)
+	assert.Equal(t, "rate(http_requests{job=\"search\"}[1m])", botGroups[1].Queries[0].Query)
+
+	assert.Len(t, validationErrors, 1)
+	assert.Equal(t, "$.bot_group_instances[2]", validationErrors[0].JsonPath)
+	assert.Equal(t, "Template parameter not set: job  At: $.queries[0].query", validationErrors[0].Message)
+}
+
+func TestLoadSiteConfigFileInstanceSecrets(t *testing.T) {
+	t.Setenv("SIREUS_TEST_JOB", "secret_job")
+	templatePath := writeBotGroupTemplate(t)
+
+	sitePath := filepath.Join(t.TempDir(), "site.json")
+	siteJson := fmt.Sprintf(`{
+  "name": "Test",
+  "bot_group_instances": [{"extends": "%s", "name": "Checkout", "params": {"job": "${SIREUS_TEST_JOB}"}}]
+}`, templatePath)
+	assert.Nil(t, os.WriteFile(sitePath, []byte(siteJson), 0644))
+
+	site, err := LoadSiteConfigFile(sitePath)
+	assert.Nil(t, err)
+
+	botGroups, _, validationErrors := LoadSiteBotGroupConfigs(sitePath, site)
+	assert.Len(t, validationErrors, 0)
+	assert.Equal(t, "rate(http_requests{job=\"secret_job\"}[1m])", botGroups[0].Queries[0].Query)
+	assert.NotContains(t, botGroups[0].ResolvedConfig, "secret_job", "Instances are interpolated after their ResolvedConfig is kept")
+}
+
+func TestResolveBotGroupTemplatesCycle(t *testing.T) {
+	dir := t.TempDir()
+	firstPath := filepath.Join(dir, "first.json")
+	secondPath := filepath.Join(dir, "second.json")
+	assert.Nil(t, os.WriteFile(firstPath, []byte(fmt.Sprintf(`{"extends": "%s"}`, secondPath)), 0644))
+	assert.Nil(t, os.WriteFile(secondPath, []byte(fmt.Sprintf(`{"extends": "%s"}`, firstPath)), 0644))
+
+	_, _, _, err := ResolveBotGroupTemplates(map[string]interface{}{"name": "App", "extends": "first.json"}, dir)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Template extends itself")
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSetLockTimerIsHeld(t *testing.T) {
+	now := time.Now()
+	botGroup := data.BotGroup{
+		Name:       "App",
+		LockTimers: []data.BotLockTimer{{Name: "Restart"}, {Name: "Deploy"}},
+	}
+	condition := data.Condition{Name: "Restart Service", RequiredLockTimers: []string{"Restart"}}
+
+	assert.True(t, AreAllConditionLockTimersAvailable(condition, &botGroup, now))
+
+	SetAllConditionLockTimers(condition, &botGroup, data.Duration(time.Minute), now)
+
+	// The BotGroup's Lock Timer is set, not a copy
+	assert.True(t, botGroup.LockTimers[0].IsActive)
+	assert.Equal(t, now.Add(time.Minute), botGroup.LockTimers[0].Timeout)
+	assert.False(t, botGroup.LockTimers[1].IsActive)
+
+	assert.False(t, AreAllConditionLockTimersAvailable(condition, &botGroup, now))
+	assert.False(t, AreAllConditionLockTimersAvailable(condition, &botGroup, now.Add(30*time.Second)))
+
+	// Once timed out, the BotGroup's Lock Timer is released
+	assert.True(t, AreAllConditionLockTimersAvailable(condition, &botGroup, now.Add(2*time.Minute)))
+	assert.False(t, botGroup.LockTimers[0].IsActive)
+
+	_, err := GetLockTimer(&botGroup, "Missing", now)
+	assert.NotNil(t, err)
+}
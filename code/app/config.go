@@ -1,20 +1,54 @@
 package app
 
 import (
-	"encoding/json"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/util"
-	"os"
 )
 
 // Load the Server config
 func LoadConfig(path string) data.AppConfig {
-	appConfigData, err := os.ReadFile(path)
+	appConfig, err := LoadConfigFile(path)
 	util.CheckPanic(err)
 
+	return appConfig
+}
+
+// Load the Server config, returning read and parse errors, so they can be reported by validation
+func LoadConfigFile(path string) (data.AppConfig, error) {
 	var appConfig data.AppConfig
-	err = json.Unmarshal(appConfigData, &appConfig)
-	util.CheckPanic(err)
+	_, includePaths, err := UnmarshalConfigFileDocument(path, &appConfig)
+	if util.Check(err) {
+		return data.AppConfig{}, err
+	}
 
-	return appConfig
+	appConfig.IncludePaths = includePaths
+
+	return appConfig, nil
+}
+
+// Apply the command line overrides to a loaded AppConfig
+func ApplyConfigOverrides(appConfig *data.AppConfig, overrides data.AppConfigOverrides) {
+	if overrides.WebHttpPort != 0 {
+		appConfig.WebHttpPort = overrides.WebHttpPort
+	}
+	if overrides.PrometheusExportPort != 0 {
+		appConfig.PrometheusExportPort = overrides.PrometheusExportPort
+	}
+	if overrides.DemoApiPort != 0 {
+		appConfig.DemoApiPort = overrides.DemoApiPort
+	}
+	if overrides.DisableDemo {
+		appConfig.EnableDemo = false
+	}
+}
+
+// Returns the paths of all the Site configs.  AppConfig.SiteConfigPath is used if SiteConfigPaths is not set
+func GetSiteConfigPaths(appConfig data.AppConfig) []string {
+	if len(appConfig.SiteConfigPaths) > 0 {
+		return appConfig.SiteConfigPaths
+	}
+	if appConfig.SiteConfigPath != "" {
+		return []string{appConfig.SiteConfigPath}
+	}
+	return []string{}
 }
@@ -0,0 +1,499 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/util"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ConfigIncludeKey = "$include" // An object with this key is replaced by the config file at its path, relative to the including file
+	ConfigIncludeTag = "!include" // YAML tag for an include, ex: "queries: !include queries.yaml"
+	configEscapedVar = "$${"      // Written as "$${" in a config to get a literal "${"
+	configEscapeMark = "\x00{"    // Placeholder for escaped "${" while interpolating, which the interpolation regex does not match
+	configFilePrefix = "file:"    // "${file:/path}" interpolates the file's content
+	configParamName  = "param:"   // "${param:NAME}" is a BotGroup template parameter, and is not interpolated here
+	configVarDefault = ":-"       // "${NAME:-default}" uses the default if the environment variable isn't set
+)
+
+var (
+	// Matches an interpolation in a config string, ex: "${PROM_TOKEN}" or "${file:/run/secrets/prom_token}"
+	configInterpolateRegex = regexp.MustCompile(`\$\{([^}]+)}`)
+)
+
+// Returns true if the config path is YAML, by its extension.  All other configs are JSON
+func IsYamlConfigPath(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".yaml" || extension == ".yml"
+}
+
+// Load a JSON or YAML config file into a struct.  Includes are resolved, and environment variables and files are
+// interpolated, see LoadConfigDocument() and InterpolateConfigDocument().  Loaded configs are normalized through JSON,
+// so YAML uses the same field names as JSON, and both load into the same structs.
+func UnmarshalConfigFile(path string, value interface{}) error {
+	_, _, err := UnmarshalConfigFileDocument(path, value)
+	return err
+}
+
+// Load a JSON or YAML config file into a struct, see UnmarshalConfigFile().  Returns the config document before
+// interpolation, so parts of it can be shown without secrets, and the paths of the files it includes, so they can be
+// watched for changes.
+func UnmarshalConfigFileDocument(path string, value interface{}) (interface{}, []string, error) {
+	document, includePaths, err := LoadConfigDocument(path)
+	if util.Check(err) {
+		return nil, nil, err
+	}
+
+	// JSON configs that don't use includes or interpolation are parsed as written, so errors have their line and column
+	if !IsYamlConfigPath(path) && !isConfigDocumentProcessed(document) {
+		content, err := os.ReadFile(path)
+		if util.Check(err) {
+			return nil, nil, err
+		}
+		return document, includePaths, json.Unmarshal(content, value)
+	}
+
+	interpolated, err := InterpolateConfigDocument(document)
+	if util.Check(err) {
+		return nil, nil, err
+	}
+
+	return document, includePaths, UnmarshalConfigDocument(interpolated, value)
+}
+
+// Unmarshal a config document into a struct.  The document isn't the file as written, so type errors are reported
+// with their JSON path, instead of a line and column.  Interpolation always makes strings, so strings are converted
+// for number and bool fields, ex: "port: ${PROM_PORT}"
+func UnmarshalConfigDocument(document interface{}, value interface{}) error {
+	for {
+		err := json.Unmarshal([]byte(util.PrintJson(document)), value)
+		if !util.Check(err) {
+			return nil
+		}
+
+		var typeError *json.UnmarshalTypeError
+		if !errors.As(err, &typeError) {
+			return err
+		}
+
+		if typeError.Value == "string" && convertConfigDocumentString(document, typeError.Field, typeError.Type.Kind()) {
+			continue
+		}
+
+		return errors.New(fmt.Sprintf("Invalid type in resolved config at %s: expected %s, got JSON %s", getConfigJsonPath(typeError.Field), typeError.Type.String(), typeError.Value))
+	}
+}
+
+// Convert the string at a json.UnmarshalTypeError.Field to a number or bool, in place.  Returns false if it isn't a
+// string that can be converted, so every conversion makes progress
+func convertConfigDocumentString(document interface{}, field string, kind reflect.Kind) bool {
+	parts := strings.Split(field, ".")
+
+	parent := document
+	for _, part := range parts[:len(parts)-1] {
+		switch typedParent := parent.(type) {
+		case map[string]interface{}:
+			parent = typedParent[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(typedParent) {
+				return false
+			}
+			parent = typedParent[index]
+		default:
+			return false
+		}
+	}
+
+	last := parts[len(parts)-1]
+	var text string
+	var ok bool
+	switch typedParent := parent.(type) {
+	case map[string]interface{}:
+		text, ok = typedParent[last].(string)
+	case []interface{}:
+		if index, err := strconv.Atoi(last); err == nil && index >= 0 && index < len(typedParent) {
+			text, ok = typedParent[index].(string)
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	var converted interface{}
+	switch kind {
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return false
+		}
+		converted = boolValue
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+			return false
+		}
+		converted = json.Number(strings.TrimSpace(text))
+	default:
+		return false
+	}
+
+	switch typedParent := parent.(type) {
+	case map[string]interface{}:
+		typedParent[last] = converted
+	case []interface{}:
+		index, _ := strconv.Atoi(last)
+		typedParent[index] = converted
+	}
+
+	return true
+}
+
+// Load a JSON or YAML config file into a document of maps, lists and values, with its includes resolved.  Values are
+// not interpolated yet, so the document can be shown without secrets.
+//
+// An object with an "$include" path is replaced by that file, and in YAML the "!include" tag can be used.  Other keys
+// in the including object override the included object's keys.  An included list in a list is spliced into it.
+// Returns the paths of all the included files, so they can be watched for changes.
+func LoadConfigDocument(path string) (interface{}, []string, error) {
+	includePaths := []string{}
+	document, err := loadConfigDocument(path, []string{}, &includePaths)
+	if util.Check(err) {
+		return nil, nil, err
+	}
+	return document, includePaths, nil
+}
+
+// Load a config document, with includeChain being the files already including it, to detect include loops.  Included
+// files are added to includePaths.
+func loadConfigDocument(path string, includeChain []string, includePaths *[]string) (interface{}, error) {
+	content, err := os.ReadFile(path)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	var document interface{}
+	if IsYamlConfigPath(path) {
+		document, err = parseYamlConfigDocument(content)
+	} else {
+		document, err = parseJsonConfigDocument(content)
+	}
+	if util.Check(err) {
+		return nil, err
+	}
+
+	chain := append(append([]string{}, includeChain...), filepath.Clean(path))
+
+	return resolveConfigIncludes(document, filepath.Dir(path), chain, includePaths)
+}
+
+// Parse a JSON config, keeping numbers as written
+func parseJsonConfigDocument(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var document interface{}
+	err := decoder.Decode(&document)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// Parse a YAML config into the same document as JSON: maps with string keys, lists and values
+func parseYamlConfigDocument(content []byte) (interface{}, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	// An empty file has no document
+	if len(node.Content) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	replaceYamlIncludeTags(&node)
+
+	var document interface{}
+	err = node.Decode(&document)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return normalizeYamlConfigValue(document), nil
+}
+
+// Replace every "!include path" with {"$include": path}, so includes are resolved the same for JSON and YAML
+func replaceYamlIncludeTags(node *yaml.Node) {
+	if node.Tag == ConfigIncludeTag && node.Kind == yaml.ScalarNode {
+		path := node.Value
+		*node = yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: ConfigIncludeKey},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: path},
+			},
+		}
+		return
+	}
+
+	for _, child := range node.Content {
+		replaceYamlIncludeTags(child)
+	}
+}
+
+// YAML maps can have non-string keys, which JSON can't, so keys are formatted as strings
+func normalizeYamlConfigValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typedValue {
+			typedValue[key] = normalizeYamlConfigValue(item)
+		}
+		return typedValue
+
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for key, item := range typedValue {
+			result[fmt.Sprint(key)] = normalizeYamlConfigValue(item)
+		}
+		return result
+
+	case []interface{}:
+		for index, item := range typedValue {
+			typedValue[index] = normalizeYamlConfigValue(item)
+		}
+		return typedValue
+
+	default:
+		return value
+	}
+}
+
+// Replace every include in the document with the included file.  Include paths are relative to baseDir
+func resolveConfigIncludes(value interface{}, baseDir string, includeChain []string, includePaths *[]string) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if include, found := typedValue[ConfigIncludeKey]; found {
+			return resolveConfigInclude(typedValue, include, baseDir, includeChain, includePaths)
+		}
+
+		result := make(map[string]interface{})
+		for key, item := range typedValue {
+			resolved, err := resolveConfigIncludes(item, baseDir, includeChain, includePaths)
+			if util.Check(err) {
+				return nil, err
+			}
+			result[key] = resolved
+		}
+		return result, nil
+
+	case []interface{}:
+		var result []interface{}
+		for _, item := range typedValue {
+			resolved, err := resolveConfigIncludes(item, baseDir, includeChain, includePaths)
+			if util.Check(err) {
+				return nil, err
+			}
+
+			// Included lists are spliced in, so lists of Queries or Conditions can be shared
+			if itemMap, ok := item.(map[string]interface{}); ok && itemMap[ConfigIncludeKey] != nil {
+				if resolvedList, ok := resolved.([]interface{}); ok {
+					result = append(result, resolvedList...)
+					continue
+				}
+			}
+			result = append(result, resolved)
+		}
+		if result == nil {
+			result = []interface{}{}
+		}
+		return result, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// Load an included file, and override its keys with the other keys of the including object
+func resolveConfigInclude(includeObject map[string]interface{}, include interface{}, baseDir string, includeChain []string, includePaths *[]string) (interface{}, error) {
+	includePath, ok := include.(string)
+	if !ok || includePath == "" {
+		return nil, errors.New(fmt.Sprintf("Config \"%s\" must be a path", ConfigIncludeKey))
+	}
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(baseDir, includePath)
+	}
+	includePath = filepath.Clean(includePath)
+
+	if util.StringInSlice(includeChain, includePath) {
+		return nil, errors.New(fmt.Sprintf("Config includes itself: %s -> %s", strings.Join(includeChain, " -> "), includePath))
+	}
+
+	if !util.StringInSlice(*includePaths, includePath) {
+		*includePaths = append(*includePaths, includePath)
+	}
+
+	included, err := loadConfigDocument(includePath, includeChain, includePaths)
+	if util.Check(err) {
+		return nil, errors.New(fmt.Sprintf("Config include could not be loaded: %s", GetConfigParseError(includePath, err).String()))
+	}
+
+	if len(includeObject) == 1 {
+		return included, nil
+	}
+
+	includedMap, ok := included.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Config include has other keys, but isn't an object: %s", includePath))
+	}
+
+	result := make(map[string]interface{})
+	for key, item := range includedMap {
+		result[key] = item
+	}
+	for key, item := range includeObject {
+		if key == ConfigIncludeKey {
+			continue
+		}
+		resolved, err := resolveConfigIncludes(item, baseDir, includeChain, includePaths)
+		if util.Check(err) {
+			return nil, err
+		}
+		result[key] = resolved
+	}
+
+	return result, nil
+}
+
+// Interpolate environment variables and files into every string in a config document, so secrets like
+// QueryServer.AuthSecret don't have to be in the config:
+//
+//	"${NAME}": The environment variable.  It is an error if it isn't set
+//	"${NAME:-default}": The environment variable, or the default if it isn't set
+//	"${file:path}": The file's content, without the trailing newline.  Relative paths are from the working directory
+//
+// "$${" is a literal "${".  BotGroup template parameters, "${param:NAME}", are left for the templates.
+func InterpolateConfigDocument(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for key, item := range typedValue {
+			interpolated, err := InterpolateConfigDocument(item)
+			if util.Check(err) {
+				return nil, err
+			}
+			result[key] = interpolated
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(typedValue))
+		for index, item := range typedValue {
+			interpolated, err := InterpolateConfigDocument(item)
+			if util.Check(err) {
+				return nil, err
+			}
+			result[index] = interpolated
+		}
+		return result, nil
+
+	case string:
+		return interpolateConfigString(typedValue)
+
+	default:
+		return value, nil
+	}
+}
+
+// Interpolate a single config string
+func interpolateConfigString(text string) (string, error) {
+	text = strings.ReplaceAll(text, configEscapedVar, configEscapeMark)
+
+	var interpolateErr error
+	result := configInterpolateRegex.ReplaceAllStringFunc(text, func(match string) string {
+		name := configInterpolateRegex.FindStringSubmatch(match)[1]
+
+		if strings.HasPrefix(name, configParamName) {
+			return match
+		}
+
+		if strings.HasPrefix(name, configFilePrefix) {
+			path := strings.TrimPrefix(name, configFilePrefix)
+			content, err := os.ReadFile(path)
+			if util.Check(err) {
+				interpolateErr = errors.New(fmt.Sprintf("Config interpolation file could not be read: %s  Error: %s", path, err.Error()))
+				return match
+			}
+			return strings.TrimRight(string(content), "\r\n")
+		}
+
+		defaultValue := ""
+		hasDefault := false
+		if index := strings.Index(name, configVarDefault); index != -1 {
+			defaultValue = name[index+len(configVarDefault):]
+			name = name[:index]
+			hasDefault = true
+		}
+
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			if !hasDefault {
+				interpolateErr = errors.New(fmt.Sprintf("Config interpolation environment variable is not set: %s", name))
+			}
+			return defaultValue
+		}
+		return envValue
+	})
+	if interpolateErr != nil {
+		return "", interpolateErr
+	}
+
+	return strings.ReplaceAll(result, configEscapeMark, "${"), nil
+}
+
+// Returns true if the document uses includes or interpolation, so it isn't the same as the file as written
+func isConfigDocumentProcessed(value interface{}) bool {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		if _, found := typedValue[ConfigIncludeKey]; found {
+			return true
+		}
+		for _, item := range typedValue {
+			if isConfigDocumentProcessed(item) {
+				return true
+			}
+		}
+
+	case []interface{}:
+		for _, item := range typedValue {
+			if isConfigDocumentProcessed(item) {
+				return true
+			}
+		}
+
+	case string:
+		if strings.Contains(typedValue, configEscapedVar) {
+			return true
+		}
+		for _, match := range configInterpolateRegex.FindAllStringSubmatch(typedValue, -1) {
+			if !strings.HasPrefix(match[1], configParamName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes config files into a temp dir, key is the file name, and returns the dir
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestUnmarshalConfigFileYaml(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"bot_group.json": `{
+  "name": "App",
+  "bot_timeout_stale": 60,
+  "queries": [{"query_server": "prom", "name": "Requests", "query": "up", "interval": "5s"}],
+  "actions": [{"name": "Fix", "weight": 2, "considerations": [{"name": "Load", "evaluate": "requests > 5"}]}]
+}`,
+		"bot_group.yaml": `
+name: App
+bot_timeout_stale: 60
+queries:
+  - query_server: prom
+    name: Requests
+    query: up
+    interval: 5s
+actions:
+  # Long expressions and comments are easier to keep in YAML
+  - name: Fix
+    weight: 2
+    considerations:
+      - name: Load
+        evaluate: >-
+          requests > 5
+`,
+	})
+
+	var jsonBotGroup data.BotGroup
+	assert.Nil(t, UnmarshalConfigFile(filepath.Join(dir, "bot_group.json"), &jsonBotGroup))
+
+	var yamlBotGroup data.BotGroup
+	assert.Nil(t, UnmarshalConfigFile(filepath.Join(dir, "bot_group.yaml"), &yamlBotGroup))
+
+	assert.Equal(t, jsonBotGroup, yamlBotGroup)
+	assert.Equal(t, data.Duration(5*time.Second), yamlBotGroup.Queries[0].Interval)
+	assert.Equal(t, "requests > 5", yamlBotGroup.Conditions[0].Considerations[0].Evaluate)
+}
+
+func TestUnmarshalConfigFileIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"site.yaml": `
+name: Production
+bot_group_paths: !include bot_group_paths.json
+query_servers:
+  - $include: query_server.yaml
+    name: prometheus_primary
+  - !include query_servers_more.yaml
+`,
+		"bot_group_paths.json": `["app.json", "database.json"]`,
+		"query_server.yaml":    "name: base\nhost: prometheus.internal\nport: 9090\n",
+		"query_servers_more.yaml": `
+- name: prometheus_secondary
+  host: prometheus-2.internal
+- name: prometheus_tertiary
+  host: prometheus-3.internal
+`,
+	})
+
+	site, err := LoadSiteConfigFile(filepath.Join(dir, "site.yaml"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"app.json", "database.json"}, site.BotGroupPaths)
+	assert.Len(t, site.QueryServers, 3)
+	assert.Equal(t, "prometheus_primary", site.QueryServers[0].Name)
+	assert.Equal(t, "prometheus.internal", site.QueryServers[0].Host)
+	assert.Equal(t, 9090, site.QueryServers[0].Port)
+	assert.Equal(t, "prometheus_tertiary", site.QueryServers[2].Name)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "bot_group_paths.json"),
+		filepath.Join(dir, "query_server.yaml"),
+		filepath.Join(dir, "query_servers_more.yaml"),
+	}, site.IncludePaths, "Included files are watched for reloads")
+
+	dir = writeConfigFiles(t, map[string]string{
+		"first.json":  `{"$include": "second.json"}`,
+		"second.json": `{"$include": "first.json"}`,
+	})
+	_, err = LoadSiteConfigFile(filepath.Join(dir, "first.json"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Config includes itself")
+}
+
+func TestUnmarshalConfigFileInterpolation(t *testing.T) {
+	t.Setenv("SIREUS_TEST_PROM_HOST", "prometheus.internal")
+	t.Setenv("SIREUS_TEST_PROM_PORT", "9091")
+	dir := writeConfigFiles(t, map[string]string{
+		"prom_token": "secret-token\n",
+	})
+	dir = writeConfigFiles(t, map[string]string{
+		"site.json": `{
+  "name": "Production",
+  "info": "Costs $${HOME} to query ${SIREUS_TEST_MISSING:-nothing}",
+  "query_servers": [{"name": "prom", "host": "${SIREUS_TEST_PROM_HOST}", "port": "${SIREUS_TEST_PROM_PORT}", "auth_secret": "${file:` + filepath.Join(dir, "prom_token") + `}"}],
+  "bot_group_instances": [{"name": "App", "params": {"job": "app"}, "info": "${param:job}"}]
+}`,
+		"missing.json": `{"name": "${SIREUS_TEST_MISSING}"}`,
+	})
+
+	site, err := LoadSiteConfigFile(filepath.Join(dir, "site.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Costs ${HOME} to query nothing", site.Info)
+	assert.Equal(t, "prometheus.internal", site.QueryServers[0].Host)
+	assert.Equal(t, 9091, site.QueryServers[0].Port)
+	assert.Equal(t, "secret-token", site.QueryServers[0].AuthSecret)
+	assert.Equal(t, "${param:job}", site.BotGroupInstances[0]["info"])
+
+	_, err = LoadSiteConfigFile(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "Config interpolation environment variable is not set: SIREUS_TEST_MISSING", err.Error())
+}
+
+func TestGetConfigParseErrorProcessed(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"site.yaml": "name: Production\nquery_servers:\n  - name: prom\n    port: nine\n",
+	})
+
+	_, err := LoadSiteConfigFile(filepath.Join(dir, "site.yaml"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Invalid type in resolved config at $.query_servers[0].port")
+}
@@ -1,12 +1,14 @@
 package app
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/util"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 type (
@@ -38,14 +40,11 @@ func GetCurve(name string) (CurveData, error) {
 
 // Load the Curve data off the disk
 func LoadCurveData(name string) (CurveData, error) {
-	path := fmt.Sprintf(data.SireusData.AppConfig.CurvePathFormat, name)
-
-	curveDataInput, err := os.ReadFile(path)
-	util.CheckLog(err)
+	path := GetCurvePath(data.SireusData.AppConfig, name)
 
 	var curveData CurveData
-	err = json.Unmarshal(curveDataInput, &curveData)
-	if util.Check(err) {
+	err := UnmarshalConfigFile(path, &curveData)
+	if util.CheckLog(err) {
 		return CurveData{}, errors.New(fmt.Sprintf("Couldnt find curve: %s", name))
 	}
 
@@ -54,6 +53,24 @@ func LoadCurveData(name string) (CurveData, error) {
 	return curveData, nil
 }
 
+// Returns the path of a Curve's file, from AppConfig.CurvePathFormat.  If that file doesn't exist, a YAML file with
+// the same name is used, so Curves can be JSON or YAML
+func GetCurvePath(appConfig data.AppConfig, name string) string {
+	path := fmt.Sprintf(appConfig.CurvePathFormat, name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	basePath := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, extension := range []string{".yaml", ".yml"} {
+		if _, err := os.Stat(basePath + extension); err == nil {
+			return basePath + extension
+		}
+	}
+
+	return path
+}
+
 // Get all X axis values, which is just the step from 0-1 at 0.1 intervals
 func GetCurveDataX(curveData CurveData) []float64 {
 	var xArray []float64
@@ -77,3 +94,43 @@ func GetCurveValue(curveData CurveData, x float64) float64 {
 
 	return curveData.Values[len(curveData.Values)-1]
 }
+
+// Returns a text plot of the curve for a terminal, width columns by height rows, with the Y axis labelled.  Each
+// column is the curve value at its X position, and the row for that value is marked with "*"
+func GetCurvePlotText(curveData CurveData, width int, height int) string {
+	if width < 2 {
+		width = 2
+	}
+	if height < 2 {
+		height = 2
+	}
+
+	minY, maxY := 0.0, 1.0
+	for _, value := range curveData.Values {
+		minY = math.Min(minY, value)
+		maxY = math.Max(maxY, value)
+	}
+
+	rows := make([][]rune, height)
+	for row := range rows {
+		rows[row] = []rune(strings.Repeat(" ", width))
+	}
+
+	for column := 0; column < width; column++ {
+		x := float64(column) / float64(width-1)
+		y := GetCurveValue(curveData, x)
+		row := int(math.Round((maxY - y) / (maxY - minY) * float64(height-1)))
+		rows[row][column] = '*'
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%s\n", curveData.Name))
+	for row := range rows {
+		y := maxY - float64(row)/float64(height-1)*(maxY-minY)
+		builder.WriteString(fmt.Sprintf("%5.2f |%s\n", y, string(rows[row])))
+	}
+	builder.WriteString(fmt.Sprintf("      +%s\n", strings.Repeat("-", width)))
+	builder.WriteString(fmt.Sprintf("       0%s1\n", strings.Repeat(" ", width-2)))
+
+	return builder.String()
+}
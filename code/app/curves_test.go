@@ -1,13 +1,23 @@
 package app
 
 import (
+	"github.com/ghowland/sireus/code/data"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
 	"testing"
 )
 
 // NOTE(ghowland): Have to go back 2 directories here, and also in the config data, so need a separate config
 var testAppConfigPath = "../../config/test_config.json"
 
+// Curves and other configs are loaded using the global AppConfig paths, so set it up for all the tests
+func TestMain(m *testing.M) {
+	data.SireusData.AppConfig = LoadConfig(testAppConfigPath)
+
+	os.Exit(m.Run())
+}
+
 func TestSomething(t *testing.T) {
 	appConfig := LoadConfig(testAppConfigPath)
 
@@ -19,3 +29,18 @@ func TestSomething(t *testing.T) {
 	assert.Equal(t, curve_data.Values[0], float64(0), "First value of this curve should be 0")
 
 }
+
+func TestGetCurvePlotText(t *testing.T) {
+	curveData := CurveData{Name: "linear"}
+	for i := 0; i <= 100; i++ {
+		curveData.Values = append(curveData.Values, float64(i)*0.01)
+	}
+
+	plot := GetCurvePlotText(curveData, 11, 11)
+	lines := strings.Split(strings.TrimRight(plot, "\n"), "\n")
+
+	assert.Equal(t, "linear", lines[0], "Title is the curve name")
+	assert.Equal(t, 11+3, len(lines), "Title, rows, axis and labels")
+	assert.Equal(t, " 1.00 |          *", lines[1], "Top row is the end of the curve")
+	assert.Equal(t, " 0.00 |*          ", lines[11], "Bottom row is the start of the curve")
+}
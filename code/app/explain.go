@@ -0,0 +1,101 @@
+package app
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"time"
+)
+
+// Returns the ConditionGates that decide if a Condition is Available: score threshold, available window, required
+// States and Lock Timers.  isAvailable is the state before this evaluation, which selects the threshold used.
+func GetConditionAvailableGates(condition data.Condition, isAvailable bool, finalScore float64, isOverThreshold bool, isWindowMet bool, allStatesActive bool, allLockTimersAvailable bool) []data.ConditionGate {
+	threshold := condition.WeightThreshold
+	thresholdName := "Weight Threshold"
+	if isAvailable && condition.WeightThresholdExit != 0 {
+		threshold = condition.WeightThresholdExit
+		thresholdName = "Weight Threshold Exit"
+	}
+
+	gates := []data.ConditionGate{
+		{
+			Name:   thresholdName,
+			Passed: isOverThreshold,
+			Info:   fmt.Sprintf("Final Score %.2f >= %.2f", finalScore, threshold),
+		},
+		{
+			Name:   "Required States",
+			Passed: allStatesActive,
+			Info:   util.PrintStringArrayCSV(condition.RequiredStates),
+		},
+		{
+			Name:   "Required Lock Timers",
+			Passed: allLockTimersAvailable,
+			Info:   util.PrintStringArrayCSV(condition.RequiredLockTimers),
+		},
+	}
+
+	if condition.AvailableWindowRequired > 0 {
+		gates = append(gates, data.ConditionGate{
+			Name:   "Available Window",
+			Passed: isWindowMet,
+			Info:   fmt.Sprintf("Over threshold in %d of the last %d evaluations", condition.AvailableWindowRequired, condition.AvailableWindowSize),
+		})
+	}
+
+	return gates
+}
+
+// Returns the ConditionGates checked when executing an Available Condition: the Bot is valid, the BotGroup Condition
+// threshold, the repeat delay since it last executed, and how long it has been Available
+func GetConditionExecuteGates(session *data.InteractiveSession, botGroup *data.BotGroup, bot *data.Bot, condition data.Condition, conditionData data.BotConditionData) []data.ConditionGate {
+	gates := []data.ConditionGate{
+		{
+			Name:   "Bot Valid",
+			Passed: !bot.IsInvalid,
+			Info:   bot.InfoInvalid,
+		},
+		{
+			Name:   "Bot Group Condition Threshold",
+			Passed: conditionData.FinalScore > botGroup.ConditionThreshold,
+			Info:   fmt.Sprintf("Final Score %.2f > %.2f", conditionData.FinalScore, botGroup.ConditionThreshold),
+		},
+	}
+
+	// Repeat delay, only if this Condition executed recently
+	repeatGate := data.ConditionGate{Name: "Execute Repeat Delay", Passed: true, Info: fmt.Sprintf("Delay: %s", time.Duration(condition.ExecuteRepeatDelay).String())}
+	lastExecuteTime, err := GetConditionLastExecuteTime(session, botGroup, bot, condition, condition.ExecuteRepeatDelay)
+	if err == nil {
+		remaining := time.Duration(condition.ExecuteRepeatDelay) - GetSessionTimeNow(session).Sub(lastExecuteTime)
+		if remaining > 0 {
+			repeatGate.Passed = false
+			repeatGate.RemainingSeconds = remaining.Seconds()
+		}
+	}
+	gates = append(gates, repeatGate)
+
+	// Required Available, the full duration remains if not Available yet
+	availableGate := data.ConditionGate{Name: "Required Available", Info: fmt.Sprintf("Required: %s", time.Duration(condition.RequiredAvailable).String())}
+	remaining := time.Duration(condition.RequiredAvailable)
+	if conditionData.IsAvailable {
+		remaining -= GetSessionTimeNow(session).Sub(conditionData.AvailableStartTime)
+	}
+	if conditionData.IsAvailable && remaining < 0 {
+		availableGate.Passed = true
+	} else {
+		availableGate.RemainingSeconds = remaining.Seconds()
+	}
+	gates = append(gates, availableGate)
+
+	return gates
+}
+
+// Returns true if all the ConditionGates passed
+func AreAllConditionGatesPassed(gates []data.ConditionGate) bool {
+	for _, gate := range gates {
+		if !gate.Passed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,376 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Name of the evaluation parameter that holds the ExpressionContext.  Functions that need to know about the Bot
+	// get this passed in as their first argument, by rewriting the expression when it is compiled.  It is escaped in
+	// brackets when rewritten, because govaluate variable names can't start with "_"
+	ExpressionContextName = "__sireus"
+)
+
+var (
+	// Functions which get the ExpressionContext inserted as their first argument, ex: has("x") -> has([__sireus], "x")
+	expressionContextFunctionRegex = regexp.MustCompile(`\b(has|in_state|family_min|family_max|family_sum|family_avg|family_count)\s*\(`)
+)
+
+type (
+	// ExpressionContext is passed into the expression functions that need access to the Bot being evaluated
+	ExpressionContext struct {
+		Values   map[string]interface{} // The evaluation map for this Bot
+		States   []string               // Bot.StateValues
+		BotGroup *data.BotGroup         // The Bot's BotGroup, so Variable Family reducers only use their family's members.  Can be nil
+	}
+)
+
+// Compile an expression with the Sireus function library.  Compile once and Evaluate many times
+func CompileExpression(expression string) (*govaluate.EvaluableExpression, error) {
+	// Variable Family reducers become functions which need the ExpressionContext, so they are rewritten first
+	rewritten := RewriteVariableFamilyReducers(expression)
+	rewritten = expressionContextFunctionRegex.ReplaceAllString(rewritten, fmt.Sprintf("${1}([%s], ", ExpressionContextName))
+
+	// Functions with no arguments would have a dangling separator, ex: has([__sireus], )
+	rewritten = strings.Replace(rewritten, fmt.Sprintf("[%s], )", ExpressionContextName), fmt.Sprintf("[%s])", ExpressionContextName), -1)
+
+	return govaluate.NewEvaluableExpressionWithFunctions(rewritten, GetExpressionFunctions())
+}
+
+// Compile all the Variable and Consideration expressions in a BotGroup, and cache them in BotGroup.CompiledExpressions.
+// Returns an error describing every expression that failed, so they can all be fixed at once.
+func CompileBotGroupExpressions(botGroup *data.BotGroup) error {
+	botGroup.CompiledExpressions = make(map[string]*govaluate.EvaluableExpression)
+
+	var errorMessages []string
+
+	for _, variable := range botGroup.Variables {
+		if len(variable.Evaluate) == 0 {
+			continue
+		}
+
+		err := compileBotGroupExpression(botGroup, variable.Evaluate)
+		if !util.Check(err) {
+			err = ValidateVariableFamilyReducers(botGroup, variable.Evaluate)
+		}
+		if util.Check(err) {
+			errorMessages = append(errorMessages, fmt.Sprintf("Bot Group: %s  Variable: %s  Evaluate: %s  Error: %s", botGroup.Name, variable.Name, variable.Evaluate, err.Error()))
+		}
+	}
+
+	for _, condition := range botGroup.Conditions {
+		for _, consider := range condition.Considerations {
+			err := compileBotGroupExpression(botGroup, consider.Evaluate)
+			if !util.Check(err) {
+				err = ValidateVariableFamilyReducers(botGroup, consider.Evaluate)
+			}
+			if util.Check(err) {
+				errorMessages = append(errorMessages, fmt.Sprintf("Bot Group: %s  Condition: %s  Consideration: %s  Evaluate: %s  Error: %s", botGroup.Name, condition.Name, consider.Name, consider.Evaluate, err.Error()))
+			}
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		return errors.New(strings.Join(errorMessages, "\n"))
+	}
+
+	return nil
+}
+
+// Compile an expression into the BotGroup.CompiledExpressions cache, if it isn't already there
+func compileBotGroupExpression(botGroup *data.BotGroup, expression string) error {
+	if _, ok := botGroup.CompiledExpressions[expression]; ok {
+		return nil
+	}
+
+	compiled, err := CompileExpression(expression)
+	if util.Check(err) {
+		return err
+	}
+
+	botGroup.CompiledExpressions[expression] = compiled
+	return nil
+}
+
+// Returns the compiled expression from the BotGroup cache.  If it isn't cached, it is compiled but not cached, because
+// the BotGroup is shared between goroutines and the cache is only written at config load
+func GetBotGroupExpression(botGroup *data.BotGroup, expression string) (*govaluate.EvaluableExpression, error) {
+	compiled, ok := botGroup.CompiledExpressions[expression]
+	if ok {
+		return compiled, nil
+	}
+
+	return CompileExpression(expression)
+}
+
+// Adds the ExpressionContext for this Bot into the evaluation map.  Call after all the values are in the map.
+func AddExpressionContext(evalMap map[string]interface{}, botGroup *data.BotGroup, bot *data.Bot) {
+	evalMap[ExpressionContextName] = ExpressionContext{
+		Values:   evalMap,
+		States:   bot.StateValues,
+		BotGroup: botGroup,
+	}
+}
+
+// Returns the function library available to all Sireus expressions
+func GetExpressionFunctions() map[string]govaluate.ExpressionFunction {
+	functions := map[string]govaluate.ExpressionFunction{
+		// min(a, b, ...) returns the smallest value
+		"min": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgs("min", args, 1)
+			if util.Check(err) {
+				return nil, err
+			}
+			result := values[0]
+			for _, value := range values[1:] {
+				result = math.Min(result, value)
+			}
+			return result, nil
+		},
+		// max(a, b, ...) returns the largest value
+		"max": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgs("max", args, 1)
+			if util.Check(err) {
+				return nil, err
+			}
+			result := values[0]
+			for _, value := range values[1:] {
+				result = math.Max(result, value)
+			}
+			return result, nil
+		},
+		// abs(a) returns the absolute value
+		"abs": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgsExact("abs", args, 1)
+			if util.Check(err) {
+				return nil, err
+			}
+			return math.Abs(values[0]), nil
+		},
+		// clamp(value, min, max) returns the value between min and max
+		"clamp": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgsExact("clamp", args, 3)
+			if util.Check(err) {
+				return nil, err
+			}
+			return util.Clamp(values[0], values[1], values[2]), nil
+		},
+		// log(a) returns the natural logarithm
+		"log": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgsExact("log", args, 1)
+			if util.Check(err) {
+				return nil, err
+			}
+			return math.Log(values[0]), nil
+		},
+		// pow(base, exponent)
+		"pow": func(args ...interface{}) (interface{}, error) {
+			values, err := getExpressionFloatArgsExact("pow", args, 2)
+			if util.Check(err) {
+				return nil, err
+			}
+			return math.Pow(values[0], values[1]), nil
+		},
+		// if(test, then, else) returns then if the test is true or non-zero
+		"if": func(args ...interface{}) (interface{}, error) {
+			if len(args) != 3 {
+				return nil, errors.New(fmt.Sprintf("if() requires 3 arguments, got: %d", len(args)))
+			}
+			test, err := getExpressionTruth(args[0])
+			if util.Check(err) {
+				return nil, err
+			}
+			if test {
+				return args[1], nil
+			}
+			return args[2], nil
+		},
+		// coalesce(a, b, ...) returns the first value that is a number, and not NaN
+		"coalesce": func(args ...interface{}) (interface{}, error) {
+			for _, arg := range args {
+				value, err := util.ConvertInterfaceToFloat(arg)
+				if !util.Check(err) && !math.IsNaN(value) {
+					return value, nil
+				}
+			}
+			return nil, errors.New("coalesce() has no valid values")
+		},
+		// has("name") returns true if the Bot has this variable.  Rewritten to get the ExpressionContext first
+		"has": func(args ...interface{}) (interface{}, error) {
+			context, names, err := getExpressionContextArgs("has", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			_, ok := context.Values[names[0]]
+			return ok, nil
+		},
+		// in_state("(State.Name).(Label)") returns true if the Bot has this State.  "(BotGroup.Name):(State.Name).(Label)"
+		// tests if any Bot in a BotGroup.DependsOn BotGroup has this State.  Rewritten to get the ExpressionContext first
+		"in_state": func(args ...interface{}) (interface{}, error) {
+			context, names, err := getExpressionContextArgs("in_state", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			stateBotGroupName, state, _ := ParseRequiredState(names[0])
+			if stateBotGroupName == "" {
+				return util.StringInSlice(context.States, state), nil
+			}
+			count, err := util.ConvertInterfaceToFloat(context.Values[fmt.Sprintf("%s.%s", stateBotGroupName, state)])
+			if util.Check(err) {
+				return nil, errors.New(fmt.Sprintf("in_state() Bot Group is not in depends_on, or State is missing: %s", names[0]))
+			}
+			return count > 0, nil
+		},
+	}
+
+	for name, function := range GetVariableFamilyFunctions() {
+		functions[name] = function
+	}
+
+	return functions
+}
+
+// Converts all the expression function arguments to floats, requiring a minimum number of them
+func getExpressionFloatArgs(name string, args []interface{}, minimum int) ([]float64, error) {
+	if len(args) < minimum {
+		return nil, errors.New(fmt.Sprintf("%s() requires at least %d arguments, got: %d", name, minimum, len(args)))
+	}
+
+	var values []float64
+	for index, arg := range args {
+		value, err := util.ConvertInterfaceToFloat(arg)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("%s() argument %d is not a number: %v", name, index+1, arg))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Converts all the expression function arguments to floats, requiring an exact number of them
+func getExpressionFloatArgsExact(name string, args []interface{}, count int) ([]float64, error) {
+	if len(args) != count {
+		return nil, errors.New(fmt.Sprintf("%s() requires %d arguments, got: %d", name, count, len(args)))
+	}
+	return getExpressionFloatArgs(name, args, count)
+}
+
+// Returns the ExpressionContext and string arguments, for functions that were rewritten to get the context first
+func getExpressionContextArgs(name string, args []interface{}) (ExpressionContext, []string, error) {
+	if len(args) != 2 {
+		return ExpressionContext{}, nil, errors.New(fmt.Sprintf("%s() requires 1 argument, got: %d", name, len(args)-1))
+	}
+
+	context, ok := args[0].(ExpressionContext)
+	if !ok {
+		return ExpressionContext{}, nil, errors.New(fmt.Sprintf("%s() is missing the expression context", name))
+	}
+
+	value, ok := args[1].(string)
+	if !ok {
+		return ExpressionContext{}, nil, errors.New(fmt.Sprintf("%s() argument must be a quoted string: %v", name, args[1]))
+	}
+
+	return context, []string{value}, nil
+}
+
+// Boolean test of an expression value.  Numbers are true if they are non-zero
+func getExpressionTruth(arg interface{}) (bool, error) {
+	if test, ok := arg.(bool); ok {
+		return test, nil
+	}
+
+	value, err := util.ConvertInterfaceToFloat(arg)
+	if util.Check(err) {
+		return false, errors.New(fmt.Sprintf("Value is not a boolean or number: %v", arg))
+	}
+	return value != 0, nil
+}
+
+// Returns the variable names an expression references, without the internal ExpressionContext
+func GetExpressionVariableNames(expression *govaluate.EvaluableExpression) []string {
+	var names []string
+	for _, name := range expression.Vars() {
+		if name != ExpressionContextName && !util.StringInSlice(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the Synthetic Variable names in the order they must be evaluated, so any Synthetic Variable that references
+// another is evaluated after it.  Synthetic Variables without references keep their config order.  Returns an error
+// if the references create a cycle.  Expressions must already be compiled with CompileBotGroupExpressions()
+func GetSyntheticVariableOrder(botGroup *data.BotGroup) ([]string, error) {
+	// Collect the Synthetic Variables and which other Synthetic Variables they reference
+	var syntheticNames []string
+	references := make(map[string][]string)
+
+	for _, variable := range botGroup.Variables {
+		if len(variable.Evaluate) > 0 {
+			syntheticNames = append(syntheticNames, variable.Name)
+		}
+	}
+
+	for _, variable := range botGroup.Variables {
+		if len(variable.Evaluate) == 0 {
+			continue
+		}
+
+		expression, err := GetBotGroupExpression(botGroup, variable.Evaluate)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Bot Group: %s  Variable: %s  Evaluate: %s  Error: %s", botGroup.Name, variable.Name, variable.Evaluate, err.Error()))
+		}
+
+		for _, name := range GetExpressionVariableNames(expression) {
+			if util.StringInSlice(syntheticNames, name) {
+				references[variable.Name] = append(references[variable.Name], name)
+			}
+		}
+	}
+
+	var order []string
+
+	// Each pass takes the first Synthetic Variable in config order that has all of its references already ordered
+	for len(order) < len(syntheticNames) {
+		found := false
+		for _, name := range syntheticNames {
+			if util.StringInSlice(order, name) {
+				continue
+			}
+
+			isReady := true
+			for _, reference := range references[name] {
+				if !util.StringInSlice(order, reference) {
+					isReady = false
+					break
+				}
+			}
+
+			if isReady {
+				order = append(order, name)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			var cycle []string
+			for _, name := range syntheticNames {
+				if !util.StringInSlice(order, name) {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, errors.New(fmt.Sprintf("Bot Group: %s  Synthetic Variable reference cycle between: %s", botGroup.Name, util.PrintStringArrayCSV(cycle)))
+		}
+	}
+
+	return order, nil
+}
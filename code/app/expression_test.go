@@ -0,0 +1,76 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpressionFunctions(t *testing.T) {
+	bot := data.Bot{StateValues: []string{"Operation.Problem"}}
+
+	tests := map[string]interface{}{
+		"max(a, b, 3)":                             5.0,
+		"min(a, b)":                                2.0,
+		"clamp(b, 0, 1)":                           1.0,
+		"if(a > 1, 10, 20)":                        10.0,
+		"has(\"a\") && !has(\"missing\")":          true,
+		"in_state(\"Operation.Problem\")":          true,
+		"in_state(\"Database:Operation.Problem\")": true,
+		"pow(2, 3) + abs(-1) + log(1)":             9.0,
+		"coalesce(a, 5)":                           2.0,
+		"[Database.Operation.Problem] + 1":         2.0,
+	}
+
+	for expressionText, expected := range tests {
+		expression, err := CompileExpression(expressionText)
+		assert.Nil(t, err, "Expression should compile: %s", expressionText)
+
+		evalMap := map[string]interface{}{"a": 2.0, "b": 5.0, "Database.Operation.Problem": 1.0}
+		AddExpressionContext(evalMap, nil, &bot)
+
+		result, err := expression.Evaluate(evalMap)
+		assert.Nil(t, err, "Expression should evaluate: %s", expressionText)
+		assert.Equal(t, expected, result, "Expression result: %s", expressionText)
+	}
+}
+
+func TestCompileBotGroupExpressionsErrors(t *testing.T) {
+	botGroup := data.BotGroup{
+		Name: "Test",
+		Conditions: []data.Condition{
+			{Name: "Bad", Considerations: []data.ConditionConsideration{{Name: "Unclosed", Evaluate: "max(a, b"}}},
+		},
+	}
+
+	err := CompileBotGroupExpressions(&botGroup)
+	assert.NotNil(t, err, "Bad expressions are reported as config errors")
+}
+
+func TestSyntheticVariableOrder(t *testing.T) {
+	botGroup := data.BotGroup{
+		Name: "Test",
+		Variables: []data.BotVariable{
+			{Name: "ratio", Evaluate: "total / max(count, 1)"},
+			{Name: "total", Evaluate: "a + b"},
+			{Name: "a"},
+			{Name: "b"},
+			{Name: "count"},
+		},
+	}
+
+	err := CompileBotGroupExpressions(&botGroup)
+	assert.Nil(t, err, "Expressions compile")
+
+	order, err := GetSyntheticVariableOrder(&botGroup)
+	assert.Nil(t, err, "No cycle")
+	assert.Equal(t, []string{"total", "ratio"}, order, "Referenced Synthetic Variables are evaluated first")
+
+	// Make a cycle
+	botGroup.Variables[1].Evaluate = "a + ratio"
+	err = CompileBotGroupExpressions(&botGroup)
+	assert.Nil(t, err, "Expressions compile")
+
+	_, err = GetSyntheticVariableOrder(&botGroup)
+	assert.NotNil(t, err, "Cycles are detected")
+}
@@ -103,6 +103,7 @@ func GetMetricLabelsAndInfo_Bot(botGroup *data.BotGroup, bot *data.Bot) map[stri
 	labels := map[string]string{
 		"service":   "sireus",
 		"bot":       bot.Name,
+		"site":      botGroup.SiteName,
 		"bot_group": botGroup.Name,
 	}
 	return labels
@@ -113,6 +114,7 @@ func GetMetricLabelsAndInfo_Condition(botGroup *data.BotGroup, bot *data.Bot, co
 	labels := map[string]string{
 		"service":   "sireus",
 		"bot":       bot.Name,
+		"site":      botGroup.SiteName,
 		"bot_group": botGroup.Name,
 		"condition": condition.Name,
 		"states":    util.PrintStringArrayCSV(condition.RequiredStates),
@@ -125,8 +127,41 @@ func GetMetricLabelsAndInfo_BotVariable(botGroup *data.BotGroup, bot *data.Bot,
 	labels := map[string]string{
 		"service":   "sireus",
 		"bot":       bot.Name,
+		"site":      botGroup.SiteName,
 		"bot_group": botGroup.Name,
 		"variable":  varName,
 	}
 	return labels
 }
+
+// Returns the map used for Labels in a Metric, for a BotGroup's Aggregate
+func GetMetricLabelsAndInfo_BotGroupAggregate(botGroup *data.BotGroup, aggregateName string) map[string]string {
+	labels := map[string]string{
+		"service":   "sireus",
+		"site":      botGroup.SiteName,
+		"bot_group": botGroup.Name,
+		"aggregate": aggregateName,
+	}
+	return labels
+}
+
+// Returns the map used for Labels in a Metric, for a Query
+func GetMetricLabelsAndInfo_Query(siteName string, queryServerName string, query string) map[string]string {
+	labels := map[string]string{
+		"service":      "sireus",
+		"site":         siteName,
+		"query_server": queryServerName,
+		"query":        query,
+	}
+	return labels
+}
+
+// Returns the map used for Labels in a Metric, for a QueryServer
+func GetMetricLabelsAndInfo_QueryServer(siteName string, queryServerName string) map[string]string {
+	labels := map[string]string{
+		"service":      "sireus",
+		"site":         siteName,
+		"query_server": queryServerName,
+	}
+	return labels
+}
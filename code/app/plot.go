@@ -48,10 +48,10 @@ func GetAPIPlotData(c *fiber.Ctx) string {
 	return jsonString
 }
 
-func GetRawMetricsJSON(c *fiber.Ctx) string {
+func GetRawMetricsJSON(c *fiber.Ctx, site *data.Site) string {
 	queryKey := c.Query("query_key")
 
-	queryResult, ok := GetQueryResultByQueryKey(&data.SireusData.Site, queryKey)
+	queryResult, ok := GetQueryResultByQueryKey(site, queryKey)
 	if !ok {
 		return "{}"
 	}
@@ -59,19 +59,19 @@ func GetRawMetricsJSON(c *fiber.Ctx) string {
 	return util.PrintJson(queryResult)
 }
 
-func GetAPIPlotMetrics(c *fiber.Ctx) string {
+func GetAPIPlotMetrics(c *fiber.Ctx, site *data.Site) string {
 	input := util.ParseContextBody(c)
 	//log.Println("Get API Plot Metrics: ", util.PrintJson(input))
 
 	queryKey := input["query_key"]
 
-	queryResult, ok := GetQueryResultByQueryKey(&data.SireusData.Site, queryKey)
+	queryResult, ok := GetQueryResultByQueryKey(site, queryKey)
 	if !ok {
 		return "{}"
 	}
 
 	// If no results, just return.  We didn't get the data.  TODO(ghowland): Can add dynamic error messages later
-	if len(queryResult.Result.PrometheusResponse.Data.Result) == 0 {
+	if len(queryResult.Result.Response.Series) == 0 {
 		return "{}"
 	}
 
@@ -79,19 +79,11 @@ func GetAPIPlotMetrics(c *fiber.Ctx) string {
 	yArray := []float64{}
 
 	// Loop over all the values
-	for x := 0; x < len(queryResult.Result.PrometheusResponse.Data.Result[0].Values); x++ {
-		//axis := queryResult.Result.PrometheusResponse.Data.Result[0].Values[x][0]
-		value := queryResult.Result.PrometheusResponse.Data.Result[0].Values[x][1]
-
-		//xArray = append(xArray, axis.(float64))
+	for x, sample := range queryResult.Result.Response.Series[0].Samples {
 		xArray = append(xArray, float64(x))
-		yFloat, err := strconv.ParseFloat(value.(string), 64)
-		util.CheckLog(err)
-		yArray = append(yArray, yFloat)
+		yArray = append(yArray, sample.Value)
 	}
 
-	//queryResult.Result.PrometheusResponse.Data.Result[0].Values
-
 	mapData := map[string]interface{}{
 		"title":  queryResult.Query,
 		"plot_x": xArray,
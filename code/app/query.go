@@ -1,6 +1,10 @@
 package app
 
-import "github.com/ghowland/sireus/code/data"
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"time"
+)
 
 func GetQueryResultByQueryKey(site *data.Site, queryKey string) (data.QueryResultPoolItem, bool) {
 	// Block until we can lock, for goroutine safety
@@ -8,5 +12,56 @@ func GetQueryResultByQueryKey(site *data.Site, queryKey string) (data.QueryResul
 	defer site.QueryResultCache.QueryPoolSyncLock.Unlock()
 
 	result, ok := site.QueryResultCache.PoolItems[queryKey]
+	if ok {
+		// Track access for LRU eviction, see EvictQueryResultPool()
+		result.TimeAccessed = util.GetTimeNow()
+		site.QueryResultCache.PoolItems[queryKey] = result
+	}
 	return result, ok
 }
+
+// Marks a BotGroup as watched by a web app user, so its BotQuery items use AppConfig.QueryFastInterval.  The name
+// comes from the request, so only the Site's loaded BotGroups are watched, to keep the watches bounded.
+func WatchBotGroup(site *data.Site, botGroupName string) {
+	found := false
+	for _, botGroup := range GetSiteLoadedBotGroups(site) {
+		if botGroup.Name == botGroupName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	site.BotGroupWatches.AccessLock.Lock()
+	defer site.BotGroupWatches.AccessLock.Unlock()
+
+	if site.BotGroupWatches.Watched == nil {
+		site.BotGroupWatches.Watched = make(map[string]time.Time)
+	}
+	site.BotGroupWatches.Watched[botGroupName] = util.GetTimeNow()
+}
+
+// Returns true if a web app user interacted with this BotGroup in the last AppConfig.QueryFastDuration
+func IsBotGroupWatched(site *data.Site, botGroupName string) bool {
+	site.BotGroupWatches.AccessLock.RLock()
+	defer site.BotGroupWatches.AccessLock.RUnlock()
+
+	watchTime, ok := site.BotGroupWatches.Watched[botGroupName]
+	if !ok {
+		return false
+	}
+
+	return util.GetTimeNow().Sub(watchTime) < time.Duration(data.SireusData.AppConfig.QueryFastDuration)
+}
+
+// Returns the BotQuery.Interval to use for a BotGroup's query.  Watched BotGroups use AppConfig.QueryFastInterval, if
+// it is set and faster than the BotQuery.Interval
+func GetBotQueryInterval(site *data.Site, botGroup *data.BotGroup, query data.BotQuery) data.Duration {
+	fastInterval := data.SireusData.AppConfig.QueryFastInternal
+	if fastInterval > 0 && fastInterval < query.Interval && IsBotGroupWatched(site, botGroup.Name) {
+		return fastInterval
+	}
+	return query.Interval
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetBotQueryInterval(t *testing.T) {
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	defer util.SetClock(util.SetClock(clock))
+	defer func(fastInterval data.Duration, fastDuration data.Duration) {
+		data.SireusData.AppConfig.QueryFastInternal = fastInterval
+		data.SireusData.AppConfig.QueryFastDuration = fastDuration
+	}(data.SireusData.AppConfig.QueryFastInternal, data.SireusData.AppConfig.QueryFastDuration)
+	data.SireusData.AppConfig.QueryFastInternal = data.Duration(2 * time.Second)
+	data.SireusData.AppConfig.QueryFastDuration = data.Duration(30 * time.Second)
+
+	site := &data.Site{LoadedBotGroups: []data.BotGroup{{Name: "App"}}}
+	botGroup := data.BotGroup{Name: "App"}
+	query := data.BotQuery{Name: "Requests", Interval: data.Duration(15 * time.Second)}
+
+	assert.Equal(t, query.Interval, GetBotQueryInterval(site, &botGroup, query))
+
+	WatchBotGroup(site, "App")
+	assert.True(t, IsBotGroupWatched(site, "App"))
+	assert.False(t, IsBotGroupWatched(site, "Other"))
+
+	// Names that aren't loaded BotGroups aren't watched
+	WatchBotGroup(site, "Other")
+	assert.False(t, IsBotGroupWatched(site, "Other"))
+	assert.Len(t, site.BotGroupWatches.Watched, 1)
+	assert.Equal(t, data.Duration(2*time.Second), GetBotQueryInterval(site, &botGroup, query))
+
+	// Never slower than the BotQuery.Interval
+	fastQuery := data.BotQuery{Name: "Fast", Interval: data.Duration(time.Second)}
+	assert.Equal(t, fastQuery.Interval, GetBotQueryInterval(site, &botGroup, fastQuery))
+
+	// Back to normal after the fast duration
+	clock.Advance(31 * time.Second)
+	assert.False(t, IsBotGroupWatched(site, "App"))
+	assert.Equal(t, query.Interval, GetBotQueryInterval(site, &botGroup, query))
+}
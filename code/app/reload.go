@@ -0,0 +1,460 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// AppConfig fields that are only used when the server starts, so changing them requires a restart
+	appConfigRestartFields = []string{"web_http_port", "web_path", "prometheus_export_port", "enable_demo", "demo_api_port"}
+)
+
+type (
+	// A named config item, like a BotVariable or Condition, as JSON so changes to any field are found
+	namedConfigItem struct {
+		name    string
+		content string
+	}
+)
+
+// Merge a newly loaded and validated Site config into the live Site.  The Site's config is replaced, and the
+// LoadedBotGroups and every InteractiveSession's BotGroups are merged, so Bots, States, Lock Timers and Command History
+// are kept.  Query results and sessions are kept.  Returns the changes, including Bot States that were remapped in the
+// production session.
+func MergeSiteConfig(site *data.Site, loaded *data.Site) []string {
+	changes := GetSiteConfigChanges(site, loaded)
+
+	site.InteractiveSessionCache.AccessLock.Lock()
+	defer site.InteractiveSessionCache.AccessLock.Unlock()
+
+	// New sessions are created from LoadedBotGroups, so they get the live Bots.  Replaced by the production session's
+	// BotGroups below, so they stay shared with production like before the reload.
+	loadedBotGroups, _ := MergeBotGroups(site.LoadedBotGroups, loaded.LoadedBotGroups)
+
+	for uuid, session := range site.InteractiveSessionCache.Sessions {
+		var remapped []string
+		session.BotGroups, remapped = MergeBotGroups(session.BotGroups, loaded.LoadedBotGroups)
+		site.InteractiveSessionCache.Sessions[uuid] = session
+
+		// Interactive sessions are short-lived copies, so only the production remaps are reported
+		if uuid == 0 {
+			loadedBotGroups = session.BotGroups
+
+			for _, change := range remapped {
+				changes = append(changes, fmt.Sprintf("Site %s: %s", site.Name, change))
+			}
+		}
+	}
+
+	// Queries and web requests read these without the Site.UpdateLock, so they are replaced under the Site.ConfigLock
+	site.ConfigLock.Lock()
+	site.ConfigPath = loaded.ConfigPath
+	site.Info = loaded.Info
+	site.BotGroupPaths = loaded.BotGroupPaths
+	site.IncludePaths = loaded.IncludePaths
+	site.QueryServers = loaded.QueryServers
+	site.LoadedBotGroups = loadedBotGroups
+	site.ConfigLock.Unlock()
+
+	return changes
+}
+
+// Merge newly loaded BotGroup definitions with live BotGroups of the same name.  The definitions come from loaded, and
+// the live Bots, Lock Timers, Aggregate values and freeze controls are kept.  Bot States are remapped to the new
+// States, and Variables and Condition data that no longer exist are removed.  New BotGroups start with no Bots,
+// removed BotGroups are dropped.  Returns the merged BotGroups in the loaded order, and the Bot States that were
+// remapped.
+func MergeBotGroups(live []data.BotGroup, loaded []data.BotGroup) ([]data.BotGroup, []string) {
+	var merged []data.BotGroup
+	var changes []string
+
+	for _, loadedBotGroup := range loaded {
+		botGroup := loadedBotGroup
+
+		liveBotGroup, err := GetBotGroupFromSlice(live, loadedBotGroup.Name)
+		if util.Check(err) {
+			merged = append(merged, botGroup)
+			continue
+		}
+
+		botGroup.AggregateValues = liveBotGroup.AggregateValues
+		botGroup.DependencyValues = liveBotGroup.DependencyValues
+		botGroup.InvalidBots = liveBotGroup.InvalidBots
+		botGroup.StaleBots = liveBotGroup.StaleBots
+		botGroup.RemovedBots = liveBotGroup.RemovedBots
+		botGroup.FreezeConditions = liveBotGroup.FreezeConditions
+
+		// Lock Timers that still exist keep their locks, so a reload can't release a lock early
+		botGroup.LockTimers = make([]data.BotLockTimer, len(loadedBotGroup.LockTimers))
+		copy(botGroup.LockTimers, loadedBotGroup.LockTimers)
+		for index := range botGroup.LockTimers {
+			for _, liveLockTimer := range liveBotGroup.LockTimers {
+				if liveLockTimer.Name == botGroup.LockTimers[index].Name {
+					botGroup.LockTimers[index].IsActive = liveLockTimer.IsActive
+					botGroup.LockTimers[index].Timeout = liveLockTimer.Timeout
+					botGroup.LockTimers[index].ActivatedByBot = liveLockTimer.ActivatedByBot
+				}
+			}
+		}
+
+		botGroup.Bots = []data.Bot{}
+		for liveBotIndex := range liveBotGroup.Bots {
+			bot := CopyBotForMerge(&liveBotGroup.Bots[liveBotIndex])
+			bot.LockKey = fmt.Sprintf("%s.%s", botGroup.LockKey, bot.Name)
+
+			for _, change := range RemapBotStates(liveBotGroup, &botGroup, &bot) {
+				changes = append(changes, fmt.Sprintf("BotGroup %s: Bot %s: %s", botGroup.Name, bot.Name, change))
+			}
+
+			RemoveBotStaleConfigData(&botGroup, &bot)
+
+			botGroup.Bots = append(botGroup.Bots, bot)
+		}
+
+		merged = append(merged, botGroup)
+	}
+
+	return merged, changes
+}
+
+// Returns a copy of a live Bot with its own maps and slices, so removing stale data from the merged Bot doesn't modify
+// the live Bot while web requests read it.  The live Bot's lock is held while it is copied.
+func CopyBotForMerge(liveBot *data.Bot) data.Bot {
+	util.LockAcquire(liveBot.LockKey)
+	defer util.LockRelease(liveBot.LockKey)
+
+	bot := *liveBot
+
+	bot.VariableValues = util.CopyMapStringFloat64(liveBot.VariableValues)
+
+	bot.VariableUpdateTimes = make(map[string]time.Time)
+	for name, updateTime := range liveBot.VariableUpdateTimes {
+		bot.VariableUpdateTimes[name] = updateTime
+	}
+
+	bot.ConditionData = make(map[string]data.BotConditionData)
+	for name, conditionData := range liveBot.ConditionData {
+		conditionData.AvailableHistory = append([]bool{}, conditionData.AvailableHistory...)
+		bot.ConditionData[name] = conditionData
+	}
+
+	bot.StateValues = util.CopyStringSlice(liveBot.StateValues)
+	bot.CommandHistory = append([]data.ConditionCommandResult{}, liveBot.CommandHistory...)
+	bot.LockTimers = append([]data.BotLockTimer{}, liveBot.LockTimers...)
+
+	return bot
+}
+
+// Remap a Bot's StateValues from the old BotGroup States to the new ones.  A current Label that still exists is kept.
+// A removed Label is remapped to the Label at the same position in the new Labels, so renamed Labels keep the Bot's
+// progress, or else the first Label.  New States start at their first Label, and removed States are dropped.
+// Returns a description of every State that didn't keep its Label.
+func RemapBotStates(oldBotGroup *data.BotGroup, newBotGroup *data.BotGroup, bot *data.Bot) []string {
+	var changes []string
+	var stateValues []string
+
+	for _, state := range newBotGroup.States {
+		if len(state.Labels) == 0 {
+			continue
+		}
+
+		currentLabel := ""
+		for _, stateValue := range bot.StateValues {
+			if strings.HasPrefix(stateValue, state.Name+".") {
+				currentLabel = strings.TrimPrefix(stateValue, state.Name+".")
+			}
+		}
+
+		newLabel := state.Labels[0]
+		if currentLabel == "" {
+			changes = append(changes, fmt.Sprintf("Added State: %s.%s", state.Name, newLabel))
+		} else if util.StringInSlice(state.Labels, currentLabel) {
+			newLabel = currentLabel
+		} else {
+			oldState, err := GetBotForwardSequenceState(oldBotGroup, state.Name)
+			if !util.Check(err) {
+				for index, label := range oldState.Labels {
+					if label == currentLabel && index < len(state.Labels) {
+						newLabel = state.Labels[index]
+					}
+				}
+			}
+			changes = append(changes, fmt.Sprintf("Remapped State: %s.%s -> %s.%s", state.Name, currentLabel, state.Name, newLabel))
+		}
+
+		stateValues = append(stateValues, fmt.Sprintf("%s.%s", state.Name, newLabel))
+	}
+
+	for _, stateValue := range bot.StateValues {
+		stateName := strings.SplitN(stateValue, ".", 2)[0]
+		_, err := GetBotForwardSequenceState(newBotGroup, stateName)
+		if util.Check(err) {
+			changes = append(changes, fmt.Sprintf("Removed State: %s", stateValue))
+		}
+	}
+
+	sort.Strings(stateValues)
+	bot.StateValues = stateValues
+
+	return changes
+}
+
+// Remove a Bot's Variable values and Condition data that are no longer in the BotGroup config, so they aren't
+// reported as missing, or shown with old scores
+func RemoveBotStaleConfigData(botGroup *data.BotGroup, bot *data.Bot) {
+	for name := range bot.VariableValues {
+		if !IsBotGroupVariableName(botGroup, name) {
+			delete(bot.VariableValues, name)
+			delete(bot.VariableUpdateTimes, name)
+		}
+	}
+
+	for name := range bot.ConditionData {
+		_, err := GetCondition(botGroup, name)
+		if util.Check(err) {
+			delete(bot.ConditionData, name)
+		}
+	}
+}
+
+// Returns true if the name is a Bot.VariableValues key in this BotGroup: a Variable, a Variable Family member, or a
+// Peer relative Aggregate
+func IsBotGroupVariableName(botGroup *data.BotGroup, name string) bool {
+	_, err := GetVariableOrFamily(botGroup, name)
+	if !util.Check(err) {
+		return true
+	}
+
+	aggregate, err := GetBotGroupAggregate(botGroup, name)
+	return !util.Check(err) && aggregate.Type.IsPeerRelative()
+}
+
+// Returns the changes between the live Site config and a newly loaded one: the Site, Query Servers and BotGroups
+func GetSiteConfigChanges(oldSite *data.Site, newSite *data.Site) []string {
+	prefix := fmt.Sprintf("Site %s", newSite.Name)
+
+	var changes []string
+
+	if oldSite.Info != newSite.Info {
+		changes = append(changes, fmt.Sprintf("%s: Changed Info", prefix))
+	}
+
+	var oldQueryServers, newQueryServers []namedConfigItem
+	for _, queryServer := range oldSite.QueryServers {
+		oldQueryServers = append(oldQueryServers, namedConfigItem{queryServer.Name, util.PrintJsonData(queryServer)})
+	}
+	for _, queryServer := range newSite.QueryServers {
+		newQueryServers = append(newQueryServers, namedConfigItem{queryServer.Name, util.PrintJsonData(queryServer)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Query Server", oldQueryServers, newQueryServers)...)
+
+	for _, newBotGroup := range newSite.LoadedBotGroups {
+		oldBotGroup, err := GetBotGroupFromSlice(oldSite.LoadedBotGroups, newBotGroup.Name)
+		if util.Check(err) {
+			changes = append(changes, fmt.Sprintf("%s: Added BotGroup: %s", prefix, newBotGroup.Name))
+			continue
+		}
+		for _, change := range GetBotGroupConfigChanges(oldBotGroup, &newBotGroup) {
+			changes = append(changes, fmt.Sprintf("%s: %s", prefix, change))
+		}
+	}
+
+	for _, oldBotGroup := range oldSite.LoadedBotGroups {
+		_, err := GetBotGroupFromSlice(newSite.LoadedBotGroups, oldBotGroup.Name)
+		if util.Check(err) {
+			changes = append(changes, fmt.Sprintf("%s: Removed BotGroup: %s", prefix, oldBotGroup.Name))
+		}
+	}
+
+	return changes
+}
+
+// Returns the changes between two configs of the same BotGroup: its settings, and added, removed and changed
+// Queries, Variables, Aggregates, Conditions, States and Lock Timers
+func GetBotGroupConfigChanges(oldBotGroup *data.BotGroup, newBotGroup *data.BotGroup) []string {
+	prefix := fmt.Sprintf("BotGroup %s", newBotGroup.Name)
+
+	var changes []string
+	for _, field := range GetJsonFieldChanges(getBotGroupSettings(oldBotGroup), getBotGroupSettings(newBotGroup)) {
+		changes = append(changes, fmt.Sprintf("%s: Changed: %s", prefix, field))
+	}
+
+	var oldItems, newItems []namedConfigItem
+
+	for _, query := range oldBotGroup.Queries {
+		oldItems = append(oldItems, namedConfigItem{query.Name, util.PrintJsonData(query)})
+	}
+	for _, query := range newBotGroup.Queries {
+		newItems = append(newItems, namedConfigItem{query.Name, util.PrintJsonData(query)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Query", oldItems, newItems)...)
+
+	oldItems, newItems = nil, nil
+	for _, variable := range oldBotGroup.Variables {
+		oldItems = append(oldItems, namedConfigItem{variable.Name, util.PrintJsonData(variable)})
+	}
+	for _, variable := range newBotGroup.Variables {
+		newItems = append(newItems, namedConfigItem{variable.Name, util.PrintJsonData(variable)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Variable", oldItems, newItems)...)
+
+	oldItems, newItems = nil, nil
+	for _, aggregate := range oldBotGroup.Aggregates {
+		oldItems = append(oldItems, namedConfigItem{aggregate.Name, util.PrintJsonData(aggregate)})
+	}
+	for _, aggregate := range newBotGroup.Aggregates {
+		newItems = append(newItems, namedConfigItem{aggregate.Name, util.PrintJsonData(aggregate)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Aggregate", oldItems, newItems)...)
+
+	oldItems, newItems = nil, nil
+	for _, condition := range oldBotGroup.Conditions {
+		oldItems = append(oldItems, namedConfigItem{condition.Name, util.PrintJsonData(condition)})
+	}
+	for _, condition := range newBotGroup.Conditions {
+		newItems = append(newItems, namedConfigItem{condition.Name, util.PrintJsonData(condition)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Condition", oldItems, newItems)...)
+
+	oldItems, newItems = nil, nil
+	for _, state := range oldBotGroup.States {
+		oldItems = append(oldItems, namedConfigItem{state.Name, util.PrintJsonData(state)})
+	}
+	for _, state := range newBotGroup.States {
+		newItems = append(newItems, namedConfigItem{state.Name, util.PrintJsonData(state)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "State", oldItems, newItems)...)
+
+	// Only the Lock Timer config is compared, not if it is currently locked
+	oldItems, newItems = nil, nil
+	for _, lockTimer := range oldBotGroup.LockTimers {
+		oldItems = append(oldItems, namedConfigItem{lockTimer.Name, fmt.Sprintf("%d %s", lockTimer.Type, lockTimer.Info)})
+	}
+	for _, lockTimer := range newBotGroup.LockTimers {
+		newItems = append(newItems, namedConfigItem{lockTimer.Name, fmt.Sprintf("%d %s", lockTimer.Type, lockTimer.Info)})
+	}
+	changes = append(changes, getNamedConfigItemChanges(prefix, "Lock Timer", oldItems, newItems)...)
+
+	return changes
+}
+
+// Returns the changes between two AppConfigs.  Fields that are only used at startup are marked as needing a restart
+func GetAppConfigChanges(oldAppConfig data.AppConfig, newAppConfig data.AppConfig) []string {
+	var changes []string
+	for _, field := range GetJsonFieldChanges(oldAppConfig, newAppConfig) {
+		if util.StringInSlice(appConfigRestartFields, field) {
+			changes = append(changes, fmt.Sprintf("AppConfig: Changed: %s (restart required)", field))
+		} else {
+			changes = append(changes, fmt.Sprintf("AppConfig: Changed: %s", field))
+		}
+	}
+	return changes
+}
+
+// Returns the top level JSON fields that are different between 2 values of the same type, sorted
+func GetJsonFieldChanges(oldValue interface{}, newValue interface{}) []string {
+	oldFields := make(map[string]json.RawMessage)
+	newFields := make(map[string]json.RawMessage)
+	util.CheckLog(json.Unmarshal([]byte(util.PrintJsonData(oldValue)), &oldFields))
+	util.CheckLog(json.Unmarshal([]byte(util.PrintJsonData(newValue)), &newFields))
+
+	var changed []string
+	for field, newContent := range newFields {
+		if string(oldFields[field]) != string(newContent) {
+			changed = append(changed, field)
+		}
+	}
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			changed = append(changed, field)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// Returns the BotGroup with only its own settings, without its named config items or live data, for comparing
+func getBotGroupSettings(botGroup *data.BotGroup) data.BotGroup {
+	return data.BotGroup{
+		Name:                   botGroup.Name,
+		Info:                   botGroup.Info,
+		BotExtractor:           botGroup.BotExtractor,
+		DependsOn:              botGroup.DependsOn,
+		BotTimeoutStale:        botGroup.BotTimeoutStale,
+		BotTimeoutRemove:       botGroup.BotTimeoutRemove,
+		BotRemoveStoreDuration: botGroup.BotRemoveStoreDuration,
+		RefuseBotResumption:    botGroup.RefuseBotResumption,
+		ConditionThreshold:     botGroup.ConditionThreshold,
+		CommandHistoryDuration: botGroup.CommandHistoryDuration,
+		JournalRollupStates:    botGroup.JournalRollupStates,
+		JournalRollupDuration:  botGroup.JournalRollupDuration,
+	}
+}
+
+// Returns the added, removed and changed items, in config order
+func getNamedConfigItemChanges(prefix string, kind string, oldItems []namedConfigItem, newItems []namedConfigItem) []string {
+	var changes []string
+
+	for _, newItem := range newItems {
+		found := false
+		for _, oldItem := range oldItems {
+			if oldItem.name == newItem.name {
+				found = true
+				if oldItem.content != newItem.content {
+					changes = append(changes, fmt.Sprintf("%s: Changed %s: %s", prefix, kind, newItem.name))
+				}
+			}
+		}
+		if !found {
+			changes = append(changes, fmt.Sprintf("%s: Added %s: %s", prefix, kind, newItem.name))
+		}
+	}
+
+	for _, oldItem := range oldItems {
+		found := false
+		for _, newItem := range newItems {
+			if oldItem.name == newItem.name {
+				found = true
+			}
+		}
+		if !found {
+			changes = append(changes, fmt.Sprintf("%s: Removed %s: %s", prefix, kind, oldItem.name))
+		}
+	}
+
+	return changes
+}
+
+// Returns the modification times of the config files: the AppConfig, its Sites, and the Sites' BotGroups and templates,
+// and all the files they include.  Missing files are not included, so a file being rewritten is seen as a change
+func GetConfigFileTimes(appConfigPath string, appConfig data.AppConfig, sites []*data.Site) map[string]time.Time {
+	fileTimes := make(map[string]time.Time)
+
+	paths := []string{appConfigPath}
+	paths = append(paths, appConfig.IncludePaths...)
+	paths = append(paths, GetSiteConfigPaths(appConfig)...)
+	for _, site := range sites {
+		paths = append(paths, site.IncludePaths...)
+		paths = append(paths, site.BotGroupPaths...)
+		for _, botGroup := range GetSiteLoadedBotGroups(site) {
+			paths = append(paths, botGroup.TemplatePaths...)
+			paths = append(paths, botGroup.IncludePaths...)
+		}
+	}
+
+	for _, path := range paths {
+		modTime, err := util.GetFileModTime(path)
+		if !util.Check(err) {
+			fileTimes[path] = modTime
+		}
+	}
+
+	return fileTimes
+}
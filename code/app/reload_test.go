@@ -0,0 +1,113 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns a BotGroup config for reload tests, with a Health state, a Lock Timer, a Variable and a Condition
+func getReloadTestBotGroup() data.BotGroup {
+	return data.BotGroup{
+		Name:       "App",
+		LockKey:    "Site.App",
+		States:     []data.BotForwardSequenceState{{Name: "Health", Labels: []string{"Healthy", "Degraded", "Failed"}}},
+		LockTimers: []data.BotLockTimer{{Name: "Restart"}},
+		Variables:  []data.BotVariable{{Name: "load"}, {Name: "memory"}},
+		Conditions: []data.Condition{{Name: "Restart"}, {Name: "Page"}},
+	}
+}
+
+func TestMergeBotGroups(t *testing.T) {
+	live := getReloadTestBotGroup()
+	live.LockTimers[0].IsActive = true
+	live.LockTimers[0].Timeout = time.Unix(2000, 0)
+	live.Bots = []data.Bot{{
+		Name:           "web1",
+		StateValues:    []string{"Health.Degraded"},
+		VariableValues: map[string]float64{"load": 1, "memory": 2},
+		ConditionData:  map[string]data.BotConditionData{"Restart": {FinalScore: 0.5}, "Page": {FinalScore: 0.2}},
+		CommandHistory: []data.ConditionCommandResult{{ConditionName: "Restart"}},
+	}}
+
+	// Degraded is renamed to Slow, a Mode state is added, memory and Page are removed
+	loaded := getReloadTestBotGroup()
+	loaded.States = []data.BotForwardSequenceState{
+		{Name: "Health", Labels: []string{"Healthy", "Slow", "Failed"}},
+		{Name: "Mode", Labels: []string{"Normal", "Maintenance"}},
+	}
+	loaded.Variables = loaded.Variables[:1]
+	loaded.Conditions = loaded.Conditions[:1]
+
+	merged, changes := MergeBotGroups([]data.BotGroup{live}, []data.BotGroup{loaded, {Name: "New"}})
+
+	assert.Len(t, merged, 2, "Loaded BotGroups are all merged, in order")
+	assert.Len(t, merged[1].Bots, 0, "New BotGroups start with no Bots")
+
+	bot := merged[0].Bots[0]
+	assert.Equal(t, []string{"Health.Slow", "Mode.Normal"}, bot.StateValues, "Renamed Labels keep their position, new States start at the first Label")
+	assert.Equal(t, map[string]float64{"load": 1}, bot.VariableValues, "Removed Variables are removed from the Bot")
+	assert.Len(t, bot.ConditionData, 1, "Removed Conditions are removed from the Bot")
+	assert.Len(t, bot.CommandHistory, 1, "Command History is kept")
+	assert.Len(t, live.Bots[0].VariableValues, 2, "The live Bot's Variables aren't modified")
+	assert.Len(t, live.Bots[0].ConditionData, 2, "The live Bot's Condition data isn't modified")
+	assert.Equal(t, "Site.App.web1", bot.LockKey)
+	assert.True(t, merged[0].LockTimers[0].IsActive, "Lock Timers keep their locks")
+	assert.Equal(t, time.Unix(2000, 0), merged[0].LockTimers[0].Timeout)
+	assert.Equal(t, []string{
+		"BotGroup App: Bot web1: Remapped State: Health.Degraded -> Health.Slow",
+		"BotGroup App: Bot web1: Added State: Mode.Normal",
+	}, changes)
+}
+
+func TestMergeSiteConfigNewSession(t *testing.T) {
+	live := getReloadTestBotGroup()
+	live.Bots = []data.Bot{{Name: "web1", StateValues: []string{"Health.Healthy"}}}
+
+	site := data.Site{Name: "Site", LoadedBotGroups: []data.BotGroup{getReloadTestBotGroup()}}
+	site.InteractiveSessionCache.Sessions = map[data.SessionUUID]data.InteractiveSession{0: {BotGroups: []data.BotGroup{live}}}
+
+	loaded := data.Site{Name: "Site", LoadedBotGroups: []data.BotGroup{getReloadTestBotGroup()}}
+	MergeSiteConfig(&site, &loaded)
+
+	session := GetInteractiveSession(data.InteractiveControl{SessionUUID: 10}, &site)
+	assert.Len(t, session.BotGroups, 1)
+	assert.Len(t, session.BotGroups[0].Bots, 1, "Sessions created after a reload get the production Bots")
+	assert.Equal(t, "web1", session.BotGroups[0].Bots[0].Name)
+}
+
+func TestRemapBotStatesRemoved(t *testing.T) {
+	oldBotGroup := getReloadTestBotGroup()
+	newBotGroup := getReloadTestBotGroup()
+	newBotGroup.States = []data.BotForwardSequenceState{{Name: "Health", Labels: []string{"Healthy", "Failed"}}}
+
+	bot := data.Bot{StateValues: []string{"Health.Failed", "Retired.Yes"}}
+	changes := RemapBotStates(&oldBotGroup, &newBotGroup, &bot)
+
+	assert.Equal(t, []string{"Health.Failed"}, bot.StateValues, "Labels that still exist are kept")
+	assert.Equal(t, []string{"Removed State: Retired.Yes"}, changes)
+
+	bot = data.Bot{StateValues: []string{"Health.Degraded"}}
+	newBotGroup.States[0].Labels = []string{"Healthy"}
+	RemapBotStates(&oldBotGroup, &newBotGroup, &bot)
+	assert.Equal(t, []string{"Health.Healthy"}, bot.StateValues, "Labels past the end of the new Labels reset to the first Label")
+}
+
+func TestGetBotGroupConfigChanges(t *testing.T) {
+	oldBotGroup := getReloadTestBotGroup()
+	newBotGroup := getReloadTestBotGroup()
+	newBotGroup.BotTimeoutStale = data.Duration(time.Minute)
+	newBotGroup.Variables = []data.BotVariable{{Name: "load", Evaluate: "1"}, {Name: "disk"}}
+	newBotGroup.LockTimers[0].IsActive = true
+
+	assert.Equal(t, []string{
+		"BotGroup App: Changed: bot_timeout_stale",
+		"BotGroup App: Changed Variable: load",
+		"BotGroup App: Added Variable: disk",
+		"BotGroup App: Removed Variable: memory",
+	}, GetBotGroupConfigChanges(&oldBotGroup, &newBotGroup), "Lock Timer locks are not config changes")
+
+	assert.Equal(t, []string{"AppConfig: Changed: server_loop_delay", "AppConfig: Changed: web_http_port (restart required)"},
+		GetAppConfigChanges(data.AppConfig{}, data.AppConfig{WebHttpPort: 3000, ServerLoopDelay: data.Duration(time.Second)}))
+}
@@ -2,18 +2,92 @@ package app
 
 import (
 	"fmt"
+	"github.com/Knetic/govaluate"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/util"
 )
 
-// Calculate the Utility Score for a given Condition using a Bots BotConditionData
-func CalculateScore(action data.Condition, actionData data.BotConditionData) (float64, []string) {
+// Score a single ConditionConsideration against a Bot's evaluation data.  The expression is evaluated, mapped into
+// the Consideration range, applied to the Curve and weighted.  If any step fails, ConsiderationExplanation.IsValid is
+// false and the error explains why.  Has no side effects, so it can be used to test alternate values.
+func ScoreConsideration(consider data.ConditionConsideration, expression *govaluate.EvaluableExpression, evalMap map[string]interface{}) data.ConsiderationExplanation {
+	explanation := data.ConsiderationExplanation{
+		Name:       consider.Name,
+		Evaluate:   consider.Evaluate,
+		Inputs:     map[string]float64{},
+		RangeStart: consider.RangeStart,
+		RangeEnd:   consider.RangeEnd,
+		CurveName:  consider.CurveName,
+		Weight:     consider.Weight,
+	}
+
+	if expression == nil {
+		explanation.Error = fmt.Sprintf("Expression not compiled: %s", consider.Evaluate)
+		return explanation
+	}
+
+	// Record the Variables this expression used, so the result can be understood
+	for _, name := range GetExpressionVariableNames(expression) {
+		if value, ok := evalMap[name].(float64); ok {
+			explanation.Inputs[name] = value
+		}
+	}
+	context, _ := evalMap[ExpressionContextName].(ExpressionContext)
+	for _, pattern := range GetVariableFamilyReducerPatterns(consider.Evaluate) {
+		for _, name := range GetVariableFamilyMembers(context, pattern) {
+			if value, ok := evalMap[name].(float64); ok {
+				explanation.Inputs[name] = value
+			}
+		}
+	}
+
+	resultInt, err := expression.Evaluate(evalMap)
+	if err != nil {
+		explanation.Error = fmt.Sprintf("Evaluate failed: %s", err.Error())
+		return explanation
+	}
+
+	resultRaw, err := util.ConvertInterfaceToFloat(resultInt)
+	if err != nil {
+		explanation.Error = fmt.Sprintf("Evaluate result is not a number: %v", resultInt)
+		return explanation
+	}
+
+	// Apply the Range and Curve to the Raw score
+	resultRanged := util.RangeMapper(resultRaw, consider.RangeStart, consider.RangeEnd)
+	curve, err := GetCurve(consider.CurveName)
+	if err != nil {
+		explanation.Error = fmt.Sprintf("Curve missing: %s", consider.CurveName)
+		return explanation
+	}
+	resultCurved := GetCurveValue(curve, resultRanged)
+
+	explanation.Raw = resultRaw
+	explanation.Ranged = resultRanged
+	explanation.Curved = resultCurved
+	explanation.Weighted = resultCurved * consider.Weight
+	explanation.IsValid = true
+
+	return explanation
+}
+
+// Calculate the Utility Score for a given Condition using a Bots BotConditionData.  Returns the score, human-readable
+// details, and the structured ScoreAggregation of how it was calculated
+func CalculateScore(action data.Condition, actionData data.BotConditionData) (float64, []string, data.ScoreAggregation) {
 	var runningScore float64 = 1
 	var considerCount int = 0
 
 	var details []string
+	aggregation := data.ScoreAggregation{ConditionWeight: action.Weight}
+
+	// Loop in Condition order, so the details and aggregation steps are consistent
+	for _, consider := range action.Considerations {
+		considerName := consider.Name
+		considerScore, ok := actionData.ConsiderationFinalScores[considerName]
+		if !ok {
+			continue
+		}
 
-	for considerName, considerScore := range actionData.ConsiderationFinalScores {
 		// We will use a "modified average" to create a calculated score for all the considerations, so need a count
 		considerCount++
 
@@ -23,13 +97,9 @@ func CalculateScore(action data.Condition, actionData data.BotConditionData) (fl
 		// Any Consideration that is 0, means the entire Score is 0, and will never be executed.  It is not Invalid
 		if considerScore == 0 {
 			details = append(details, fmt.Sprintf("Consideration is 0, aborting: %s", considerName))
-			return 0, details
-		}
-
-		consider, err := GetConditionConsideration(action, considerName)
-		if util.CheckLog(err) {
-			details = append(details, fmt.Sprintf("Missing Consideration, aborting: %s", considerName))
-			return 0, details
+			aggregation.ConsiderCount = considerCount
+			aggregation.AbortedBy = considerName
+			return 0, details, aggregation
 		}
 
 		// Weight the Ranged Score, allowing it to be more important than other Considerations in this Condition
@@ -44,11 +114,19 @@ func CalculateScore(action data.Condition, actionData data.BotConditionData) (fl
 		// Move a constantly Running Score
 		runningScore *= weightedScore
 
+		aggregation.Steps = append(aggregation.Steps, data.ScoreAggregationStep{
+			Consideration: considerName,
+			Score:         considerScore,
+			Weight:        consider.Weight,
+			Weighted:      weightedScore,
+			RunningScore:  runningScore,
+		})
+
 		//details = append(details, fmt.Sprintf("Consider: %s  Final Consider Score: %.2f  Consider Weight: %.2f  Weighted: %.2f  Running: %.2f", consider.Name, considerScore, consider.Weight, weightedScore, runningScore))
 	}
 
 	// Mix the numbers together in a "modified average" which yields a good result, especially for low or 0-1 numbers
-	calculatedScore, detailsFromFixup := AverageAndFixup(runningScore, considerCount)
+	calculatedScore, detailsFromFixup := AverageAndFixup(runningScore, considerCount, &aggregation)
 
 	// Add any details we got from Fixup
 	for _, detail := range detailsFromFixup {
@@ -57,15 +135,18 @@ func CalculateScore(action data.Condition, actionData data.BotConditionData) (fl
 
 	//log.Printf("Calculate: %s  Consider Count: %d  Calc Score: %.2f", action.Name, considerCount, calculatedScore)
 
-	return calculatedScore, details
+	return calculatedScore, details, aggregation
 }
 
 // This is the heuristic we use to get a good "modified average" of the Considerations to a Consideration Final Score
 // This works well when all the ConditionConsideration.Weight values are ~1.0, so that they have relative importance
 // to each other.  Try to keep ConditionConsideration.Weight values between 0.1 and 10.0 for a good result.
-func AverageAndFixup(runningScore float64, considerCount int) (float64, []string) {
+func AverageAndFixup(runningScore float64, considerCount int, aggregation *data.ScoreAggregation) (float64, []string) {
 	var details []string
 
+	aggregation.ConsiderCount = considerCount
+	aggregation.RunningScore = runningScore
+
 	// Zero considerations is always 0.  We will be dividing by considerCount later...
 	if considerCount == 0 {
 		details = append(details, "There are 0 consideration final scores.  Nothing to Calculate: 0")
@@ -85,6 +166,10 @@ func AverageAndFixup(runningScore float64, considerCount int) (float64, []string
 	// Apply the average and fixup to the running score
 	var finalScore float64 = runningScore + (makeUpValue * runningScore)
 
+	aggregation.ModFactor = modFactor
+	aggregation.MakeUpValue = makeUpValue
+	aggregation.ConsiderationsAll = finalScore
+
 	// They can always look at the math to try to understand better
 	resultDetail := fmt.Sprintf("Unweighted All Considerations Scoring:  Running Score: %.2f  Count: %d  Mod: %0.2f  Make Up: %.2f  All Considerations Score: %.2f", runningScore, considerCount, modFactor, makeUpValue, finalScore)
 	details = append(details, resultDetail)
@@ -92,3 +177,54 @@ func AverageAndFixup(runningScore float64, considerCount int) (float64, []string
 
 	return finalScore, details
 }
+
+// Returns the score smoothed with an EWMA using Condition.ScoreSmoothing.  The first evaluation starts the average
+// at the raw score.  With no smoothing, the raw score is returned.
+func SmoothConditionScore(condition data.Condition, conditionData data.BotConditionData, rawScore float64) float64 {
+	if condition.ScoreSmoothing <= 0 || condition.ScoreSmoothing >= 1 || conditionData.EvaluationCount == 0 {
+		return rawScore
+	}
+
+	return condition.ScoreSmoothing*rawScore + (1-condition.ScoreSmoothing)*conditionData.SmoothedScore
+}
+
+// Returns true if the score is over the Condition threshold.  Once Available, the Condition.WeightThresholdExit is
+// used instead of Condition.WeightThreshold, so the score has to drop further to stop being Available.
+func IsConditionScoreOverThreshold(condition data.Condition, isAvailable bool, score float64) bool {
+	if isAvailable && condition.WeightThresholdExit != 0 {
+		return score >= condition.WeightThresholdExit
+	}
+
+	return score >= condition.WeightThreshold
+}
+
+// Adds this evaluation's threshold result to the history, keeping only the last Condition.AvailableWindowSize results
+func AddConditionAvailableHistory(condition data.Condition, history []bool, isOverThreshold bool) []bool {
+	if condition.AvailableWindowSize <= 0 {
+		return []bool{}
+	}
+
+	history = append(history, isOverThreshold)
+	if len(history) > condition.AvailableWindowSize {
+		history = history[len(history)-condition.AvailableWindowSize:]
+	}
+
+	return history
+}
+
+// Returns true if enough evaluations in the history were over the threshold.  Always true if the Condition doesn't
+// use an Available window.
+func IsConditionAvailableWindowMet(condition data.Condition, history []bool) bool {
+	if condition.AvailableWindowRequired <= 0 {
+		return true
+	}
+
+	count := 0
+	for _, isOverThreshold := range history {
+		if isOverThreshold {
+			count++
+		}
+	}
+
+	return count >= condition.AvailableWindowRequired
+}
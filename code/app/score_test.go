@@ -0,0 +1,61 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConditionHysteresis(t *testing.T) {
+	condition := data.Condition{WeightThreshold: 0.5, WeightThresholdExit: 0.3}
+
+	assert.False(t, IsConditionScoreOverThreshold(condition, false, 0.4), "Not Available needs the enter threshold")
+	assert.True(t, IsConditionScoreOverThreshold(condition, true, 0.4), "Available stays until the exit threshold")
+	assert.False(t, IsConditionScoreOverThreshold(condition, true, 0.2), "Available ends under the exit threshold")
+}
+
+func TestConditionAvailableWindow(t *testing.T) {
+	condition := data.Condition{AvailableWindowRequired: 2, AvailableWindowSize: 3}
+
+	var history []bool
+	for _, isOverThreshold := range []bool{true, false, false, true, true} {
+		history = AddConditionAvailableHistory(condition, history, isOverThreshold)
+	}
+
+	assert.Equal(t, []bool{false, true, true}, history)
+	assert.True(t, IsConditionAvailableWindowMet(condition, history))
+	assert.False(t, IsConditionAvailableWindowMet(condition, []bool{true, false, false}))
+	assert.True(t, IsConditionAvailableWindowMet(data.Condition{}, nil), "No window is always met")
+}
+
+func TestSmoothConditionScore(t *testing.T) {
+	condition := data.Condition{ScoreSmoothing: 0.25}
+
+	assert.Equal(t, 8.0, SmoothConditionScore(condition, data.BotConditionData{}, 8), "First evaluation starts at the raw score")
+	assert.Equal(t, 5.0, SmoothConditionScore(condition, data.BotConditionData{EvaluationCount: 1, SmoothedScore: 4}, 8))
+	assert.Equal(t, 8.0, SmoothConditionScore(data.Condition{}, data.BotConditionData{EvaluationCount: 1, SmoothedScore: 4}, 8))
+}
+
+func TestCalculateScoreAggregation(t *testing.T) {
+	condition := data.Condition{
+		Weight: 2,
+		Considerations: []data.ConditionConsideration{
+			{Name: "a", Weight: 1},
+			{Name: "b", Weight: 1},
+		},
+	}
+	conditionData := data.BotConditionData{ConsiderationFinalScores: map[string]float64{"a": 0.5, "b": 1}}
+
+	score, _, aggregation := CalculateScore(condition, conditionData)
+
+	assert.Equal(t, 2, aggregation.ConsiderCount)
+	assert.Equal(t, []string{"a", "b"}, []string{aggregation.Steps[0].Consideration, aggregation.Steps[1].Consideration})
+	assert.Equal(t, 0.5, aggregation.RunningScore)
+	assert.Equal(t, score, aggregation.ConsiderationsAll)
+	assert.Equal(t, "", aggregation.AbortedBy)
+
+	conditionData.ConsiderationFinalScores["b"] = 0
+	score, _, aggregation = CalculateScore(condition, conditionData)
+	assert.Equal(t, 0.0, score)
+	assert.Equal(t, "b", aggregation.AbortedBy)
+}
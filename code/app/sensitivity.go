@@ -0,0 +1,137 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+)
+
+const (
+	SensitivityStepsDefault = 20   // Number of steps a Consideration range is swept, if not specified
+	SensitivityStepsMax     = 1000 // Steps are clamped to this, as every step is scored and returned for every Consideration
+	SensitivityWeightChange = 0.10 // Fractional Weight increase used to find WeightImpact
+)
+
+// Sweep every Consideration of a Condition across its RangeStart to RangeEnd, holding the others at the Bot's current
+// values, to find which Considerations dominate the score, where the Condition crosses its threshold, and the impact
+// of each Weight.  Uses CalculateScore() and the Curves, so the scores match the real scoring.
+func GetConditionSensitivity(condition data.Condition, conditionData data.BotConditionData, steps int) data.ConditionSensitivity {
+	if steps < 2 {
+		steps = SensitivityStepsDefault
+	} else if steps > SensitivityStepsMax {
+		steps = SensitivityStepsMax
+	}
+
+	currentScore := GetConditionScoreFromCurved(condition, conditionData.ConsiderationCurvedScores)
+
+	sensitivity := data.ConditionSensitivity{
+		ConditionName: condition.Name,
+		Threshold:     condition.WeightThreshold,
+		FinalScore:    currentScore,
+	}
+
+	for considerIndex, consider := range condition.Considerations {
+		considerSensitivity := data.ConsiderationSensitivity{
+			Name:         consider.Name,
+			CurrentValue: conditionData.ConsiderationRawScores[consider.Name],
+		}
+
+		curve, err := GetCurve(consider.CurveName)
+		if util.Check(err) {
+			sensitivity.Considerations = append(sensitivity.Considerations, considerSensitivity)
+			continue
+		}
+
+		// Copy the curved scores, so we can replace this Consideration for each step
+		curvedScores := make(map[string]float64)
+		for name, value := range conditionData.ConsiderationCurvedScores {
+			curvedScores[name] = value
+		}
+
+		for step := 0; step <= steps; step++ {
+			input := consider.RangeStart + (consider.RangeEnd-consider.RangeStart)*float64(step)/float64(steps)
+			curvedScores[consider.Name] = GetCurveValue(curve, util.RangeMapper(input, consider.RangeStart, consider.RangeEnd))
+
+			considerSensitivity.Inputs = append(considerSensitivity.Inputs, input)
+			considerSensitivity.FinalScores = append(considerSensitivity.FinalScores, GetConditionScoreFromCurved(condition, curvedScores))
+		}
+
+		considerSensitivity.Crossings = GetThresholdCrossings(considerSensitivity.Inputs, considerSensitivity.FinalScores, condition.WeightThreshold)
+		considerSensitivity.ScoreSpan = GetFloat64Span(considerSensitivity.FinalScores)
+
+		// Increase only this Consideration's Weight, on a copy of the Considerations
+		weightedCondition := condition
+		weightedCondition.Considerations = make([]data.ConditionConsideration, len(condition.Considerations))
+		copy(weightedCondition.Considerations, condition.Considerations)
+		weightedCondition.Considerations[considerIndex].Weight *= 1 + SensitivityWeightChange
+		considerSensitivity.WeightImpact = GetConditionScoreFromCurved(weightedCondition, conditionData.ConsiderationCurvedScores) - currentScore
+
+		sensitivity.Considerations = append(sensitivity.Considerations, considerSensitivity)
+	}
+
+	return sensitivity
+}
+
+// Returns the Condition score, without smoothing, from the Curved Consideration scores.  The Consideration Weights are
+// applied, as they are in UpdateBotConditionConsiderations()
+func GetConditionScoreFromCurved(condition data.Condition, curvedScores map[string]float64) float64 {
+	conditionData := data.BotConditionData{ConsiderationFinalScores: map[string]float64{}}
+
+	for _, consider := range condition.Considerations {
+		curved, ok := curvedScores[consider.Name]
+		if !ok {
+			continue
+		}
+		conditionData.ConsiderationFinalScores[consider.Name] = curved * consider.Weight
+	}
+
+	score, _, _ := CalculateScore(condition, conditionData)
+
+	return score * condition.Weight
+}
+
+// Returns the inputs where the scores cross the threshold, linearly interpolated between the samples
+func GetThresholdCrossings(inputs []float64, scores []float64, threshold float64) []float64 {
+	crossings := []float64{}
+
+	for index := 1; index < len(scores); index++ {
+		before := scores[index-1] - threshold
+		after := scores[index] - threshold
+
+		if before == 0 {
+			crossings = append(crossings, inputs[index-1])
+			continue
+		}
+
+		if (before < 0) != (after < 0) && after != 0 {
+			fraction := before / (before - after)
+			crossings = append(crossings, inputs[index-1]+(inputs[index]-inputs[index-1])*fraction)
+		}
+	}
+
+	// The last sample can only be exactly on the threshold, crossings between samples are found above
+	if len(scores) > 0 && scores[len(scores)-1] == threshold {
+		crossings = append(crossings, inputs[len(inputs)-1])
+	}
+
+	return crossings
+}
+
+// Returns the difference between the largest and smallest values
+func GetFloat64Span(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	minValue := values[0]
+	maxValue := values[0]
+	for _, value := range values {
+		if value < minValue {
+			minValue = value
+		}
+		if value > maxValue {
+			maxValue = value
+		}
+	}
+
+	return maxValue - minValue
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetThresholdCrossings(t *testing.T) {
+	inputs := []float64{0, 1, 2, 3}
+
+	assert.Equal(t, []float64{0.5}, GetThresholdCrossings(inputs, []float64{0, 1, 1, 1}, 0.5))
+	assert.Equal(t, []float64{0.5, 2.5}, GetThresholdCrossings(inputs, []float64{0, 1, 1, 0}, 0.5))
+	assert.Equal(t, []float64{1}, GetThresholdCrossings(inputs, []float64{0, 0.5, 1, 1}, 0.5))
+	assert.Equal(t, []float64{}, GetThresholdCrossings(inputs, []float64{1, 1, 1, 1}, 0.5))
+}
+
+func TestGetFloat64Span(t *testing.T) {
+	assert.Equal(t, 3.0, GetFloat64Span([]float64{2, -1, 1}))
+	assert.Equal(t, 0.0, GetFloat64Span(nil))
+}
+
+func TestGetConditionSensitivity(t *testing.T) {
+	// A linear curve, so the swept scores are easy to predict
+	curve := CurveData{Name: "test_sensitivity_linear"}
+	for i := 0; i <= 100; i++ {
+		curve.Values = append(curve.Values, float64(i)*0.01)
+	}
+	previousCurves := Curves
+	Curves = append(append([]CurveData{}, Curves...), curve)
+	defer func() { Curves = previousCurves }()
+
+	condition := data.Condition{
+		Name:            "Restart",
+		Weight:          1,
+		WeightThreshold: 0.5,
+		Considerations: []data.ConditionConsideration{
+			{Name: "Errors", Weight: 1, CurveName: curve.Name, RangeStart: 0, RangeEnd: 10},
+			{Name: "Load", Weight: 1, CurveName: curve.Name, RangeStart: 0, RangeEnd: 1},
+			{Name: "Unknown", Weight: 1, CurveName: "test_sensitivity_missing", RangeStart: 0, RangeEnd: 1},
+		},
+	}
+	conditionData := data.BotConditionData{
+		ConsiderationRawScores:    map[string]float64{"Errors": 5, "Load": 1},
+		ConsiderationCurvedScores: map[string]float64{"Errors": 0.5, "Load": 1},
+	}
+
+	sensitivity := GetConditionSensitivity(condition, conditionData, 10)
+
+	assert.Equal(t, "Restart", sensitivity.ConditionName)
+	assert.Equal(t, 0.5, sensitivity.Threshold)
+	assert.Equal(t, GetConditionScoreFromCurved(condition, conditionData.ConsiderationCurvedScores), sensitivity.FinalScore)
+	assert.Len(t, sensitivity.Considerations, 3)
+
+	errors := sensitivity.Considerations[0]
+	assert.Equal(t, "Errors", errors.Name)
+	assert.Equal(t, 5.0, errors.CurrentValue)
+	assert.Len(t, errors.Inputs, 11)
+	assert.Equal(t, 0.0, errors.Inputs[0])
+	assert.Equal(t, 10.0, errors.Inputs[10])
+	assert.Equal(t, 0.0, errors.FinalScores[0], "A Consideration of 0 makes the score 0")
+	assert.InDelta(t, sensitivity.FinalScore, errors.FinalScores[5], 0.000001, "The current input scores the current score")
+	assert.Len(t, errors.Crossings, 1)
+	assert.Greater(t, errors.ScoreSpan, 0.0)
+	assert.Greater(t, errors.WeightImpact, 0.0)
+
+	// The sweep must not modify the Bot's scores
+	assert.Equal(t, map[string]float64{"Errors": 0.5, "Load": 1}, conditionData.ConsiderationCurvedScores)
+
+	// Without a curve, there is nothing to sweep
+	unknown := sensitivity.Considerations[2]
+	assert.Equal(t, "Unknown", unknown.Name)
+	assert.Nil(t, unknown.Inputs)
+
+	sensitivity = GetConditionSensitivity(condition, conditionData, 0)
+	assert.Len(t, sensitivity.Considerations[0].Inputs, SensitivityStepsDefault+1)
+
+	sensitivity = GetConditionSensitivity(condition, conditionData, 1000000)
+	assert.Len(t, sensitivity.Considerations[0].Inputs, SensitivityStepsMax+1, "Steps are clamped")
+}
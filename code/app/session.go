@@ -0,0 +1,253 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	InteractiveSessionTimeoutDefault = data.Duration(15 * time.Minute) // Used if AppConfig.InteractiveSessionTimeout is not set
+	SessionJanitorIntervalDefault    = data.Duration(10 * time.Second) // Used if AppConfig.SessionJanitorInterval is not set
+
+	// Rough in-memory sizes, used to estimate QueryResultPoolItem memory.  These don't need to be exact, only stable
+	queryResultPoolItemSizeBase int64 = 256 // Pool item, QueryResult and QueryResponse structs
+	querySeriesSizeBase         int64 = 64  // QuerySeries struct and labels map header
+	queryLabelSizeBase          int64 = 32  // Map entry overhead for each label
+	querySampleSize             int64 = 32  // time.Time and float64
+)
+
+// Runs the session janitor, if AppConfig.SessionJanitorInterval has passed since the last run.  Expires idle
+// InteractiveSessions and their cached query results, then enforces the QueryResultPool caps
+func RunSessionJanitor(site *data.Site) {
+	interval := data.SireusData.AppConfig.SessionJanitorInterval
+	if interval == 0 {
+		interval = SessionJanitorIntervalDefault
+	}
+
+	site.InteractiveSessionCache.AccessLock.Lock()
+	if util.GetTimeNow().Sub(site.InteractiveSessionCache.JanitorRun) < time.Duration(interval) {
+		site.InteractiveSessionCache.AccessLock.Unlock()
+		return
+	}
+	site.InteractiveSessionCache.JanitorRun = util.GetTimeNow()
+	site.InteractiveSessionCache.AccessLock.Unlock()
+
+	expired := ExpireInteractiveSessions(site)
+	if len(expired) > 0 {
+		log.Printf("Session Janitor: Expired Sessions: %v", expired)
+	}
+
+	evicted := EvictQueryResultPool(site, data.SireusData.AppConfig.QueryResultPoolMaxItems, data.SireusData.AppConfig.QueryResultPoolMaxBytes)
+	if evicted > 0 {
+		log.Printf("Session Janitor: Evicted Query Results: %d", evicted)
+	}
+}
+
+// Returns the Duration an InteractiveSession is kept after its last request
+func GetInteractiveSessionTimeout() time.Duration {
+	if data.SireusData.AppConfig.InteractiveSessionTimeout == 0 {
+		return time.Duration(InteractiveSessionTimeoutDefault)
+	}
+	return time.Duration(data.SireusData.AppConfig.InteractiveSessionTimeout)
+}
+
+// Removes all InteractiveSessions that haven't had a request in AppConfig.InteractiveSessionTimeout, and evicts their
+// cached query results.  The production session (UUID==0) is never expired.  Returns the expired UUIDs, sorted.
+func ExpireInteractiveSessions(site *data.Site) []data.SessionUUID {
+	timeout := GetInteractiveSessionTimeout()
+	now := util.GetTimeNow()
+
+	var expired []data.SessionUUID
+
+	site.InteractiveSessionCache.AccessLock.Lock()
+	for uuid, session := range site.InteractiveSessionCache.Sessions {
+		if uuid != 0 && now.Sub(session.TimeRequested) > timeout {
+			delete(site.InteractiveSessionCache.Sessions, uuid)
+			expired = append(expired, uuid)
+		}
+	}
+	site.InteractiveSessionCache.AccessLock.Unlock()
+
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+
+	for _, uuid := range expired {
+		EvictSessionQueryResults(site, uuid)
+	}
+
+	return expired
+}
+
+// Terminates an InteractiveSession now, from the Sessions page, and evicts its cached query results
+func TerminateInteractiveSession(site *data.Site, uuid data.SessionUUID) error {
+	if uuid == 0 {
+		return errors.New("Production session cannot be terminated")
+	}
+
+	site.InteractiveSessionCache.AccessLock.Lock()
+	_, ok := site.InteractiveSessionCache.Sessions[uuid]
+	delete(site.InteractiveSessionCache.Sessions, uuid)
+	site.InteractiveSessionCache.AccessLock.Unlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("Session not found: %d", uuid))
+	}
+
+	EvictSessionQueryResults(site, uuid)
+
+	return nil
+}
+
+// Removes all the QueryResultPoolItems and query locks for an InteractiveSession.  Returns the count of items removed
+func EvictSessionQueryResults(site *data.Site, uuid data.SessionUUID) int {
+	evicted := 0
+
+	site.QueryResultCache.QueryPoolSyncLock.Lock()
+	for queryKey, item := range site.QueryResultCache.PoolItems {
+		if item.InteractiveUUID == uuid {
+			delete(site.QueryResultCache.PoolItems, queryKey)
+			evicted++
+		}
+	}
+	site.QueryResultCache.QueryPoolSyncLock.Unlock()
+
+	// Query keys start with the session UUID, see extdata.GetQueryKey()
+	prefix := fmt.Sprintf("%d.", uuid)
+
+	site.QueryResultCache.QueryLocksSyncLock.Lock()
+	for queryKey := range site.QueryResultCache.QueryLocks {
+		if strings.HasPrefix(queryKey, prefix) {
+			delete(site.QueryResultCache.QueryLocks, queryKey)
+		}
+	}
+	site.QueryResultCache.QueryLocksSyncLock.Unlock()
+
+	return evicted
+}
+
+// Evicts the least recently used QueryResultPoolItems until the pool is under maxItems and maxBytes.  A cap of 0 is
+// unlimited.  Interactive session items are evicted before production items, as production items are needed every
+// server loop and would only be queried again.  Returns the count of items evicted.
+func EvictQueryResultPool(site *data.Site, maxItems int, maxBytes int64) int {
+	if maxItems <= 0 && maxBytes <= 0 {
+		return 0
+	}
+
+	site.QueryResultCache.QueryPoolSyncLock.Lock()
+	defer site.QueryResultCache.QueryPoolSyncLock.Unlock()
+
+	type poolEntry struct {
+		queryKey string
+		item     data.QueryResultPoolItem
+		size     int64
+	}
+
+	var entries []poolEntry
+	var totalBytes int64
+	for queryKey, item := range site.QueryResultCache.PoolItems {
+		size := GetQueryResultPoolItemSize(item)
+		entries = append(entries, poolEntry{queryKey: queryKey, item: item, size: size})
+		totalBytes += size
+	}
+
+	// Interactive items first, then least recently accessed first
+	sort.Slice(entries, func(i, j int) bool {
+		iProduction := entries[i].item.InteractiveUUID == 0
+		jProduction := entries[j].item.InteractiveUUID == 0
+		if iProduction != jProduction {
+			return !iProduction
+		}
+		if !entries[i].item.TimeAccessed.Equal(entries[j].item.TimeAccessed) {
+			return entries[i].item.TimeAccessed.Before(entries[j].item.TimeAccessed)
+		}
+		return entries[i].queryKey < entries[j].queryKey
+	})
+
+	evicted := 0
+	totalItems := len(entries)
+	for _, entry := range entries {
+		overItems := maxItems > 0 && totalItems > maxItems
+		overBytes := maxBytes > 0 && totalBytes > maxBytes
+		if !overItems && !overBytes {
+			break
+		}
+
+		delete(site.QueryResultCache.PoolItems, entry.queryKey)
+		totalItems--
+		totalBytes -= entry.size
+		evicted++
+	}
+
+	return evicted
+}
+
+// Returns the estimated memory of a QueryResultPoolItem, mostly from its QuerySeries and QuerySamples
+func GetQueryResultPoolItemSize(item data.QueryResultPoolItem) int64 {
+	size := queryResultPoolItemSizeBase
+	size += int64(len(item.QueryServer) + len(item.Query))
+	size += int64(len(item.Result.Response.RequestURL) + len(item.Result.Response.ErrorMessage))
+
+	for _, series := range item.Result.Response.Series {
+		size += querySeriesSizeBase
+		for key, value := range series.Labels {
+			size += queryLabelSizeBase + int64(len(key)+len(value))
+		}
+		size += int64(len(series.Samples)) * querySampleSize
+	}
+
+	return size
+}
+
+// Returns the InteractiveSessionInfo for all sessions in the Site, production first, then most recently requested
+func GetInteractiveSessionInfoAll(site *data.Site) []data.InteractiveSessionInfo {
+	timeout := GetInteractiveSessionTimeout()
+
+	infoMap := make(map[data.SessionUUID]*data.InteractiveSessionInfo)
+
+	site.InteractiveSessionCache.AccessLock.RLock()
+	for uuid, session := range site.InteractiveSessionCache.Sessions {
+		infoMap[uuid] = &data.InteractiveSessionInfo{
+			UUID:           uuid,
+			IsProduction:   uuid == 0,
+			TimeCreated:    session.TimeCreated,
+			TimeRequested:  session.TimeRequested,
+			TimeExpires:    session.TimeRequested.Add(timeout),
+			QueryStartTime: session.QueryStartTime,
+			QueryDuration:  session.QueryDuration,
+		}
+	}
+	site.InteractiveSessionCache.AccessLock.RUnlock()
+
+	site.QueryResultCache.QueryPoolSyncLock.RLock()
+	for _, item := range site.QueryResultCache.PoolItems {
+		info, ok := infoMap[item.InteractiveUUID]
+		if !ok {
+			continue
+		}
+		info.QueryItems++
+		info.MemoryBytes += GetQueryResultPoolItemSize(item)
+	}
+	site.QueryResultCache.QueryPoolSyncLock.RUnlock()
+
+	var infoAll []data.InteractiveSessionInfo
+	for _, info := range infoMap {
+		infoAll = append(infoAll, *info)
+	}
+
+	sort.Slice(infoAll, func(i, j int) bool {
+		if infoAll[i].IsProduction != infoAll[j].IsProduction {
+			return infoAll[i].IsProduction
+		}
+		if !infoAll[i].TimeRequested.Equal(infoAll[j].TimeRequested) {
+			return infoAll[i].TimeRequested.After(infoAll[j].TimeRequested)
+		}
+		return infoAll[i].UUID < infoAll[j].UUID
+	})
+
+	return infoAll
+}
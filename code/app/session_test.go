@@ -0,0 +1,82 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns a Site with an empty session and query pool
+func getSessionTestSite() *data.Site {
+	site := &data.Site{}
+	site.InteractiveSessionCache.Sessions = make(map[data.SessionUUID]data.InteractiveSession)
+	site.QueryResultCache.PoolItems = make(map[string]data.QueryResultPoolItem)
+	site.QueryResultCache.QueryLocks = make(map[string]time.Time)
+	return site
+}
+
+func TestExpireInteractiveSessions(t *testing.T) {
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	defer util.SetClock(util.SetClock(clock))
+	data.SireusData.AppConfig.InteractiveSessionTimeout = data.Duration(time.Minute)
+
+	site := getSessionTestSite()
+	GetInteractiveSession(data.InteractiveControl{SessionUUID: 0}, site)
+	GetInteractiveSession(data.InteractiveControl{SessionUUID: 1}, site)
+	site.QueryResultCache.PoolItems["0.prom.up"] = data.QueryResultPoolItem{InteractiveUUID: 0}
+	site.QueryResultCache.PoolItems["1.prom.up"] = data.QueryResultPoolItem{InteractiveUUID: 1}
+	site.QueryResultCache.QueryLocks["1.prom.up"] = clock.Now()
+
+	clock.Advance(30 * time.Second)
+	GetInteractiveSession(data.InteractiveControl{SessionUUID: 2}, site)
+	assert.Len(t, ExpireInteractiveSessions(site), 0)
+
+	// Session 1 is idle over the timeout, production is never expired
+	clock.Advance(45 * time.Second)
+	assert.Equal(t, []data.SessionUUID{1}, ExpireInteractiveSessions(site))
+	assert.Len(t, site.InteractiveSessionCache.Sessions, 2)
+	assert.Len(t, site.QueryResultCache.PoolItems, 1)
+	assert.Len(t, site.QueryResultCache.QueryLocks, 0)
+
+	assert.NotNil(t, TerminateInteractiveSession(site, 0))
+	assert.NotNil(t, TerminateInteractiveSession(site, 1))
+	assert.Nil(t, TerminateInteractiveSession(site, 2))
+
+	infoAll := GetInteractiveSessionInfoAll(site)
+	assert.Len(t, infoAll, 1)
+	assert.True(t, infoAll[0].IsProduction)
+	assert.Equal(t, 1, infoAll[0].QueryItems)
+	assert.Equal(t, GetQueryResultPoolItemSize(data.QueryResultPoolItem{}), infoAll[0].MemoryBytes)
+}
+
+func TestEvictQueryResultPool(t *testing.T) {
+	site := getSessionTestSite()
+	start := time.Unix(1000, 0)
+	site.QueryResultCache.PoolItems["0.a"] = data.QueryResultPoolItem{InteractiveUUID: 0, TimeAccessed: start}
+	site.QueryResultCache.PoolItems["1.b"] = data.QueryResultPoolItem{InteractiveUUID: 1, TimeAccessed: start.Add(2 * time.Second)}
+	site.QueryResultCache.PoolItems["1.c"] = data.QueryResultPoolItem{InteractiveUUID: 1, TimeAccessed: start.Add(time.Second)}
+
+	assert.Equal(t, 0, EvictQueryResultPool(site, 0, 0))
+	assert.Equal(t, 0, EvictQueryResultPool(site, 3, 0))
+
+	// Interactive items go first, least recently accessed first
+	assert.Equal(t, 1, EvictQueryResultPool(site, 2, 0))
+	_, ok := site.QueryResultCache.PoolItems["1.c"]
+	assert.False(t, ok)
+
+	itemSize := GetQueryResultPoolItemSize(data.QueryResultPoolItem{})
+	assert.Equal(t, 1, EvictQueryResultPool(site, 0, itemSize))
+	_, ok = site.QueryResultCache.PoolItems["0.a"]
+	assert.True(t, ok)
+}
+
+func TestGetQueryResultPoolItemSize(t *testing.T) {
+	item := data.QueryResultPoolItem{Result: data.QueryResult{Response: data.QueryResponse{Series: []data.QuerySeries{
+		{Labels: map[string]string{"job": "api"}, Samples: make([]data.QuerySample, 10)},
+	}}}}
+
+	expected := queryResultPoolItemSizeBase + querySeriesSizeBase + queryLabelSizeBase + 6 + 10*querySampleSize
+	assert.Equal(t, expected, GetQueryResultPoolItemSize(item))
+}
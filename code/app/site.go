@@ -0,0 +1,63 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+)
+
+// Returns all the Sites, in config order.  The slice is a copy, so it can be used while Sites are reloaded
+func GetSites() []*data.Site {
+	data.SireusData.ServerLock.RLock()
+	defer data.SireusData.ServerLock.RUnlock()
+
+	sites := make([]*data.Site, len(data.SireusData.Sites))
+	copy(sites, data.SireusData.Sites)
+	return sites
+}
+
+// Returns the Site by Site.Name.  If the name is empty, the first Site is the default
+func GetSite(name string) (*data.Site, error) {
+	sites := GetSites()
+	if len(sites) == 0 {
+		return nil, errors.New("No Sites are loaded")
+	}
+
+	if name == "" {
+		return sites[0], nil
+	}
+
+	for _, site := range sites {
+		if site.Name == name {
+			return site, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Site not found: %s", name))
+}
+
+// Returns the Site's QueryServers.  Config reloads replace the slice, and never modify it, so it can be used while the
+// Site reloads.
+func GetSiteQueryServers(site *data.Site) []data.QueryServer {
+	site.ConfigLock.RLock()
+	defer site.ConfigLock.RUnlock()
+
+	return site.QueryServers
+}
+
+// Returns the Site's LoadedBotGroups.  Config reloads replace the slice, so it can be used while the Site reloads.
+func GetSiteLoadedBotGroups(site *data.Site) []data.BotGroup {
+	site.ConfigLock.RLock()
+	defer site.ConfigLock.RUnlock()
+
+	return site.LoadedBotGroups
+}
+
+// Returns the names of all the Sites, in config order, for the web app's Site switcher
+func GetSiteNames() []string {
+	var names []string
+	for _, site := range GetSites() {
+		names = append(names, site.Name)
+	}
+	return names
+}
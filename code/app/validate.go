@@ -0,0 +1,413 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Validates the AppConfig's Sites and all of their BotGroup configs, without starting anything.  Every cross-reference
+// is checked, and all errors are returned with their file and JSON path, so they can be fixed at once.  Used by
+// "sireus validate" and at config load.
+func ValidateAppConfig(appConfig data.AppConfig) []data.ConfigValidationError {
+	var validationErrors []data.ConfigValidationError
+
+	sitePaths := GetSiteConfigPaths(appConfig)
+	if len(sitePaths) == 0 {
+		return []data.ConfigValidationError{{Path: "AppConfig", JsonPath: "$.site_config_paths", Message: "No Site configs"}}
+	}
+
+	// Sites are selected by name in the web app, so they must be unique.  Query Servers are kept per Site, so Sites can
+	// use the same Query Server names.
+	siteNamePaths := make(map[string]string)
+
+	for _, sitePath := range sitePaths {
+		site, siteErrors := validateSiteConfigFile(appConfig, sitePath)
+		validationErrors = append(validationErrors, siteErrors...)
+		if site == nil {
+			continue
+		}
+
+		if otherPath, found := siteNamePaths[site.Name]; found {
+			validationErrors = append(validationErrors, data.ConfigValidationError{Path: sitePath, JsonPath: "$.name", Message: fmt.Sprintf("Duplicate Site name: %s  Also in: %s", site.Name, otherPath)})
+		}
+		siteNamePaths[site.Name] = sitePath
+	}
+
+	return validationErrors
+}
+
+// Validates a Site config file and all of its BotGroup configs.  Returns a nil Site if the Site config couldn't be parsed
+func validateSiteConfigFile(appConfig data.AppConfig, sitePath string) (*data.Site, []data.ConfigValidationError) {
+	site, err := LoadSiteConfigFile(sitePath)
+	if util.Check(err) {
+		return nil, []data.ConfigValidationError{GetConfigParseError(sitePath, err)}
+	}
+
+	botGroups, botGroupPaths, validationErrors := LoadSiteBotGroupConfigs(sitePath, site)
+	validationErrors = append(validationErrors, ValidateSite(appConfig, sitePath, site, botGroups, botGroupPaths)...)
+
+	return site, validationErrors
+}
+
+// Validates a loaded Site and its BotGroups.  botGroupPaths are the BotGroup.ConfigSource of the botGroups, for error
+// reporting
+func ValidateSite(appConfig data.AppConfig, sitePath string, site *data.Site, botGroups []data.BotGroup, botGroupPaths []string) []data.ConfigValidationError {
+	var validationErrors []data.ConfigValidationError
+
+	addError := func(path string, jsonPath string, format string, args ...interface{}) {
+		validationErrors = append(validationErrors, data.ConfigValidationError{Path: path, JsonPath: jsonPath, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Query Servers must be uniquely named, because everything references them by name
+	var queryServerNames []string
+	for index, queryServer := range site.QueryServers {
+		if queryServer.Name == "" {
+			addError(sitePath, fmt.Sprintf("$.query_servers[%d].name", index), "Query Server name is empty")
+		} else if util.StringInSlice(queryServerNames, queryServer.Name) {
+			addError(sitePath, fmt.Sprintf("$.query_servers[%d].name", index), "Duplicate Query Server name: %s", queryServer.Name)
+		}
+		queryServerNames = append(queryServerNames, queryServer.Name)
+	}
+
+	var botGroupNames []string
+	for index := range botGroups {
+		if util.StringInSlice(botGroupNames, botGroups[index].Name) {
+			addError(botGroupPaths[index], "$.name", "Duplicate Bot Group name: %s", botGroups[index].Name)
+		}
+		botGroupNames = append(botGroupNames, botGroups[index].Name)
+	}
+
+	for index := range botGroups {
+		validationErrors = append(validationErrors, ValidateBotGroup(appConfig, botGroupPaths[index], &botGroups[index], queryServerNames, botGroups)...)
+	}
+
+	// Cycles are only detectable across all the BotGroups
+	if _, err := GetBotGroupDependencyOrder(botGroups); util.Check(err) {
+		addError(sitePath, "$.bot_group_paths", "%s", err.Error())
+	}
+
+	return validationErrors
+}
+
+// Validates every cross-reference in a BotGroup config: Queries, Variables, States, Lock Timers, Curves, expression
+// identifiers and DependsOn.  botGroups are all the Site's BotGroups, for DependsOn references.
+func ValidateBotGroup(appConfig data.AppConfig, path string, botGroup *data.BotGroup, queryServerNames []string, botGroups []data.BotGroup) []data.ConfigValidationError {
+	var validationErrors []data.ConfigValidationError
+
+	addError := func(jsonPath string, format string, args ...interface{}) {
+		validationErrors = append(validationErrors, data.ConfigValidationError{Path: path, JsonPath: jsonPath, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if botGroup.Name == "" {
+		addError("$.name", "Bot Group name is empty")
+	}
+
+	// Queries
+	var queryNames []string
+	for index, query := range botGroup.Queries {
+		if util.StringInSlice(queryNames, query.Name) {
+			addError(fmt.Sprintf("$.queries[%d].name", index), "Duplicate Query name: %s", query.Name)
+		}
+		queryNames = append(queryNames, query.Name)
+
+		if !util.StringInSlice(queryServerNames, query.QueryServer) {
+			addError(fmt.Sprintf("$.queries[%d].query_server", index), "Query Server not found: %s", query.QueryServer)
+		}
+	}
+
+	// Bot Extractor
+	if !util.StringInSlice(queryNames, botGroup.BotExtractor.QueryName) {
+		addError("$.bot_extractor.query_name", "Query not found: %s", botGroup.BotExtractor.QueryName)
+	}
+	if botGroup.BotExtractor.Key == "" && len(botGroup.BotExtractor.Keys) == 0 {
+		addError("$.bot_extractor.key", "Bot Extractor needs a key or keys")
+	}
+
+	// States and Lock Timers
+	var stateNames []string
+	for index, state := range botGroup.States {
+		if util.StringInSlice(stateNames, state.Name) {
+			addError(fmt.Sprintf("$.states[%d].name", index), "Duplicate State name: %s", state.Name)
+		}
+		stateNames = append(stateNames, state.Name)
+
+		if len(state.Labels) == 0 {
+			addError(fmt.Sprintf("$.states[%d].labels", index), "State has no labels: %s", state.Name)
+		}
+	}
+
+	var lockTimerNames []string
+	for _, lockTimer := range botGroup.LockTimers {
+		lockTimerNames = append(lockTimerNames, lockTimer.Name)
+	}
+
+	for index, stateLabel := range botGroup.JournalRollupStates {
+		if err := validateStateLabel(botGroup, stateLabel); util.Check(err) {
+			addError(fmt.Sprintf("$.journal_rollup_states[%d]", index), "%s", err.Error())
+		}
+	}
+
+	// DependsOn
+	for index, dependName := range botGroup.DependsOn {
+		if util.StringInSlice(botGroup.DependsOn[:index], dependName) {
+			addError(fmt.Sprintf("$.depends_on[%d]", index), "Duplicate Bot Group: %s", dependName)
+			continue
+		}
+		if _, err := getValidateBotGroup(botGroups, dependName); util.Check(err) {
+			addError(fmt.Sprintf("$.depends_on[%d]", index), "%s", err.Error())
+		}
+	}
+
+	// Compile all the expressions into the cache.  Errors are reported with their JSON path by validateExpression()
+	_ = CompileBotGroupExpressions(botGroup)
+
+	validateExpression := func(jsonPath string, expressionText string, knownNames []string) {
+		expression, err := GetBotGroupExpression(botGroup, expressionText)
+		if util.Check(err) {
+			addError(jsonPath, "Invalid expression: %s", err.Error())
+			return
+		}
+		if err := ValidateVariableFamilyReducers(botGroup, expressionText); util.Check(err) {
+			addError(jsonPath, "%s", err.Error())
+		}
+		for _, name := range GetExpressionVariableNames(expression) {
+			if !util.StringInSlice(knownNames, name) {
+				addError(jsonPath, "Unknown identifier: %s", name)
+			}
+		}
+	}
+
+	// Variables
+	var variableNames []string
+	for index, variable := range botGroup.Variables {
+		if util.StringInSlice(variableNames, variable.Name) {
+			addError(fmt.Sprintf("$.variables[%d].name", index), "Duplicate Variable name: %s", variable.Name)
+		}
+		variableNames = append(variableNames, variable.Name)
+
+		if len(variable.Evaluate) > 0 {
+			continue
+		}
+
+		if !util.StringInSlice(queryNames, variable.QueryName) {
+			addError(fmt.Sprintf("$.variables[%d].query_name", index), "Query not found: %s", variable.QueryName)
+		}
+	}
+
+	// Synthetic Variables can only use Variables, they are evaluated before the Aggregates
+	for index, variable := range botGroup.Variables {
+		if len(variable.Evaluate) == 0 {
+			continue
+		}
+		validateExpression(fmt.Sprintf("$.variables[%d].evaluate", index), variable.Evaluate, variableNames)
+	}
+	if _, err := GetSyntheticVariableOrder(botGroup); util.Check(err) {
+		addError("$.variables", "%s", err.Error())
+	}
+
+	// Aggregates
+	var evaluateNames []string
+	evaluateNames = append(evaluateNames, variableNames...)
+	for index, aggregate := range botGroup.Aggregates {
+		evaluateNames = append(evaluateNames, aggregate.Name)
+
+		if aggregate.Type != data.AggregateCount && aggregate.Type != data.AggregateCountInState && !util.StringInSlice(variableNames, aggregate.Variable) {
+			addError(fmt.Sprintf("$.aggregates[%d].variable", index), "Variable not found: %s", aggregate.Variable)
+		}
+		if aggregate.Type == data.AggregateCountInState {
+			if err := validateStateLabel(botGroup, aggregate.State); util.Check(err) {
+				addError(fmt.Sprintf("$.aggregates[%d].state", index), "%s", err.Error())
+			}
+		}
+	}
+
+	// Values from DependsOn BotGroups: "(BotGroup.Name).(Aggregate.Name)" and "(BotGroup.Name).(State.Name).(Label)"
+	for _, dependName := range botGroup.DependsOn {
+		dependBotGroup, err := getValidateBotGroup(botGroups, dependName)
+		if util.Check(err) {
+			continue
+		}
+		for _, aggregate := range dependBotGroup.Aggregates {
+			if !aggregate.Type.IsPeerRelative() {
+				evaluateNames = append(evaluateNames, fmt.Sprintf("%s.%s", dependName, aggregate.Name))
+			}
+		}
+		for _, state := range dependBotGroup.States {
+			for _, label := range state.Labels {
+				evaluateNames = append(evaluateNames, fmt.Sprintf("%s.%s.%s", dependName, state.Name, label))
+			}
+		}
+	}
+
+	// Conditions
+	for conditionIndex, condition := range botGroup.Conditions {
+		conditionPath := fmt.Sprintf("$.actions[%d]", conditionIndex)
+
+		if condition.WeightThresholdExit != 0 && condition.WeightThresholdExit > condition.WeightThreshold {
+			addError(conditionPath+".weight_threshold_exit", "Exit threshold is greater than weight_threshold: %v > %v", condition.WeightThresholdExit, condition.WeightThreshold)
+		}
+		if condition.AvailableWindowRequired > 0 && condition.AvailableWindowSize <= 0 {
+			addError(conditionPath+".available_window_size", "Window size must be set when available_window_required is set: %d", condition.AvailableWindowSize)
+		} else if condition.AvailableWindowRequired > condition.AvailableWindowSize {
+			addError(conditionPath+".available_window_size", "Window size is less than available_window_required: %d < %d", condition.AvailableWindowSize, condition.AvailableWindowRequired)
+		}
+
+		for index, consider := range condition.Considerations {
+			considerPath := fmt.Sprintf("%s.considerations[%d]", conditionPath, index)
+
+			if !isValidateCurveAvailable(appConfig, consider.CurveName) {
+				addError(considerPath+".curve", "Curve not found: %s", consider.CurveName)
+			}
+			if consider.RangeStart == consider.RangeEnd {
+				addError(considerPath+".range_end", "Range is empty: %v - %v", consider.RangeStart, consider.RangeEnd)
+			}
+			validateExpression(considerPath+".evaluate", consider.Evaluate, evaluateNames)
+		}
+
+		for index, requiredState := range condition.RequiredStates {
+			stateBotGroupName, stateLabel, _ := ParseRequiredState(requiredState)
+			stateBotGroup := botGroup
+			if stateBotGroupName != "" {
+				if !util.StringInSlice(botGroup.DependsOn, stateBotGroupName) {
+					addError(fmt.Sprintf("%s.required_states[%d]", conditionPath, index), "Bot Group not in depends_on: %s", stateBotGroupName)
+					continue
+				}
+				dependBotGroup, err := getValidateBotGroup(botGroups, stateBotGroupName)
+				if util.Check(err) {
+					continue
+				}
+				stateBotGroup = &dependBotGroup
+			}
+			if err := validateStateLabel(stateBotGroup, stateLabel); util.Check(err) {
+				addError(fmt.Sprintf("%s.required_states[%d]", conditionPath, index), "%s", err.Error())
+			}
+		}
+
+		for index, lockTimerName := range condition.RequiredLockTimers {
+			if !util.StringInSlice(lockTimerNames, lockTimerName) {
+				addError(fmt.Sprintf("%s.required_lock_timers[%d]", conditionPath, index), "Lock Timer not found: %s", lockTimerName)
+			}
+		}
+
+		for index, setState := range condition.Command.SetBotStates {
+			var err error
+			if strings.Contains(setState, ".") {
+				err = validateStateLabel(botGroup, setState)
+			} else if !util.StringInSlice(stateNames, setState) {
+				err = errors.New(fmt.Sprintf("State not found: %s", setState))
+			}
+			if util.Check(err) {
+				addError(fmt.Sprintf("%s.command.set_bot_states[%d]", conditionPath, index), "%s", err.Error())
+			}
+		}
+
+		for index, resetState := range condition.Command.ResetBotStates {
+			if !util.StringInSlice(stateNames, resetState) {
+				addError(fmt.Sprintf("%s.command.reset_bot_states[%d]", conditionPath, index), "State not found: %s", resetState)
+			}
+		}
+	}
+
+	return validationErrors
+}
+
+// Validates a "(State.Name).(Label)" exists in the BotGroup
+func validateStateLabel(botGroup *data.BotGroup, stateLabel string) error {
+	stateSplit := strings.SplitN(stateLabel, ".", 2)
+	if len(stateSplit) != 2 {
+		return errors.New(fmt.Sprintf("State must be formatted as (State.Name).(Label): %s", stateLabel))
+	}
+
+	state, err := GetBotForwardSequenceState(botGroup, stateSplit[0])
+	if util.Check(err) {
+		return errors.New(fmt.Sprintf("State not found: %s", stateSplit[0]))
+	}
+
+	if !util.StringInSlice(state.Labels, stateSplit[1]) {
+		return errors.New(fmt.Sprintf("State label not found: %s", stateLabel))
+	}
+
+	return nil
+}
+
+// Returns a BotGroup by name from the BotGroups being validated
+func getValidateBotGroup(botGroups []data.BotGroup, name string) (data.BotGroup, error) {
+	for _, botGroup := range botGroups {
+		if botGroup.Name == name {
+			return botGroup, nil
+		}
+	}
+	return data.BotGroup{}, errors.New(fmt.Sprintf("Bot Group not found: %s", name))
+}
+
+// Returns true if the Curve is loaded, or its file at AppConfig.CurvePathFormat can be loaded, see GetCurvePath()
+func isValidateCurveAvailable(appConfig data.AppConfig, name string) bool {
+	for _, curve := range Curves {
+		if curve.Name == name {
+			return true
+		}
+	}
+
+	var curve CurveData
+	err := UnmarshalConfigFile(GetCurvePath(appConfig, name), &curve)
+	return !util.Check(err) && len(curve.Values) > 0
+}
+
+// Returns a ConfigValidationError for a config that couldn't be read or parsed, with the line and column of JSON
+// syntax errors, and the JSON path of type errors
+func GetConfigParseError(path string, err error) data.ConfigValidationError {
+	validationError := data.ConfigValidationError{Path: path, JsonPath: "$", Message: err.Error()}
+
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &syntaxError) {
+		line, column := getConfigLineColumn(path, syntaxError.Offset)
+		validationError.Message = fmt.Sprintf("Invalid JSON at line %d column %d: %s", line, column, syntaxError.Error())
+	} else if errors.As(err, &typeError) {
+		if typeError.Field != "" {
+			validationError.JsonPath = getConfigJsonPath(typeError.Field)
+		}
+		line, column := getConfigLineColumn(path, typeError.Offset)
+		validationError.Message = fmt.Sprintf("Invalid type at line %d column %d: expected %s, got JSON %s", line, column, typeError.Type.String(), typeError.Value)
+	}
+
+	return validationError
+}
+
+// Returns the JSON path for a json.UnmarshalTypeError.Field, ex: "queries.0.name" -> "$.queries[0].name"
+func getConfigJsonPath(field string) string {
+	jsonPath := "$"
+	for _, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			jsonPath += "[" + part + "]"
+		} else {
+			jsonPath += "." + part
+		}
+	}
+	return jsonPath
+}
+
+// Returns the 1-based line and column of a byte offset in a file
+func getConfigLineColumn(path string, offset int64) (int, int) {
+	content, err := os.ReadFile(path)
+	if util.Check(err) {
+		return 0, 0
+	}
+
+	line, column := 1, 1
+	for index := int64(0); index < offset && index < int64(len(content)); index++ {
+		if content[index] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes a Site and BotGroup config into a temp dir, and returns the AppConfig for them
+func writeValidateConfig(t *testing.T, botGroupJson string) data.AppConfig {
+	dir := t.TempDir()
+
+	botGroupPath := filepath.Join(dir, "bot_group.json")
+	sitePath := filepath.Join(dir, "site.json")
+	siteJson := fmt.Sprintf(`{"name": "Test", "bot_group_paths": ["%s"], "query_servers": [{"name": "prom"}]}`, botGroupPath)
+
+	assert.Nil(t, os.WriteFile(botGroupPath, []byte(botGroupJson), 0644))
+	assert.Nil(t, os.WriteFile(sitePath, []byte(siteJson), 0644))
+
+	return data.AppConfig{SiteConfigPath: sitePath, CurvePathFormat: "../../config/curves/%s.json"}
+}
+
+func TestValidateAppConfig(t *testing.T) {
+	appConfig := writeValidateConfig(t, `{
+  "name": "App",
+  "states": [{"name": "Operation", "labels": ["Default", "Problem"]}],
+  "lock_timers": [{"type": 0, "name": "Group Lock"}],
+  "bot_extractor": {"query_name": "Missing Query", "key": "job"},
+  "queries": [{"query_server": "missing_server", "name": "Requests", "query": "up"}],
+  "variables": [
+    {"name": "requests", "query_name": "Requests"},
+    {"name": "ratio", "evaluate": "requests / unknown"}
+  ],
+  "actions": [{
+    "name": "Fix",
+    "required_states": ["Operation.Broken"],
+    "required_lock_timers": ["Missing Lock"],
+    "considerations": [{"name": "Load", "curve": "missing_curve", "range_start": 0, "range_end": 1, "evaluate": "requests +"}],
+    "command": {"set_bot_states": ["Operation.Problem", "Traffic"], "reset_bot_states": ["Operation"]}
+  }]
+}`)
+
+	var messages []string
+	for _, validationError := range ValidateAppConfig(appConfig) {
+		messages = append(messages, fmt.Sprintf("%s: %s", validationError.JsonPath, validationError.Message))
+	}
+
+	assert.ElementsMatch(t, []string{
+		"$.queries[0].query_server: Query Server not found: missing_server",
+		"$.bot_extractor.query_name: Query not found: Missing Query",
+		"$.variables[1].evaluate: Unknown identifier: unknown",
+		"$.actions[0].considerations[0].curve: Curve not found: missing_curve",
+		"$.actions[0].considerations[0].evaluate: Invalid expression: Unexpected end of expression",
+		"$.actions[0].required_states[0]: State label not found: Operation.Broken",
+		"$.actions[0].required_lock_timers[0]: Lock Timer not found: Missing Lock",
+		"$.actions[0].command.set_bot_states[1]: State not found: Traffic",
+	}, messages)
+}
+
+func TestValidateAppConfigParseErrors(t *testing.T) {
+	appConfig := writeValidateConfig(t, "{\n  \"name\": \"App\",\n  \"queries\": [\n}")
+	validationErrors := ValidateAppConfig(appConfig)
+	assert.Len(t, validationErrors, 1)
+	assert.Contains(t, validationErrors[0].Message, "line 4")
+
+	appConfig = writeValidateConfig(t, `{"name": "App", "queries": [{"interval": "5s", "name": 5}]}`)
+	validationErrors = ValidateAppConfig(appConfig)
+	assert.Len(t, validationErrors, 1)
+	assert.Equal(t, "$.queries[0].name", validationErrors[0].JsonPath)
+}
+
+func TestValidateAppConfigMultipleSites(t *testing.T) {
+	appConfig := writeValidateConfig(t, `{
+  "name": "App",
+  "bot_extractor": {"query_name": "Up", "key": "job"},
+  "queries": [{"query_server": "prom", "name": "Up", "query": "up"}]
+}`)
+
+	// A second Site with the same name and Query Server name as the first.  Only the Site name must be unique
+	otherSitePath := filepath.Join(t.TempDir(), "other_site.json")
+	assert.Nil(t, os.WriteFile(otherSitePath, []byte(`{"name": "Test", "query_servers": [{"name": "prom"}]}`), 0644))
+	appConfig.SiteConfigPaths = []string{appConfig.SiteConfigPath, otherSitePath}
+
+	var jsonPaths []string
+	for _, validationError := range ValidateAppConfig(appConfig) {
+		assert.Equal(t, otherSitePath, validationError.Path)
+		jsonPaths = append(jsonPaths, validationError.JsonPath)
+	}
+	assert.Equal(t, []string{"$.name"}, jsonPaths)
+}
+
+func TestValidateAppConfigAvailability(t *testing.T) {
+	appConfig := writeValidateConfig(t, `{
+  "name": "App",
+  "bot_extractor": {"query_name": "Up", "key": "job"},
+  "queries": [{"query_server": "prom", "name": "Up", "query": "up"}],
+  "actions": [
+    {"name": "No Window", "weight_threshold": 0.5, "weight_threshold_exit": 0.3, "available_window_required": 2},
+    {"name": "Small Window", "weight_threshold": 0.5, "weight_threshold_exit": 0.7, "available_window_required": 3, "available_window_size": 2},
+    {"name": "Valid", "weight_threshold": 0.5, "weight_threshold_exit": 0.4, "available_window_required": 2, "available_window_size": 3}
+  ]
+}`)
+
+	var messages []string
+	for _, validationError := range ValidateAppConfig(appConfig) {
+		messages = append(messages, fmt.Sprintf("%s: %s", validationError.JsonPath, validationError.Message))
+	}
+
+	assert.ElementsMatch(t, []string{
+		"$.actions[0].available_window_size: Window size must be set when available_window_required is set: 0",
+		"$.actions[1].weight_threshold_exit: Exit threshold is greater than weight_threshold: 0.7 > 0.5",
+		"$.actions[1].available_window_size: Window size is less than available_window_required: 2 < 3",
+	}, messages)
+}
@@ -0,0 +1,348 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Variable Family is a Query Variable with a templated name, like "disk_{{mount}}".  Every series of its query
+// creates a member Variable, like "disk_/var", which can't be known in advance.  Expressions use reducers over the
+// family's glob pattern, "disk_*", like: max(disk_*), avg(disk_*), sum(disk_*) or count(disk_* > 0.9).  All reducers
+// take an optional comparison to filter the members.  Reducers are rewritten when compiled into family_(reducer)()
+// functions, which get the ExpressionContext, so they can see all the Bot's values.
+
+var (
+	// Template fields in a Variable Family name, ex: "{{mount}}"
+	variableFamilyTemplateRegex = regexp.MustCompile(`\{\{[^}]*\}\}`)
+
+	// Reducers over a glob pattern with an optional filter, ex: "max(disk_*)" or "count(disk_* > 0.9)"
+	variableFamilyReducerRegex = regexp.MustCompile(`\b(min|max|sum|avg|count)\(\s*([A-Za-z_][A-Za-z0-9_.]*\*[A-Za-z0-9_.*]*)\s*(?:(>=|<=|==|!=|>|<)\s*(-?[0-9.]+)\s*)?\)`)
+
+	// Compiled glob patterns, they are used for every Bot on every evaluation
+	variableFamilyPatternCache     = make(map[string]*regexp.Regexp)
+	variableFamilyPatternCacheLock sync.RWMutex
+)
+
+// Returns true if this Variable name is a template, which creates a Variable Family
+func IsVariableFamily(name string) bool {
+	return strings.Contains(name, "{{")
+}
+
+// Returns the glob pattern of a Variable Family name, ex: "disk_{{mount}}" -> "disk_*"
+func GetVariableFamilyPattern(name string) string {
+	return variableFamilyTemplateRegex.ReplaceAllString(name, "*")
+}
+
+// Returns true if the name is matched by the glob pattern.  "*" matches 1 or more of any character
+func IsVariableFamilyMember(pattern string, name string) bool {
+	return getVariableFamilyPatternRegex(pattern).MatchString(name)
+}
+
+// Returns the compiled regex for a glob pattern, from the cache
+func getVariableFamilyPatternRegex(pattern string) *regexp.Regexp {
+	variableFamilyPatternCacheLock.RLock()
+	compiled, ok := variableFamilyPatternCache[pattern]
+	variableFamilyPatternCacheLock.RUnlock()
+	if ok {
+		return compiled
+	}
+
+	parts := strings.Split(pattern, "*")
+	for index, part := range parts {
+		parts[index] = regexp.QuoteMeta(part)
+	}
+	compiled = regexp.MustCompile("^" + strings.Join(parts, ".+") + "$")
+
+	variableFamilyPatternCacheLock.Lock()
+	variableFamilyPatternCache[pattern] = compiled
+	variableFamilyPatternCacheLock.Unlock()
+
+	return compiled
+}
+
+// Returns the BotVariable for a Bot.VariableValues name.  Either the Variable itself, or the Variable Family the name
+// is a member of
+func GetVariableOrFamily(botGroup *data.BotGroup, name string) (data.BotVariable, error) {
+	variable, err := GetVariable(botGroup, name)
+	if !util.Check(err) {
+		return variable, nil
+	}
+
+	variable, ok := GetVariableFamilyOwner(botGroup, name)
+	if ok {
+		return variable, nil
+	}
+
+	return data.BotVariable{}, err
+}
+
+// Returns the Variable Family a Bot.VariableValues name is a member of.  Variables and Aggregates are never members,
+// ex: a Peer Aggregate "disk_zscore" is not in "disk_{{mount}}".  If the name matches more than 1 family, the most
+// specific template owns it, the one with the most fixed characters, ex: "disk_io_sda" is in "disk_io_{{device}}",
+// not "disk_{{mount}}"
+func GetVariableFamilyOwner(botGroup *data.BotGroup, name string) (data.BotVariable, bool) {
+	if botGroup == nil {
+		return data.BotVariable{}, false
+	}
+
+	for _, variable := range botGroup.Variables {
+		if variable.Name == name {
+			return data.BotVariable{}, false
+		}
+	}
+	for _, aggregate := range botGroup.Aggregates {
+		if aggregate.Name == name {
+			return data.BotVariable{}, false
+		}
+	}
+
+	owner := data.BotVariable{}
+	ownerFixedLength := -1
+	for _, variable := range botGroup.Variables {
+		if !IsVariableFamily(variable.Name) {
+			continue
+		}
+
+		pattern := GetVariableFamilyPattern(variable.Name)
+		if !IsVariableFamilyMember(pattern, name) {
+			continue
+		}
+
+		fixedLength := len(strings.Replace(pattern, "*", "", -1))
+		if fixedLength > ownerFixedLength {
+			owner = variable
+			ownerFixedLength = fixedLength
+		}
+	}
+
+	return owner, ownerFixedLength != -1
+}
+
+// Returns true if the glob pattern is the pattern of a Variable Family in the BotGroup
+func IsVariableFamilyPatternInBotGroup(botGroup *data.BotGroup, pattern string) bool {
+	if botGroup == nil {
+		return false
+	}
+
+	for _, variable := range botGroup.Variables {
+		if IsVariableFamily(variable.Name) && GetVariableFamilyPattern(variable.Name) == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the member names of a glob pattern from the context values, sorted so reducers are deterministic.  If the
+// pattern is a Variable Family's, only names owned by a family with this pattern are members, see
+// GetVariableFamilyOwner().  Other patterns match any Variable or Aggregate name.
+func GetVariableFamilyMembers(context ExpressionContext, pattern string) []string {
+	isFamilyPattern := IsVariableFamilyPatternInBotGroup(context.BotGroup, pattern)
+
+	var names []string
+	for name := range context.Values {
+		if name == ExpressionContextName || !IsVariableFamilyMember(pattern, name) {
+			continue
+		}
+
+		if isFamilyPattern {
+			owner, ok := GetVariableFamilyOwner(context.BotGroup, name)
+			if !ok || GetVariableFamilyPattern(owner.Name) != pattern {
+				continue
+			}
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rewrites Variable Family reducers into family_(reducer)() functions, ex: "count(disk_* > 0.9)" ->
+// "family_count("disk_*", ">", 0.9)".  Call before the ExpressionContext functions are rewritten
+func RewriteVariableFamilyReducers(expression string) string {
+	return variableFamilyReducerRegex.ReplaceAllStringFunc(expression, func(match string) string {
+		parts := variableFamilyReducerRegex.FindStringSubmatch(match)
+		if parts[3] == "" {
+			return fmt.Sprintf("family_%s(\"%s\")", parts[1], parts[2])
+		}
+		return fmt.Sprintf("family_%s(\"%s\", \"%s\", %s)", parts[1], parts[2], parts[3], parts[4])
+	})
+}
+
+// Returns the glob patterns used by Variable Family reducers in an expression
+func GetVariableFamilyReducerPatterns(expression string) []string {
+	var patterns []string
+	for _, parts := range variableFamilyReducerRegex.FindAllStringSubmatch(expression, -1) {
+		if !util.StringInSlice(patterns, parts[2]) {
+			patterns = append(patterns, parts[2])
+		}
+	}
+	return patterns
+}
+
+// Validates the Variable Family reducers in an expression match a Variable Family or Variable in the BotGroup, so
+// a typo is a config error, instead of a reducer that never has any values
+func ValidateVariableFamilyReducers(botGroup *data.BotGroup, expression string) error {
+	for _, pattern := range GetVariableFamilyReducerPatterns(expression) {
+		found := false
+		for _, variable := range botGroup.Variables {
+			if IsVariableFamily(variable.Name) && GetVariableFamilyPattern(variable.Name) == pattern {
+				found = true
+			} else if !IsVariableFamily(variable.Name) && IsVariableFamilyMember(pattern, variable.Name) {
+				found = true
+			}
+		}
+		for _, aggregate := range botGroup.Aggregates {
+			if aggregate.Type.IsPeerRelative() && IsVariableFamilyMember(pattern, aggregate.Name) {
+				found = true
+			}
+		}
+
+		if !found {
+			return errors.New(fmt.Sprintf("Reducer pattern does not match any Variable Family or Variable: %s", pattern))
+		}
+	}
+
+	return nil
+}
+
+// Returns the Variable Family reducer functions for the expression function library
+func GetVariableFamilyFunctions() map[string]govaluate.ExpressionFunction {
+	return map[string]govaluate.ExpressionFunction{
+		"family_min": func(args ...interface{}) (interface{}, error) {
+			values, err := getVariableFamilyArgValues("min", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			if len(values) == 0 {
+				return nil, errors.New(fmt.Sprintf("min() has no values for: %v", args[1]))
+			}
+			result := values[0]
+			for _, value := range values[1:] {
+				result = math.Min(result, value)
+			}
+			return result, nil
+		},
+		"family_max": func(args ...interface{}) (interface{}, error) {
+			values, err := getVariableFamilyArgValues("max", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			if len(values) == 0 {
+				return nil, errors.New(fmt.Sprintf("max() has no values for: %v", args[1]))
+			}
+			result := values[0]
+			for _, value := range values[1:] {
+				result = math.Max(result, value)
+			}
+			return result, nil
+		},
+		"family_sum": func(args ...interface{}) (interface{}, error) {
+			values, err := getVariableFamilyArgValues("sum", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			result := 0.0
+			for _, value := range values {
+				result += value
+			}
+			return result, nil
+		},
+		"family_avg": func(args ...interface{}) (interface{}, error) {
+			values, err := getVariableFamilyArgValues("avg", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			if len(values) == 0 {
+				return nil, errors.New(fmt.Sprintf("avg() has no values for: %v", args[1]))
+			}
+			result := 0.0
+			for _, value := range values {
+				result += value
+			}
+			return result / float64(len(values)), nil
+		},
+		"family_count": func(args ...interface{}) (interface{}, error) {
+			values, err := getVariableFamilyArgValues("count", args)
+			if util.Check(err) {
+				return nil, err
+			}
+			return float64(len(values)), nil
+		},
+	}
+}
+
+// Returns the values of the family members for a reducer, filtered by the optional comparison.  Args are the
+// ExpressionContext, the glob pattern, and optionally the comparison operator and value
+func getVariableFamilyArgValues(name string, args []interface{}) ([]float64, error) {
+	if len(args) != 2 && len(args) != 4 {
+		return nil, errors.New(fmt.Sprintf("%s() requires a pattern, and optionally a comparison, ex: %s(disk_* > 0.9)", name, name))
+	}
+
+	context, ok := args[0].(ExpressionContext)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s() is missing the expression context", name))
+	}
+
+	pattern, ok := args[1].(string)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s() pattern must be a string: %v", name, args[1]))
+	}
+
+	operator := ""
+	threshold := 0.0
+	if len(args) == 4 {
+		operator, ok = args[2].(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s() comparison operator must be a string: %v", name, args[2]))
+		}
+		var err error
+		threshold, err = util.ConvertInterfaceToFloat(args[3])
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("%s() comparison value is not a number: %v", name, args[3]))
+		}
+	}
+
+	var values []float64
+	for _, member := range GetVariableFamilyMembers(context, pattern) {
+		value, err := util.ConvertInterfaceToFloat(context.Values[member])
+		if util.Check(err) {
+			continue
+		}
+
+		if operator != "" && !isVariableFamilyComparisonTrue(value, operator, threshold) {
+			continue
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// Tests a reducer's filter comparison
+func isVariableFamilyComparisonTrue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
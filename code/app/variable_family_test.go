@@ -0,0 +1,129 @@
+package app
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVariableFamilyPattern(t *testing.T) {
+	assert.True(t, IsVariableFamily("disk_{{mount}}"))
+	assert.False(t, IsVariableFamily("disk"))
+	assert.Equal(t, "disk_*", GetVariableFamilyPattern("disk_{{mount}}"))
+	assert.Equal(t, "net_*_*", GetVariableFamilyPattern("net_{{device}}_{{direction}}"))
+
+	assert.True(t, IsVariableFamilyMember("disk_*", "disk_/var"))
+	assert.False(t, IsVariableFamilyMember("disk_*", "disk_"))
+	assert.False(t, IsVariableFamilyMember("disk_*", "disks_/var"))
+	assert.True(t, IsVariableFamilyMember("net_*_*", "net_eth0_rx"))
+}
+
+func TestVariableFamilyReducers(t *testing.T) {
+	bot := data.Bot{}
+
+	tests := map[string]interface{}{
+		"max(disk_*)":               0.95,
+		"min(disk_*)":               0.25,
+		"sum(disk_*)":               1.7,
+		"avg(disk_*) * 3":           1.7,
+		"count(disk_* > 0.9)":       1.0,
+		"count(disk_*>=0.5)":        2.0,
+		"count(missing_*)":          0.0,
+		"max(disk_*, 2)":            nil, // Not a reducer, so it fails to compile
+		"max(a, count(disk_* < 1))": 3.0,
+	}
+
+	for expressionText, expected := range tests {
+		expression, err := CompileExpression(expressionText)
+		if expected == nil {
+			assert.NotNil(t, err, "Expression should not compile: %s", expressionText)
+			continue
+		}
+		assert.Nil(t, err, "Expression should compile: %s", expressionText)
+
+		evalMap := map[string]interface{}{"a": 2.0, "disk_/": 0.25, "disk_/var": 0.95, "disk_/home": 0.5}
+		AddExpressionContext(evalMap, nil, &bot)
+
+		result, err := expression.Evaluate(evalMap)
+		assert.Nil(t, err, "Expression should evaluate: %s", expressionText)
+		assert.InDelta(t, expected, result, 0.0001, "Expression result: %s", expressionText)
+	}
+
+	// Empty families have no max
+	expression, _ := CompileExpression("max(disk_*)")
+	evalMap := map[string]interface{}{}
+	AddExpressionContext(evalMap, nil, &bot)
+	_, err := expression.Evaluate(evalMap)
+	assert.NotNil(t, err)
+}
+
+func TestVariableFamilyValidation(t *testing.T) {
+	botGroup := data.BotGroup{
+		Name:      "Test",
+		Variables: []data.BotVariable{{Name: "disk_{{mount}}", Format: data.FormatPercent}, {Name: "cpu_user"}},
+		Conditions: []data.Condition{
+			{Name: "Good", Considerations: []data.ConditionConsideration{{Name: "Disk", Evaluate: "max(disk_*) + max(cpu_*)"}}},
+		},
+	}
+	assert.Nil(t, CompileBotGroupExpressions(&botGroup))
+
+	variable, err := GetVariableOrFamily(&botGroup, "disk_/var")
+	assert.Nil(t, err)
+	assert.Equal(t, data.FormatPercent, variable.Format)
+	_, err = GetVariableOrFamily(&botGroup, "memory")
+	assert.NotNil(t, err)
+
+	botGroup.Conditions[0].Considerations[0].Evaluate = "max(disks_*)"
+	assert.NotNil(t, CompileBotGroupExpressions(&botGroup), "Reducer typos are config errors")
+}
+
+func TestVariableFamilyOverlapping(t *testing.T) {
+	botGroup := data.BotGroup{
+		Name: "Test",
+		Variables: []data.BotVariable{
+			{Name: "disk_{{mount}}", Format: data.FormatPercent},
+			{Name: "disk_io_{{device}}", Format: data.FormatFloat},
+			{Name: "disk_total"},
+		},
+		Aggregates: []data.BotGroupAggregate{{Name: "disk_zscore", Type: data.AggregateZScore, Variable: "disk_total"}},
+	}
+
+	// Members of the more specific family, Variables and Aggregates are not in "disk_{{mount}}"
+	variable, ok := GetVariableFamilyOwner(&botGroup, "disk_/var")
+	assert.True(t, ok)
+	assert.Equal(t, "disk_{{mount}}", variable.Name)
+	variable, ok = GetVariableFamilyOwner(&botGroup, "disk_io_sda")
+	assert.True(t, ok)
+	assert.Equal(t, "disk_io_{{device}}", variable.Name)
+	_, ok = GetVariableFamilyOwner(&botGroup, "disk_zscore")
+	assert.False(t, ok)
+	_, ok = GetVariableFamilyOwner(&botGroup, "disk_total")
+	assert.False(t, ok)
+
+	variable, err := GetVariableOrFamily(&botGroup, "disk_io_sda")
+	assert.Nil(t, err)
+	assert.Equal(t, data.FormatFloat, variable.Format)
+
+	bot := data.Bot{}
+	evalMap := map[string]interface{}{"disk_/": 0.25, "disk_/var": 0.95, "disk_io_sda": 250.0, "disk_io_sdb": 120.0, "disk_total": 80.0, "disk_zscore": 3.0}
+	AddExpressionContext(evalMap, &botGroup, &bot)
+
+	tests := map[string]float64{
+		"max(disk_*)":           0.95,
+		"count(disk_*)":         2,
+		"max(disk_io_*)":        250,
+		"count(disk_io_* > 10)": 2,
+	}
+	for expressionText, expected := range tests {
+		expression, err := CompileExpression(expressionText)
+		assert.Nil(t, err, "Expression should compile: %s", expressionText)
+
+		result, err := expression.Evaluate(evalMap)
+		assert.Nil(t, err, "Expression should evaluate: %s", expressionText)
+		assert.InDelta(t, expected, result, 0.0001, "Expression result: %s", expressionText)
+	}
+
+	// Patterns that aren't a family's match any name
+	context := evalMap[ExpressionContextName].(ExpressionContext)
+	assert.Equal(t, []string{"disk_io_sda", "disk_io_sdb", "disk_total", "disk_zscore"}, GetVariableFamilyMembers(context, "disk_*o*"))
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type (
+	// A CLI subcommand, like "serve" or "validate".  Run gets the arguments after the command name, and returns the
+	// process exit code
+	Command struct {
+		Name  string
+		Usage string // One line summary for "sireus help"
+		Run   func(args []string) int
+	}
+)
+
+var (
+	// Output for command results, so tests can capture it.  Logs still go to the log package output
+	stdout io.Writer = os.Stdout
+
+	// Errors and usage
+	stderr io.Writer = os.Stderr
+
+	// Default command, if no command is given, so "./sireus" still starts the server
+	defaultCommand = "serve"
+)
+
+// Returns all the CLI commands, key is Command.Name
+func GetCommands() map[string]Command {
+	return map[string]Command{
+		"serve":      {Name: "serve", Usage: "Run the Sireus server, web app and Prometheus exporter", Run: RunServe},
+		"validate":   {Name: "validate", Usage: "Validate the config, its Site and BotGroups, and exit", Run: RunValidate},
+		"backtest":   {Name: "backtest", Usage: "Replay BotGroups across a historical time range and print the timeline", Run: RunBacktest},
+		"dump-state": {Name: "dump-state", Usage: "Run every query once and print the Bot States, Variables and Condition scores", Run: RunDumpState},
+		"version":    {Name: "version", Usage: "Print the Sireus version", Run: RunVersion},
+		"curve":      {Name: "curve", Usage: "Curve tools: \"curve plot NAME\" renders a curve in the terminal", Run: RunCurve},
+	}
+}
+
+// Run the CLI with the arguments after the program name.  Returns the process exit code
+func Run(args []string) int {
+	commandName := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		commandName = args[0]
+		args = args[1:]
+	}
+
+	if commandName == "help" {
+		PrintUsage(stdout)
+		return 0
+	}
+
+	command, ok := GetCommands()[commandName]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "Unknown command: %s\n\n", commandName)
+		PrintUsage(stderr)
+		return 2
+	}
+
+	return command.Run(args)
+}
+
+// Print the list of commands
+func PrintUsage(output io.Writer) {
+	_, _ = fmt.Fprintf(output, "Usage: sireus [command] [flags]\n\nCommands:\n")
+
+	commands := GetCommands()
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, _ = fmt.Fprintf(output, "  %-12s %s\n", name, commands[name].Usage)
+	}
+
+	_, _ = fmt.Fprintf(output, "\nIf no command is given, \"%s\" is run.  Use \"sireus [command] -h\" for the command's flags.\n", defaultCommand)
+}
+
+// Returns a FlagSet for a command, which returns parse errors instead of exiting
+func NewFlagSet(name string) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	return flagSet
+}
+
+// Parse a command's flags.  Returns the exit code and false if the command shouldn't run, for errors and "-h"
+func ParseFlags(flagSet *flag.FlagSet, args []string) (int, bool) {
+	err := flagSet.Parse(args)
+	if err == flag.ErrHelp {
+		return 0, false
+	}
+	if err != nil {
+		return 2, false
+	}
+	return 0, true
+}
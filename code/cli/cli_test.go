@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// Capture the CLI output for a test.  Returns the stdout and stderr buffers, and a function to restore them
+func captureOutput() (*bytes.Buffer, *bytes.Buffer, func()) {
+	prevStdout, prevStderr := stdout, stderr
+	outBuffer, errBuffer := &bytes.Buffer{}, &bytes.Buffer{}
+	stdout, stderr = outBuffer, errBuffer
+	return outBuffer, errBuffer, func() { stdout, stderr = prevStdout, prevStderr }
+}
+
+func TestRunVersion(t *testing.T) {
+	outBuffer, _, restore := captureOutput()
+	defer restore()
+
+	exitCode := Run([]string{"version", "-path", "../../version"})
+
+	assert.Equal(t, 0, exitCode, "Version file read")
+	assert.True(t, strings.HasPrefix(outBuffer.String(), "sireus "), "Version is printed")
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	_, errBuffer, restore := captureOutput()
+	defer restore()
+
+	exitCode := Run([]string{"bogus"})
+
+	assert.Equal(t, 2, exitCode, "Unknown commands are usage errors")
+	assert.Contains(t, errBuffer.String(), "Unknown command: bogus", "Error names the command")
+	assert.Contains(t, errBuffer.String(), "dump-state", "Usage lists the commands")
+}
+
+func TestRunBadFlag(t *testing.T) {
+	_, _, restore := captureOutput()
+	defer restore()
+
+	assert.Equal(t, 2, Run([]string{"version", "-bogus"}), "Unknown flags are usage errors")
+	assert.Equal(t, 0, Run([]string{"version", "-h"}), "Help is not an error")
+	assert.Equal(t, 2, Run([]string{"curve", "plot"}), "Curve plot requires a name")
+	assert.Equal(t, 2, Run([]string{"backtest", "-end", "yesterday"}), "Times must be RFC3339")
+	assert.Equal(t, 2, Run([]string{"backtest", "-duration", "8760h", "-step", "1s"}), "Backtests over BacktestMaxSteps are usage errors")
+}
+
+func TestRunCurvePlot(t *testing.T) {
+	outBuffer, _, restore := captureOutput()
+	defer restore()
+
+	exitCode := Run([]string{"curve", "plot", "-config", "../../config/test_config.json", "-width", "20", "-height", "5", "inc_smooth"})
+
+	assert.Equal(t, 0, exitCode, "Curve found")
+	assert.Contains(t, outBuffer.String(), "*", "Curve is plotted")
+}
+
+func TestRunValidate(t *testing.T) {
+	outBuffer, _, restore := captureOutput()
+	defer restore()
+
+	exitCode := Run([]string{"validate", "missing_config.json"})
+
+	assert.Equal(t, 1, exitCode, "Missing config is invalid")
+	assert.Contains(t, outBuffer.String(), "missing_config.json", "Errors are printed to stdout")
+}
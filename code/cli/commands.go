@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/extdata"
+	"github.com/ghowland/sireus/code/server"
+	"github.com/ghowland/sireus/code/util"
+	"os"
+	"strings"
+	"time"
+)
+
+// "sireus validate [-config path | path]": Validate the config, so CI can block bad configs
+func RunValidate(args []string) int {
+	flagSet := NewFlagSet("validate")
+	configPath := flagSet.String("config", "", "Path to the AppConfig.  A path argument can be used instead")
+	if exitCode, ok := ParseFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	path := *configPath
+	if path == "" && flagSet.NArg() > 0 {
+		path = flagSet.Arg(0)
+	}
+
+	return server.ValidateConfig(path, stdout)
+}
+
+// "sireus backtest": Replay the BotGroups across a historical time range, and print the BacktestResult as JSON
+func RunBacktest(args []string) int {
+	flagSet := NewFlagSet("backtest")
+	configPath := flagSet.String("config", "config/config.json", "Path to the AppConfig")
+	siteName := flagSet.String("site", "", "Site to backtest.  The first Site is used if empty")
+	botGroupName := flagSet.String("bot-group", "", "BotGroup to report on.  All BotGroups are reported if empty")
+	startText := flagSet.String("start", "", "Start time, RFC3339.  Defaults to -duration before -end")
+	endText := flagSet.String("end", "", "End time, RFC3339.  Defaults to now")
+	duration := flagSet.Duration("duration", time.Hour, "Time range, if -start is not set")
+	step := flagSet.Duration("step", time.Minute, "Simulated time between each pipeline run")
+	if exitCode, ok := ParseFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	endTime := util.GetTimeNow()
+	if *endText != "" {
+		var err error
+		endTime, err = time.Parse(time.RFC3339, *endText)
+		if util.Check(err) {
+			_, _ = fmt.Fprintf(stderr, "Invalid -end time: %s\n", err.Error())
+			return 2
+		}
+	}
+
+	startTime := endTime.Add(-*duration)
+	if *startText != "" {
+		var err error
+		startTime, err = time.Parse(time.RFC3339, *startText)
+		if util.Check(err) {
+			_, _ = fmt.Fprintf(stderr, "Invalid -start time: %s\n", err.Error())
+			return 2
+		}
+	}
+
+	backtest := data.Backtest{
+		BotGroupName: *botGroupName,
+		StartTime:    startTime,
+		EndTime:      endTime,
+		Step:         data.Duration(*step),
+	}
+
+	// Checked before the config is loaded, so a bad range fails quickly
+	err := extdata.ValidateBacktestRange(backtest)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err.Error())
+		return 2
+	}
+
+	if !ConfigureServer(*configPath) {
+		return 1
+	}
+
+	site, err := app.GetSite(*siteName)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err.Error())
+		return 1
+	}
+
+	result, err := extdata.RunBacktest(site, backtest)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "Backtest failed: %s\n", err.Error())
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(stdout, util.PrintJson(result))
+	return 0
+}
+
+// "sireus dump-state": Run every query once, update the BotGroups, and print their state as JSON.  Commands are
+// never sent
+func RunDumpState(args []string) int {
+	flagSet := NewFlagSet("dump-state")
+	configPath := flagSet.String("config", "config/config.json", "Path to the AppConfig")
+	siteName := flagSet.String("site", "", "Site to dump.  The first Site is used if empty")
+	botGroupName := flagSet.String("bot-group", "", "BotGroup to dump.  All BotGroups are dumped if empty")
+	if exitCode, ok := ParseFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	if !ConfigureServer(*configPath) {
+		return 1
+	}
+
+	site, err := app.GetSite(*siteName)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err.Error())
+		return 1
+	}
+
+	stateDump, err := extdata.RunStateDump(site, *botGroupName)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "Dump state failed: %s\n", err.Error())
+		return 1
+	}
+
+	_, _ = fmt.Fprintln(stdout, util.PrintJson(stateDump))
+	return 0
+}
+
+// "sireus version": Print the version from the version file
+func RunVersion(args []string) int {
+	flagSet := NewFlagSet("version")
+	versionPath := flagSet.String("path", "version", "Path to the version file")
+	if exitCode, ok := ParseFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	version, err := os.ReadFile(*versionPath)
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "Could not read version file: %s\n", err.Error())
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(stdout, "sireus %s\n", strings.TrimSpace(string(version)))
+	return 0
+}
+
+// "sireus curve plot NAME": Render a curve in the terminal
+func RunCurve(args []string) int {
+	if len(args) == 0 || args[0] != "plot" {
+		_, _ = fmt.Fprintf(stderr, "Usage: sireus curve plot [flags] NAME\n")
+		return 2
+	}
+
+	flagSet := NewFlagSet("curve plot")
+	configPath := flagSet.String("config", "config/config.json", "Path to the AppConfig, for the curve_path_format")
+	width := flagSet.Int("width", 60, "Plot width in columns")
+	height := flagSet.Int("height", 20, "Plot height in rows")
+	if exitCode, ok := ParseFlags(flagSet, args[1:]); !ok {
+		return exitCode
+	}
+
+	if flagSet.NArg() != 1 {
+		_, _ = fmt.Fprintf(stderr, "Usage: sireus curve plot [flags] NAME\n")
+		return 2
+	}
+
+	appConfig, err := app.LoadConfigFile(*configPath)
+	if util.Check(err) {
+		_, _ = fmt.Fprintln(stderr, app.GetConfigParseError(*configPath, err).String())
+		return 1
+	}
+	data.SireusData.AppConfig = appConfig
+
+	curveData, err := app.GetCurve(flagSet.Arg(0))
+	if util.Check(err) {
+		_, _ = fmt.Fprintf(stderr, "%s\n", err.Error())
+		return 1
+	}
+
+	_, _ = fmt.Fprint(stdout, app.GetCurvePlotText(curveData, *width, *height))
+	return 0
+}
+
+// Load the config into the Global Server Singleton, for commands that run the pipeline without serving.  Invalid
+// configs are reported instead of panicking.  Returns false if the config could not be loaded.
+func ConfigureServer(configPath string) (ok bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			_, _ = fmt.Fprintf(stderr, "Config invalid: %v\n", recovered)
+			ok = false
+		}
+	}()
+
+	server.SetConfigPath(configPath)
+	server.Configure()
+
+	return true
+}
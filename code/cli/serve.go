@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/demo"
+	"github.com/ghowland/sireus/code/exporter"
+	"github.com/ghowland/sireus/code/server"
+	"github.com/ghowland/sireus/code/webapp"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"log"
+	"net/http"
+)
+
+// "sireus serve": Run the Sireus server, web app and Prometheus exporter until quit.  Ports in the config can be
+// overridden, so several servers can run from the same config
+func RunServe(args []string) int {
+	flagSet := NewFlagSet("serve")
+	configPath := flagSet.String("config", "config/config.json", "Path to the AppConfig")
+	var overrides data.AppConfigOverrides
+	flagSet.IntVar(&overrides.WebHttpPort, "web-port", 0, "Override the config web_http_port")
+	flagSet.IntVar(&overrides.PrometheusExportPort, "export-port", 0, "Override the config prometheus_export_port")
+	flagSet.IntVar(&overrides.DemoApiPort, "demo-port", 0, "Override the config demo_api_port")
+	flagSet.BoolVar(&overrides.DisableDemo, "no-demo", false, "Don't run the demo, even if the config enable_demo is true")
+	if exitCode, ok := ParseFlags(flagSet, args); !ok {
+		return exitCode
+	}
+
+	log.Print("Starting Sireus server...")
+
+	// Configure the Global Server Singleton, where all the information will go
+	server.SetConfigPath(*configPath)
+	server.SetConfigOverrides(overrides)
+	server.Configure()
+
+	// Run the Prometheus Exporter listener in the background
+	go exporter.RunExporterListener()
+
+	// Run the server in the background until we end the server
+	go server.RunForever()
+
+	engine := webapp.CreateHandlebarsEngine(data.SireusData.AppConfig)
+	web := webapp.CreateWebApp(engine)
+
+	// If we want to run the demo, run in the background
+	if data.SireusData.AppConfig.EnableDemo {
+		go demo.RunDemoForever(web)
+
+		// Register Routes for the Demo
+		webapp.RegisterRoutesDemo(web)
+	}
+
+	// Register API routes
+	webapp.RegisterRoutesAPI(web)
+
+	// Register Web routes
+	webapp.RegisterRoutesWeb(web)
+
+	// Static Files: JS, Images
+	web.Use(filesystem.New(filesystem.Config{
+		Root: http.Dir("./static_web"),
+	}))
+
+	err := web.Listen(fmt.Sprintf(":%d", data.SireusData.AppConfig.WebHttpPort))
+	if err != nil {
+		log.Printf("Web App: Listen: %s", err.Error())
+		return 1
+	}
+
+	return 0
+}
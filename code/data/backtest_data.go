@@ -0,0 +1,37 @@
+package data
+
+import "time"
+
+type (
+	// Request to replay BotGroups across a historical time range.  The full UpdateSiteBotGroups pipeline runs at every
+	// Step with a simulated clock, so States, Lock Timers, repeat delays and RequiredAvailable behave as they would have
+	Backtest struct {
+		BotGroupName string    `json:"bot_group"` // BotGroup to report on.  If empty, all BotGroups are reported.  All BotGroups are always run, so dependencies work
+		StartTime    time.Time `json:"start_time"`
+		EndTime      time.Time `json:"end_time"`
+		Step         Duration  `json:"step"` // Simulated time between each pipeline run, and the step of the range queries
+	}
+)
+
+type (
+	// Result of a Backtest.  Timeline is in time order
+	BacktestResult struct {
+		Backtest Backtest        `json:"backtest"`
+		Steps    int             `json:"steps"` // Number of times the pipeline ran
+		Timeline []BacktestEvent `json:"timeline"`
+		Errors   []string        `json:"errors"` // Query errors.  Steps with missing data still run, with the BotVariable.MissingPolicy applied
+	}
+)
+
+type (
+	// A Condition that would have executed on a Bot during a Backtest
+	BacktestEvent struct {
+		Time          time.Time `json:"time"`
+		BotGroupName  string    `json:"bot_group"`
+		BotName       string    `json:"bot"`
+		ConditionName string    `json:"condition"`
+		Score         float64   `json:"score"`
+		StatesBefore  []string  `json:"states_before"`
+		StatesAfter   []string  `json:"states_after"`
+	}
+)
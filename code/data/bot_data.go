@@ -16,8 +16,10 @@ type (
 	// operating with a full set of data.
 	Bot struct {
 		Name                 string                      // Unique identifier pulled from the BotGroup.BotExtractor
+		Labels               map[string]string           // Labels of the BotGroup.BotExtractor series that created this Bot.  Updated with every extraction, and available in Command and Log templates
 		LockKey              string                      // Unique identifier for performing locks on this data
 		VariableValues       map[string]float64          // These are the unique values for this Bot, and will be used for all ConditionConsideration scoring
+		VariableUpdateTimes  map[string]time.Time        // Last time each Query Variable got a valid value, so BotVariable.MissingPolicy can be applied
 		SortedVariableValues PairFloat64List             // Sorted VariableValues, Handlebars helper
 		StateValues          []string                    // These are the current States for this Bot.  Conditions can only be available for execution, if all their Condition.RequiredStates are active in the Bot
 		CommandHistory       []ConditionCommandResult    // Storage of previous ConditionCommand data run, so we can see insight into the history
@@ -35,14 +37,104 @@ type (
 	// This stores the Final Scores and related data for all Conditions, so they can be compared to determin if any
 	// Condition should be executed
 	BotConditionData struct {
-		FinalScore                float64            // Final Score is the total result of calculations to Score this action for execution
-		IsAvailable               bool               // This Condition is Available (not blocked) if the FinalScore is over the WeightThreshold
-		AvailableStartTime        time.Time          // Time IsAvailable started, so we can use it for an internal Evaluation variable "_available_start_time".  Stateful.
-		LastExecutedConditionTime time.Time          // Last time we executed this Condition.  Stateful.
-		Details                   []string           // Details about the Evaluation and Scoring, to make it easier to understand the result
-		ConsiderationRawScores    map[string]float64 // Considerations Raw score, before it is applied to the Range and Curve, to help users understand what is happening
-		ConsiderationRangedScores map[string]float64 // Considerations Ranged score, taking the Raw score and applying to the range, before applying the Curve
-		ConsiderationCurvedScores map[string]float64 // Considerations Evaluated score, taking the Ranged score and applying the curve, but not weighted results for this Bot
-		ConsiderationFinalScores  map[string]float64 // Considerations Final Results for this Bot
+		FinalScore                float64              // Final Score is the total result of calculations to Score this action for execution
+		RawScore                  float64              // Final Score before Condition.ScoreSmoothing is applied.  Same as FinalScore if there is no smoothing
+		SmoothedScore             float64              // EWMA of RawScore, using Condition.ScoreSmoothing.  Stateful.
+		EvaluationCount           int                  // Number of times this Condition has been scored for this Bot, the first score starts the SmoothedScore.  Stateful.
+		AvailableHistory          []bool               // If the score was over the threshold, for the last Condition.AvailableWindowSize evaluations.  Stateful.
+		Explanation               ConditionExplanation // Structured version of Details, for tooling and the API.  Every value used to create the FinalScore and IsAvailable
+		IsAvailable               bool                 // This Condition is Available (not blocked) if the FinalScore is over the WeightThreshold
+		AvailableStartTime        time.Time            // Time IsAvailable started, so we can use it for an internal Evaluation variable "_available_start_time".  Stateful.
+		LastExecutedConditionTime time.Time            // Last time we executed this Condition.  Stateful.
+		Details                   []string             // Details about the Evaluation and Scoring, to make it easier to understand the result
+		ConsiderationRawScores    map[string]float64   // Considerations Raw score, before it is applied to the Range and Curve, to help users understand what is happening
+		ConsiderationRangedScores map[string]float64   // Considerations Ranged score, taking the Raw score and applying to the range, before applying the Curve
+		ConsiderationCurvedScores map[string]float64   // Considerations Evaluated score, taking the Ranged score and applying the curve, but not weighted results for this Bot
+		ConsiderationFinalScores  map[string]float64   // Considerations Final Results for this Bot
+	}
+)
+
+type (
+	// Structured explanation of how a Condition was scored and gated for a Bot.  Served from "/api/explain" and rendered
+	// in the Bot page, so tooling doesn't have to parse BotConditionData.Details
+	ConditionExplanation struct {
+		ConditionName  string                     `json:"condition_name"`
+		Considerations []ConsiderationExplanation `json:"considerations"` // In Condition.Considerations order
+		Aggregation    ScoreAggregation           `json:"aggregation"`    // How the Consideration scores were combined into the RawScore
+		RawScore       float64                    `json:"raw_score"`
+		ScoreSmoothing float64                    `json:"score_smoothing"` // Condition.ScoreSmoothing, 0 means the FinalScore is the RawScore
+		SmoothedScore  float64                    `json:"smoothed_score"`
+		FinalScore     float64                    `json:"final_score"`
+		Gates          []ConditionGate            `json:"gates"` // Every check that must pass for the Condition to be Available and execute
+		IsAvailable    bool                       `json:"is_available"`
+		CanExecute     bool                       `json:"can_execute"` // All the Gates passed, this will execute if it is the highest scoring Condition
+	}
+
+	// How a single ConditionConsideration was scored for a Bot
+	ConsiderationExplanation struct {
+		Name       string             `json:"name"`
+		Evaluate   string             `json:"evaluate"`
+		Inputs     map[string]float64 `json:"inputs"` // The Variables the Evaluate expression used, and their values for this Bot
+		RangeStart float64            `json:"range_start"`
+		RangeEnd   float64            `json:"range_end"`
+		CurveName  string             `json:"curve"`
+		Weight     float64            `json:"weight"`
+		Raw        float64            `json:"raw"`      // Result of the Evaluate expression
+		Ranged     float64            `json:"ranged"`   // Raw mapped into RangeStart to RangeEnd, 0-1
+		Curved     float64            `json:"curved"`   // Ranged applied to the Curve
+		Weighted   float64            `json:"weighted"` // Curved * Weight.  This is the Consideration Final Score
+		IsValid    bool               `json:"is_valid"`
+		Error      string             `json:"error"` // Why this Consideration is not valid
+	}
+
+	// How the Consideration scores were combined into the Condition RawScore.  See app.CalculateScore()
+	ScoreAggregation struct {
+		Steps             []ScoreAggregationStep `json:"steps"`
+		ConsiderCount     int                    `json:"consider_count"`
+		RunningScore      float64                `json:"running_score"` // Product of all the weighted Consideration scores
+		ModFactor         float64                `json:"mod_factor"`
+		MakeUpValue       float64                `json:"make_up_value"`
+		ConsiderationsAll float64                `json:"considerations_score"` // Running Score after the "modified average" fixup
+		ConditionWeight   float64                `json:"condition_weight"`
+		AbortedBy         string                 `json:"aborted_by"` // If not empty, this Consideration forced the score to 0
+	}
+
+	// A single Consideration being multiplied into the ScoreAggregation.RunningScore
+	ScoreAggregationStep struct {
+		Consideration string  `json:"consideration"`
+		Score         float64 `json:"score"`
+		Weight        float64 `json:"weight"`
+		Weighted      float64 `json:"weighted"`
+		RunningScore  float64 `json:"running_score"`
+	}
+
+	// A check that must pass for a Condition to be Available or execute
+	ConditionGate struct {
+		Name             string  `json:"name"`
+		Passed           bool    `json:"passed"`
+		Info             string  `json:"info"`
+		RemainingSeconds float64 `json:"remaining_seconds"` // For time based gates, how long until this passes
+	}
+)
+
+type (
+	// How sensitive a Condition's score is to each of its Considerations for a Bot.  Each Consideration is swept across
+	// its RangeStart to RangeEnd, holding the others at their current values.  Served from "/api/sensitivity"
+	ConditionSensitivity struct {
+		ConditionName  string                     `json:"condition_name"`
+		Threshold      float64                    `json:"threshold"`   // Condition.WeightThreshold
+		FinalScore     float64                    `json:"final_score"` // Current score, without smoothing, for comparing to the sweeps
+		Considerations []ConsiderationSensitivity `json:"considerations"`
+	}
+
+	// The sweep of a single Consideration's input, and the score it creates
+	ConsiderationSensitivity struct {
+		Name         string    `json:"name"`
+		CurrentValue float64   `json:"current_value"` // Current Raw value of the Consideration
+		Inputs       []float64 `json:"inputs"`        // Raw values swept from RangeStart to RangeEnd
+		FinalScores  []float64 `json:"final_scores"`  // Condition score for each of the Inputs
+		Crossings    []float64 `json:"crossings"`     // Raw values where the score crosses the Threshold, interpolated between Inputs
+		ScoreSpan    float64   `json:"score_span"`    // Max - Min of FinalScores.  Larger means this Consideration dominates more
+		WeightImpact float64   `json:"weight_impact"` // Change in the current score if this Consideration's Weight is increased by 10%
 	}
 )
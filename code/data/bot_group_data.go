@@ -1,6 +1,7 @@
 package data
 
 import (
+	"github.com/Knetic/govaluate"
 	"time"
 )
 
@@ -11,6 +12,7 @@ type (
 		Name                   string                    `json:"name"`
 		Info                   string                    `json:"info"`
 		BotExtractor           BotExtractorQueryKey      `json:"bot_extractor"`             // This is the information we use to create the ephemeral Bots, but taking their names from this query's metric key
+		DependsOn              []string                  `json:"depends_on"`                // BotGroup.Name of other BotGroups in this Site that this BotGroup references.  They are processed before this BotGroup, and their Aggregates and State counts are available to evaluations as "[(BotGroup.Name).(Aggregate.Name)]" and "[(BotGroup.Name).(State.Name).(Label)]"
 		States                 []BotForwardSequenceState `json:"states"`                    // States can only advance from the start to the end, they can never go backwards.  It's a sequence, but you can skip steps forward.  Using several of these, many situations can be modelled.
 		LockTimers             []BotLockTimer            `json:"lock_timers"`               // Lock timers work at BotGroup or Bot level, and block any execution for a period of time, so the previous action's results can be evaluated
 		BotTimeoutStale        Duration                  `json:"bot_timeout_stale"`         // Duration since Bot.VariableValues was last updated until this Bot is marked as Stale.  Stale bots only execute Conditions from a State named "Stale", so that you can respond, but no other states actions will apply.
@@ -23,15 +25,25 @@ type (
 		JournalRollupDuration  Duration                  `json:"journal_rollup_duration"`   // Time between a Journal Rollup ending, and another Journal Rollup beginning, so that they are grouped together.  This collects flapping outages together.
 		Queries                []BotQuery                `json:"queries"`                   // Queries used to populate the Variables
 		Variables              []BotVariable             `json:"variables"`                 // Variables get their data from Queries, and are used in ConditionConsideration evaluations to score the Condition
+		Aggregates             []BotGroupAggregate       `json:"aggregates"`                // Aggregates are computed across all the Bots after their Variables are set, so Considerations can compare a Bot against its peers
 		Conditions             []Condition               `json:"actions"`                   // Conditions get scored using ConditionConsideration and the highest scored Condition that IsAvailable will be executed.  Excecution also requires no LockTimers or other blocking factors.  The biggest factor is that Conditions only are tested and execute when certain BotStates are set, so there is a built-in grouping of available Conditions based on the BotState.
 		Bots                   []Bot                     // These are the ephemeral workers of Sireus.  In a Condition, the Queries populate VariableValues and then the ConditionConsiderations are scored to determine if an action IsAvailable.
+		AggregateValues        map[string]float64        // Group level BotGroupAggregate results, key is BotGroupAggregate.Name.  Added to every Bot's evaluation data.  Peer relative Aggregates are stored in Bot.VariableValues instead
+		DependencyValues       map[string]float64        // Aggregates and State counts from the BotGroup.DependsOn BotGroups, key is "(BotGroup.Name).(Aggregate.Name)" or "(BotGroup.Name).(State.Name).(Label)".  Added to every Bot's evaluation data
 
 		// Invalid = Isn't getting all the information.  Stale = Information out of data.  Removed = No data for too long, removing.
-		InvalidBots      []string
-		StaleBots        []string
-		RemovedBots      []string
-		FreezeConditions bool   // If true, no actions will be taken for this BotGroup.  Allows group level control.
-		LockKey          string // Formatted with: (Site.Name).(BotGroup.Name)
+		InvalidBots            []string
+		StaleBots              []string
+		RemovedBots            []string
+		FreezeConditions       bool                                      // If true, no actions will be taken for this BotGroup.  Allows group level control.
+		LockKey                string                                    // Formatted with: (Site.Name).(BotGroup.Name)
+		SiteName               string                                    // Site.Name this BotGroup is in, for Metric labels.  Set at config load
+		CompiledExpressions    map[string]*govaluate.EvaluableExpression `json:"-"` // Key is the Evaluate string.  All Variable and Consideration expressions are compiled once at config load, and shared by every Bot and Session
+		SyntheticVariableOrder []string                                  `json:"-"` // BotVariable.Name of all Synthetic Variables, in the order they are evaluated, so they can reference each other.  Set at config load
+		ConfigSource           string                                    `json:"-"` // Config path, or Site "bot_group_instances" entry, this BotGroup was loaded from
+		TemplatePaths          []string                                  `json:"-"` // Paths of the BotGroup templates this config extends, nearest first
+		IncludePaths           []string                                  `json:"-"` // Paths of the files included by this config and its templates, so they are watched for reloads
+		ResolvedConfig         string                                    `json:"-"` // The config JSON after templates and their params are resolved, to view in the web app
 	}
 )
 
@@ -39,9 +51,15 @@ type (
 	// This is how Bots are created.  There is a BotQuery named QueryName that will use the Key to find the name of the
 	// Bots.  Using something like "instance", "node" or "service" is recommended, that will uniquely identify a Bot
 	// inside a BotGroup's configuration.
+	//
+	// For composite identity, like (cluster, instance), set Keys instead of Key.  Series missing any of the Keys do not
+	// create a Bot.  NameFormat is a Handlebars template of the series labels to name the Bot, ex:
+	// "{{cluster}}/{{instance}}".  If empty, the Keys values are joined with "/".
 	BotExtractorQueryKey struct {
-		QueryName string `json:"query_name"`
-		Key       string `json:"key"`
+		QueryName  string   `json:"query_name"`
+		Key        string   `json:"key"`         // Single label that is the Bot.Name.  Ignored if Keys is set
+		Keys       []string `json:"keys"`        // Labels that together identify a Bot
+		NameFormat string   `json:"name_format"` // Handlebars template of the series labels for Bot.Name, used with Keys
 	}
 )
 
@@ -198,19 +216,129 @@ type (
 	//
 	// If BotKey is set, only query results that have a Metric Key named BotKey that matches Bot.Name will be accepted.
 	//
+	// If BotKeys is set, it is used instead of BotKey, and only query results where every BotKeys label matches the
+	// same label in Bot.Labels will be accepted.  Use this with a BotExtractorQueryKey.Keys composite identity.
+	//
 	// If QueryKey is set, only query results that have a value with their Metric Name of QueryKey which matches
 	// QueryKeyValue will be set.
 	BotVariable struct {
 		Name           string            `json:"name"`
 		Format         BotVariableFormat `json:"format"`
-		BotKey         string            `json:"bot_key"` // Determines which Metric matches a Bot, may change between queries
+		BotKey         string            `json:"bot_key"`  // Determines which Metric matches a Bot, may change between queries
+		BotKeys        []string          `json:"bot_keys"` // Labels that must all match Bot.Labels, for composite Bot identity.  Overrides BotKey
 		QueryName      string            `json:"query_name"`
 		QueryKey       string            `json:"query_key"`       // Metric key to extract
 		QueryKeyValue  string            `json:"query_key_value"` // Metric key value to match against the QueryKey
-		Evaluate       string            `json:"evaluate"`        // If this is non-empty, query will not be performed.  After query testing for other variables, this will have a final phase of processing, and will take all the query-made variables and perform govaluation.Evaluate() with this evaluate string, to set this variable.  Evaluate variables cannot use each other, only Query variables.
+		Evaluate       string            `json:"evaluate"`        // If this is non-empty, query will not be performed.  After query testing for other variables, this will have a final phase of processing, and will take all the query-made variables and perform govaluation.Evaluate() with this evaluate string, to set this variable.  Evaluate variables can use Query variables and other Evaluate variables, and are evaluated in the order of their references.
 		BoolRangeStart float64           `json:"bool_range_start"`
 		BoolRangeEnd   float64           `json:"bool_range_end"`
 		BoolInvert     bool              `json:"bool_invert"`
 		Export         bool              `json:"export"` // If true, this variable will be exported for Metric collection.  Normally not useful, because we just got it from the Metric system.
+
+		MissingPolicy       BotVariableMissingPolicy `json:"missing_policy"`        // What to do when a Query Variable has no sample for a Bot, or the sample is NaN or Inf
+		MissingDefault      float64                  `json:"missing_default"`       // Value used with MissingUseDefault
+		MissingHoldDuration Duration                 `json:"missing_hold_duration"` // With MissingHoldLast, how long the last valid value is used before the Bot is Invalid
+	}
+)
+
+type (
+	// What to do when a Query Variable is missing for a Bot, or the query returned NaN or Inf.  Only Query Variables use
+	// this, Synthetic Variables are missing if any of the variables they use are missing.
+	//
+	// MissingTreatAsZero is the default, and changes scoring from earlier versions.  Before, a sample without a value
+	// was stored as math.SmallestNonzeroFloat64, and a Bot missing from a Query's results kept its last value forever.
+	// Now both are 0 every update.  Set MissingHoldLast with a long MissingHoldDuration to keep using the last value.
+	BotVariableMissingPolicy int64
+)
+
+const (
+	MissingTreatAsZero BotVariableMissingPolicy = iota // Use 0.  This is the default, see BotVariableMissingPolicy
+	MissingUseDefault                                  // Use BotVariable.MissingDefault
+	MissingHoldLast                                    // Keep the last valid value for BotVariable.MissingHoldDuration, then Invalidate
+	MissingInvalidate                                  // Mark the Bot Invalid, so it cannot execute any Conditions
+)
+
+// Format the BotVariableMissingPolicy for human readability
+func (bvmp BotVariableMissingPolicy) String() string {
+	switch bvmp {
+	case MissingTreatAsZero:
+		return "Treat as Zero"
+	case MissingUseDefault:
+		return "Use Default"
+	case MissingHoldLast:
+		return "Hold Last"
+	case MissingInvalidate:
+		return "Invalidate"
+	}
+	return "Unknown"
+}
+
+type (
+	// How a BotGroupAggregate combines the Bots values.  Group level types create a single value for the BotGroup, Peer
+	// types create a value for each Bot relative to the other Bots in the BotGroup
+	BotGroupAggregateType int64
+)
+
+const (
+	AggregateCount BotGroupAggregateType = iota
+	AggregateSum
+	AggregateMean
+	AggregateMin
+	AggregateMax
+	AggregatePercentile
+	AggregateCountInState
+	AggregateZScore
+	AggregateRank
+)
+
+// Format the BotGroupAggregateType for human readability
+func (bgat BotGroupAggregateType) String() string {
+	switch bgat {
+	case AggregateCount:
+		return "Count"
+	case AggregateSum:
+		return "Sum"
+	case AggregateMean:
+		return "Mean"
+	case AggregateMin:
+		return "Min"
+	case AggregateMax:
+		return "Max"
+	case AggregatePercentile:
+		return "Percentile"
+	case AggregateCountInState:
+		return "Count in State"
+	case AggregateZScore:
+		return "Z-Score"
+	case AggregateRank:
+		return "Rank"
+	}
+	return "Unknown"
+}
+
+// Is this a Peer relative type, which creates a value per Bot, instead of a single BotGroup value?
+func (bgat BotGroupAggregateType) IsPeerRelative() bool {
+	return bgat == AggregateZScore || bgat == AggregateRank
+}
+
+type (
+	// BotGroupAggregate creates a variable from all the Bots in a BotGroup, after each Bot's Query and Synthetic
+	// Variables are set.  This lets a Consideration ask questions like "what fraction of my peers are unhealthy?" or
+	// "how far is this Bot above the group mean?"
+	//
+	// Group level Aggregates are stored in BotGroup.AggregateValues and are available to every Bot's evaluations by
+	// their Name.  Peer relative Aggregates (ZScore, Rank) are stored in each Bot.VariableValues by their Name.
+	//
+	// Count and CountInState do not need a Variable.  Every other type is calculated from the Variable values of all
+	// the Bots that have that Variable.
+	BotGroupAggregate struct {
+		Name       string                `json:"name"`
+		Info       string                `json:"info"`
+		Type       BotGroupAggregateType `json:"type"`
+		Variable   string                `json:"variable"`   // BotVariable.Name to aggregate
+		Percentile float64               `json:"percentile"` // Only for AggregatePercentile.  0-100
+		State      string                `json:"state"`      // Only for AggregateCountInState.  Formatted as "(State.Name).(Label)", ex: "Operation.Problem"
+		Format     BotVariableFormat     `json:"format"`
+		Export     bool                  `json:"export"` // If true, this aggregate will be exported for Metric collection
 	}
 )
@@ -5,19 +5,23 @@ import "time"
 type (
 	// State Condition is what is considered for execution.  It will receive a Final Score from its Weight and Consideration Final Scores
 	Condition struct {
-		Name               string                   `json:"name"`                 // Name of the Condition
-		Info               string                   `json:"info"`                 // Description
-		IsLaunched         bool                     `json:"is_launched"`          // If false, this will never execute.  Launching means it is configured and ready to run live.  When Conditions are created, is_launched==false and must be changed so that the action could execute.
-		IsDisabled         bool                     `json:"is_disabled"`          // When testing changes, disable with modifying config
-		Weight             float64                  `json:"weight"`               // This is the multiplier for the Final Score, from the Consideration Final Score
-		WeightMin          float64                  `json:"weight_min"`           // If Weight != 0, then this is the Floor value.  We will bump it to this value, if it is less than this value
-		WeightThreshold    float64                  `json:"weight_threshold"`     // If non-0, this is the threshold to be Active, and potentially execute Conditions.  If the Final Score is less than this Threshold, this Condition can never run.  WeightMin and WeightThreshold are independent tests, and will have different results when used together, so take that into consideration.
-		ExecuteRepeatDelay Duration                 `json:"execute_repeat_delay"` // Duration until this Condition can execute again.  If short, this just the problem of double execution if it is 0, which is required.  It can't be 0.  If this is long, this becomes a good way to process other actions instead of this one, because you already tried it recently.
-		RequiredAvailable  Duration                 `json:"required_available"`   // If greater than 0s, this Condition must have been continuously Available for this Duration for it to be executed.  Allows us to make sure it's not flapping or inconsistent for a period of time before being executed
-		RequiredLockTimers []string                 `json:"required_lock_timers"` // All of these Lock Timers must be available for this Condition to trigger.  Afterwards, they will all be locked for ConditionCommand.LockTimerDuration automatically
-		RequiredStates     []string                 `json:"required_states"`      // All of these states must be Active for this
-		Considerations     []ConditionConsideration `json:"considerations"`       // These Considerations are used to create a Score for this Condition, which must be the highest score, and must be higher than the MinimumThreshold, and if all other requirements are met, this Condition will be executed
-		Command            ConditionCommand         `json:"command"`              // This is the command that will be executed.  It could just change States, or run a Command or API call
+		Name                    string                   `json:"name"`                      // Name of the Condition
+		Info                    string                   `json:"info"`                      // Description
+		IsLaunched              bool                     `json:"is_launched"`               // If false, this will never execute.  Launching means it is configured and ready to run live.  When Conditions are created, is_launched==false and must be changed so that the action could execute.
+		IsDisabled              bool                     `json:"is_disabled"`               // When testing changes, disable with modifying config
+		Weight                  float64                  `json:"weight"`                    // This is the multiplier for the Final Score, from the Consideration Final Score
+		WeightMin               float64                  `json:"weight_min"`                // If Weight != 0, then this is the Floor value.  We will bump it to this value, if it is less than this value
+		WeightThreshold         float64                  `json:"weight_threshold"`          // If non-0, this is the threshold to be Active, and potentially execute Conditions.  If the Final Score is less than this Threshold, this Condition can never run.  WeightMin and WeightThreshold are independent tests, and will have different results when used together, so take that into consideration.
+		ExecuteRepeatDelay      Duration                 `json:"execute_repeat_delay"`      // Duration until this Condition can execute again.  If short, this just the problem of double execution if it is 0, which is required.  It can't be 0.  If this is long, this becomes a good way to process other actions instead of this one, because you already tried it recently.
+		RequiredAvailable       Duration                 `json:"required_available"`        // If greater than 0s, this Condition must have been continuously Available for this Duration for it to be executed.  Allows us to make sure it's not flapping or inconsistent for a period of time before being executed
+		WeightThresholdExit     float64                  `json:"weight_threshold_exit"`     // If non-0, once Available, this Condition stays Available until the Final Score is less than this, instead of WeightThreshold.  Set lower than WeightThreshold, so a noisy score doesn't flap around the threshold
+		AvailableWindowRequired int                      `json:"available_window_required"` // If non-0, the score must be over the threshold in this many of the last AvailableWindowSize evaluations to be Available
+		AvailableWindowSize     int                      `json:"available_window_size"`     // Number of evaluations kept for AvailableWindowRequired
+		ScoreSmoothing          float64                  `json:"score_smoothing"`           // If non-0, the Final Score is smoothed with an EWMA.  0-1, the weight of the newest score, so lower is smoother
+		RequiredLockTimers      []string                 `json:"required_lock_timers"`      // All of these Lock Timers must be available for this Condition to trigger.  Afterwards, they will all be locked for ConditionCommand.LockTimerDuration automatically
+		RequiredStates          []string                 `json:"required_states"`           // All of these states must be Active for this.  Prefix with "!" to require a State is not Active.  Prefix with "(BotGroup.Name):" to test if any Bot in a BotGroup.DependsOn BotGroup has the State, ex: "!Database:Operation.Problem"
+		Considerations          []ConditionConsideration `json:"considerations"`            // These Considerations are used to create a Score for this Condition, which must be the highest score, and must be higher than the MinimumThreshold, and if all other requirements are met, this Condition will be executed
+		Command                 ConditionCommand         `json:"command"`                   // This is the command that will be executed.  It could just change States, or run a Command or API call
 	}
 )
 
@@ -30,7 +34,7 @@ type (
 		CurveName  string  `json:"curve"`
 		RangeStart float64 `json:"range_start"`
 		RangeEnd   float64 `json:"range_end"`
-		Evaluate   string  `json:"evaluate"`
+		Evaluate   string  `json:"evaluate"` // govaluate expression with the Bot's variables.  Functions: min, max, abs, clamp, log, pow, if, coalesce, has("var"), in_state("State.Label")
 	}
 )
 
@@ -1,17 +1,27 @@
 package data
 
+import "time"
+
 type (
 	// Web App server configuration
 	AppConfig struct {
+		IncludePaths                      []string `json:"-"`                                    // Paths of the files included by this config, so they are watched for reloads
 		WebHttpPort                       int      `json:"web_http_port"`                        // HTTP port to listen for this server.  TODO(ghowland): Built-in HTTPS
 		WebPath                           string   `json:"web_path"`                             // Path to the Handlebars template content.  Holds *.hbs files
-		SiteConfigPath                    string   `json:"site_config_path"`                     // Path to the config.yaml file that contains a Site.  For now only 1, but later will make this dynamic
-		CurvePathFormat                   string   `json:"curve_path_format"`                    // String to format for each of the Curve JSON files, that contain the points we use to calculate from a curve
+		SiteConfigPaths                   []string `json:"site_config_paths"`                    // Paths to all the Site configs, JSON or YAML.  Each Site has its own QueryServers, BotGroups, caches and sessions.  If empty, SiteConfigPath is used
+		SiteConfigPath                    string   `json:"site_config_path"`                     // Path to the config file that contains a Site, for a single Site.  Use SiteConfigPaths for multiple Sites
+		CurvePathFormat                   string   `json:"curve_path_format"`                    // String to format for each of the Curve JSON files, that contain the points we use to calculate from a curve.  A YAML file with the same name is used if the JSON file does not exist
 		ServerLoopDelay                   Duration `json:"server_loop_delay"`                    // After running the server loop, how long to delay, so we aren't in full spin lock.  This should be short like "0.8s"
+		ConfigWatchInterval               Duration `json:"config_watch_interval"`                // If over 0, the AppConfig, Site and BotGroup config files are checked for changes at this interval, and reloaded when changed
 		QueryLockTimeout                  Duration `json:"query_lock_timeout"`                   // We run Queries in the background, if they run longer than this, clear the lock.  This should be a longer time, like "60s".  TODO(ghowland): Pass in custom contexts and cancel them?  Better to really control it.
+		QueryRecordPath                   string   `json:"query_record_path"`                    // If set, every query response is appended to this QueryRecord archive, which a ServerType=Replay QueryServer can replay
+		QueryRecordMaxBytes               int64    `json:"query_record_max_bytes"`               // If over 0, the QueryRecordPath archive is rotated to "(QueryRecordPath).1" before it grows over this size, replacing the previous rotation.  0 grows without limit
 		QueryFastInternal                 Duration `json:"query_fast_interval"`                  // BotQuery.Interval is overridden when users interact with the app, so they get fast interactive responses
 		QueryFastDuration                 Duration `json:"query_fast_duration"`                  // Duration QueryFastInterval is maintained after the last user interaction
 		InteractiveSessionTimeout         Duration `json:"interactive_session_timeout"`          // Duration an InteractiveSession is kept until it is assumed finished, and can be purged
+		SessionJanitorInterval            Duration `json:"session_janitor_interval"`             // How often expired InteractiveSessions are purged and the QueryResultPool caps are enforced
+		QueryResultPoolMaxItems           int      `json:"query_result_pool_max_items"`          // If over 0, the least recently used QueryResultPoolItems are evicted over this count
+		QueryResultPoolMaxBytes           int64    `json:"query_result_pool_max_bytes"`          // If over 0, the least recently used QueryResultPoolItems are evicted over this estimated memory size
 		InteractiveDurationMinutesDefault int      `json:"interactive_duration_minutes_default"` // How many minutes we default to starting the interactive query to.  15 minutes is reasonable
 		PrometheusExportPort              int      `json:"prometheus_export_port"`               // Port used to listen for the Prometheus Exporter data we will put back into Prometheus.  For the main application, and the demo, if it is enabled
 		EnableDemo                        bool     `json:"enable_demo"`                          // If true, the demo will be enabled and will export additional metrics to Prometheus to make learning Sireus easier.  The demo shares the PrometheusExportPort for simplicity
@@ -20,3 +30,41 @@ type (
 		LogTemplateParsing                bool     `json:"log_template_parsing"`                 // For web development debugging, if true this will print out all the templates that are parsed.  It's not generally useful, but if you are having a problem with Handlebars template imports or related it can help
 	}
 )
+
+type (
+	// AppConfig values set on the command line, which override the config file.  They are applied every time the
+	// config is loaded.  Zero values are not overridden
+	AppConfigOverrides struct {
+		WebHttpPort          int  // Overrides AppConfig.WebHttpPort
+		PrometheusExportPort int  // Overrides AppConfig.PrometheusExportPort
+		DemoApiPort          int  // Overrides AppConfig.DemoApiPort
+		DisableDemo          bool // Overrides AppConfig.EnableDemo to false
+	}
+)
+
+type (
+	// Result of a config reload.  Changes is a human-readable diff of the config and of the live Bot States that had to
+	// be remapped, which is also logged
+	ConfigReloadResult struct {
+		Time    time.Time `json:"time"`
+		Reason  string    `json:"reason"` // What requested the reload, ex: "SIGHUP", "API", "File Watch"
+		Success bool      `json:"success"`
+		Errors  []string  `json:"errors"`  // Validation errors, if the reload was refused.  The running config is not changed
+		Changes []string  `json:"changes"` // What changed, ex: "BotGroup App: Added Condition: Restart"
+	}
+)
+
+type (
+	// A config error found by validation, with the file and JSON path of the bad value, so every error can be fixed at
+	// once.  JsonPath is formatted like "$.actions[2].considerations[0].curve"
+	ConfigValidationError struct {
+		Path     string `json:"path"`      // Config file path
+		JsonPath string `json:"json_path"` // JSON path of the bad value in the file
+		Message  string `json:"message"`   // What is wrong
+	}
+)
+
+// Format the ConfigValidationError for human readability, ex: "config/bot_groups/app.json: $.queries[0]: Missing"
+func (cve ConfigValidationError) String() string {
+	return cve.Path + ": " + cve.JsonPath + ": " + cve.Message
+}
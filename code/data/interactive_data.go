@@ -15,6 +15,16 @@ type (
 	InteractiveSessionPool struct {
 		Sessions   map[SessionUUID]InteractiveSession // All our current InteractiveSession data, key on UUID, for tracking users testing scoring or config changes through the web app.  Will store an addition set of BotQuery items per BotGroup overridden
 		AccessLock sync.RWMutex                       // Lock for safe goroutine access to Sesssions map
+		JanitorRun time.Time                          // Last time app.RunSessionJanitor() expired sessions and evicted the QueryResultPool
+	}
+)
+
+type (
+	// BotGroups users are watching in the web app.  Their BotQuery items use AppConfig.QueryFastInterval until
+	// AppConfig.QueryFastDuration passes since the last interaction, so pages are live during an incident
+	BotGroupWatchPool struct {
+		Watched    map[string]time.Time // Key=BotGroup.Name, Value=Time of the last web app interaction
+		AccessLock sync.RWMutex         // Lock for safe goroutine access to Watched map
 	}
 )
 
@@ -22,6 +32,7 @@ type (
 	// An InteractiveSession is created when a Web App user wants to look at how their Actions would score at a previous time, or if there were different Bot.VariableValues or an Action.Weight or ActionConsideration was different
 	InteractiveSession struct {
 		UUID                     SessionUUID `json:"uuid"`             // This is the unique identifier for this InteractiveSession, and cannot be 0.  0 is used by the normal server processes for performing queries.
+		TimeCreated              time.Time   `json:"time_created"`     // Time this InteractiveSession was created, to show its age
 		TimeRequested            time.Time   `json:"time_requested"`   // This is the last time we received a request from this InteractiveSession.  When it passes the AppConfig.InteractiveSessionTimeout duration it will be removed
 		QueryStartTime           time.Time   `json:"query_start_time"` // Time to make all our queries, so that we can interactively look into past data and reply how actions would be scored with the current config (base and OverrideData)
 		QueryDuration            Duration    `json:"query_duration"`   // Duration to query past QueryStartTime
@@ -31,6 +42,23 @@ type (
 		IgnoreCacheQueryMismatch bool        // For Interactive sessions using the QueryStartTime and QueryDuration, this is true
 		IgnoreCacheOverInterval  bool        // For Production sessions, this is true
 		LastExecuteActionTime    time.Time   // The most recent time we executed an Action.  We want to be able to delay these through configuration
+		IsBacktest               bool        // If true, this session replays historical data.  Commands are never sent and Metrics are not exported
+		SimulatedTime            time.Time   // If set, this is "now" for the session, instead of the wall clock.  Used by backtests to step through time.  See app.GetSessionTimeNow()
+	}
+)
+
+type (
+	// Summary of an InteractiveSession for the Sessions page, with the QueryResultPool items it holds
+	InteractiveSessionInfo struct {
+		UUID           SessionUUID `json:"uuid"`
+		IsProduction   bool        `json:"is_production"`    // UUID==0 is production, and is never expired or terminated
+		TimeCreated    time.Time   `json:"time_created"`     // See InteractiveSession.TimeCreated
+		TimeRequested  time.Time   `json:"time_requested"`   // See InteractiveSession.TimeRequested
+		TimeExpires    time.Time   `json:"time_expires"`     // TimeRequested + AppConfig.InteractiveSessionTimeout
+		QueryStartTime time.Time   `json:"query_start_time"` // Start of the session's time window
+		QueryDuration  Duration    `json:"query_duration"`   // Duration of the session's time window
+		QueryItems     int         `json:"query_items"`      // Count of QueryResultPoolItem cached for this session
+		MemoryBytes    int64       `json:"memory_bytes"`     // Estimated memory of the QueryResultPoolItems cached for this session
 	}
 )
 
@@ -22,11 +22,14 @@ type (
 	// Response from Prometheus.  I made a short-hand version of this instead of using the one from Prometheus for convenience.
 	PrometheusResponse struct {
 		Status       string                 `json:"status"`
+		ErrorType    string                 `json:"errorType"` // Set when Status is "error"
+		Error        string                 `json:"error"`     // Set when Status is "error"
 		Data         PrometheusResponseData `json:"data"`
 		RequestURL   string                 // Keep this, we can always verify exactly what was requested
 		RequestTime  time.Time              // When the Request was made
 		ResponseTime time.Time              // When the Response was received
 		IsError      bool                   // If there was an error
 		ErrorMessage string                 // Error message
+		IsRetryable  bool                   // If the error may succeed when retried
 	}
 )
@@ -0,0 +1,42 @@
+package data
+
+import "time"
+
+type (
+	// QueryResponse is the normalized response from any QueryServerType.  Every QueryBackend converts its source data
+	// into series of labels and samples, so Bot extraction and BotVariable mapping work the same for all of them.
+	QueryResponse struct {
+		Series       []QuerySeries `json:"series"`
+		RequestURL   string        `json:"request_url"`   // Keep this, we can always verify exactly what was requested
+		RequestTime  time.Time     `json:"request_time"`  // When the Request was made
+		ResponseTime time.Time     `json:"response_time"` // When the Response was received
+		IsError      bool          `json:"is_error"`      // If there was an error
+		ErrorMessage string        `json:"error_message"` // Error message
+		IsRetryable  bool          `json:"is_retryable"`  // If the error may succeed when retried, ex: timeouts, connection errors, 5xx.  Bad queries are not retryable
+	}
+)
+
+type (
+	// A single series in a QueryResponse.  Labels are matched with BotExtractor.Key, BotVariable.BotKey and BotVariable.QueryKey
+	QuerySeries struct {
+		Labels  map[string]string `json:"labels"`
+		Samples []QuerySample     `json:"samples"` // In time order.  Only valid values, NaN and Inf samples are dropped so they are missing
+	}
+)
+
+type (
+	// A single value in a QuerySeries
+	QuerySample struct {
+		Time  time.Time `json:"time"`
+		Value float64   `json:"value"`
+	}
+)
+
+type (
+	// A series in a QueryServerType=File JSON file.  BotQuery.Query selects the series by its Query
+	FileQuerySeries struct {
+		Query   string            `json:"query"`
+		Labels  map[string]string `json:"labels"`
+		Samples []QuerySample     `json:"samples"`
+	}
+)
@@ -12,18 +12,42 @@ type (
 	// Inside a QueryServer, all QueryNames must be unique for any BotGroup, so that they can potentially be shared
 	// to reduce QueryServer traffic.  Keep this in mind when creating BotGroup.Queries.
 	QueryServer struct {
-		ServerType          QueryServerType `json:"server_type"`
-		Name                string          `json:"name"`
-		Info                string          `json:"info"`
-		Host                string          `json:"host"`
-		Port                int             `json:"port"`
-		AuthUser            string          `json:"auth_user"`
-		AuthSecret          string          `json:"auth_secret"`
-		DefaultStep         string          `json:"default_step"`
-		DefaultDataDuration Duration        `json:"default_data_duration"`
-		WebUrlFormat        string          `json:"web_url_format"`
+		ServerType              QueryServerType   `json:"server_type"`
+		Name                    string            `json:"name"`
+		SiteName                string            `json:"-"` // Site.Name this QueryServer is in, so its health, stats and limits are kept per Site.  Set at config load
+		Info                    string            `json:"info"`
+		Host                    string            `json:"host"`
+		Port                    int               `json:"port"`
+		UseTLS                  bool              `json:"use_tls"`   // Connect with HTTPS
+		AuthType                QueryAuthType     `json:"auth_type"` // How to authenticate with the QueryServer
+		AuthUser                string            `json:"auth_user"`
+		AuthSecret              string            `json:"auth_secret"`               // Password or token.  Prefer AuthSecretEnv or AuthSecretFile, so secrets aren't in the config
+		AuthSecretEnv           string            `json:"auth_secret_env"`           // Environment variable with the AuthSecret
+		AuthSecretFile          string            `json:"auth_secret_file"`          // File with the AuthSecret, ex: a mounted Kubernetes secret
+		Headers                 map[string]string `json:"headers"`                   // Headers added to every request, ex: {"X-Scope-OrgID": "ops"}
+		HeadersEnv              map[string]string `json:"headers_env"`               // Headers with their value from an environment variable.  Key=Header, Value=Environment Variable
+		HeadersFile             map[string]string `json:"headers_file"`              // Headers with their value from a file.  Key=Header, Value=Path
+		TlsCaFile               string            `json:"tls_ca_file"`               // PEM CA certificates to verify the server, instead of the system CAs
+		TlsCertFile             string            `json:"tls_cert_file"`             // PEM client certificate, with TlsKeyFile
+		TlsKeyFile              string            `json:"tls_key_file"`              // PEM client key, with TlsCertFile
+		TlsServerName           string            `json:"tls_server_name"`           // Server name to verify, if it is different from Host
+		TlsSkipVerify           bool              `json:"tls_skip_verify"`           // Don't verify the server certificate.  Only for testing
+		QueryTimeout            Duration          `json:"query_timeout"`             // Timeout for each query attempt.  Default: 30s
+		MaxConcurrentQueries    int               `json:"max_concurrent_queries"`    // Queries running at once to this QueryServer, the rest wait.  Default: 4
+		RetryCount              int               `json:"retry_count"`               // Retries after a failed query attempt, if the error can be retried
+		RetryBackoff            Duration          `json:"retry_backoff"`             // Delay before the first retry, doubled for each retry.  Default: 0.5s
+		CircuitFailureThreshold int               `json:"circuit_failure_threshold"` // Failed queries in a row before the QueryServer is unhealthy, and its circuit opens.  Default: 5
+		CircuitOpenDuration     Duration          `json:"circuit_open_duration"`     // While the circuit is open, queries fail immediately.  After this, a query is tried again.  Default: 30s
+		DefaultStep             string            `json:"default_step"`
+		DefaultDataDuration     Duration          `json:"default_data_duration"`
+		WebUrlFormat            string            `json:"web_url_format"`
+		ReplayPath              string            `json:"replay_path"`  // ServerType=Replay: Path to a QueryRecord archive, written with AppConfig.QueryRecordPath
+		UrlFormat               string            `json:"url_format"`   // ServerType=JsonHttp: Handlebars format for the request URL.  Has: scheme, host, port, query, start, end, start_unix, end_unix, step_seconds
+		JsonMapping             JsonMapping       `json:"json_mapping"` // ServerType=JsonHttp: Maps the JSON response into QuerySeries
+		FilePath                string            `json:"file_path"`    // ServerType=File: Path to a CSV or JSON file with the series
 	}
 )
+
 type (
 	// QueryServerType specifies QueryServer software, defining how we make and parse Query requests
 	QueryServerType int64
@@ -31,6 +55,9 @@ type (
 
 const (
 	Prometheus QueryServerType = iota
+	Replay
+	JsonHttp
+	File
 )
 
 // Format the QueryServerType for human readability
@@ -38,6 +65,50 @@ func (qst QueryServerType) String() string {
 	switch qst {
 	case Prometheus:
 		return "Prometheus"
+	case Replay:
+		return "Replay"
+	case JsonHttp:
+		return "JSON HTTP"
+	case File:
+		return "File"
+	}
+	return "Unknown"
+}
+
+type (
+	// Health of a QueryServer, from its recent queries.  After QueryServer.CircuitFailureThreshold failures in a row
+	// it is unhealthy, and the Bots using it are invalid until it is healthy again.
+	QueryServerHealth struct {
+		Name                string    `json:"name"`
+		IsHealthy           bool      `json:"is_healthy"`
+		ConsecutiveFailures int       `json:"consecutive_failures"`
+		LastError           string    `json:"last_error"`
+		LastSuccess         time.Time `json:"last_success"`
+		LastFailure         time.Time `json:"last_failure"`
+		CircuitOpenUntil    time.Time `json:"circuit_open_until"` // While unhealthy, queries fail immediately until this time, then 1 query is tried
+	}
+)
+
+type (
+	// QueryAuthType specifies how we authenticate with a QueryServer
+	QueryAuthType int64
+)
+
+const (
+	AuthNone QueryAuthType = iota
+	AuthBasic
+	AuthBearer
+)
+
+// Format the QueryAuthType for human readability
+func (qat QueryAuthType) String() string {
+	switch qat {
+	case AuthNone:
+		return "None"
+	case AuthBasic:
+		return "Basic"
+	case AuthBearer:
+		return "Bearer"
 	}
 	return "Unknown"
 }
@@ -60,6 +131,7 @@ type (
 		InteractiveUUID SessionUUID // This is 0 for normal server operation, but when a user wants to look at alternative time queries, this is set to their InteractiveUUID
 		TimeRequested   time.Time   // Time the BotQuery was requested
 		TimeReceived    time.Time   // Time the Response was received
+		TimeAccessed    time.Time   // Time this item was last stored or read, for LRU eviction when the QueryResultPool is over its caps
 		Result          QueryResult // Response from the QueryServer
 		IsValid         bool        // Is the response valid?  If false, it can't be used
 		QueryStartTime  time.Time   // When is the first timestamp this query should get metrics from.  Most important for Interactive sessions
@@ -70,9 +142,63 @@ type (
 type (
 	// A single Query result
 	QueryResult struct {
-		QueryServer        string             // Server this Query came from.  These are stored in Site.QueryServers
-		QueryType          BotQueryType       // Type of the query, for formatting the API request
-		Query              string             // The Query.  We cache off this, so any repeats into the same QueryServer are shared
-		PrometheusResponse PrometheusResponse // The Response.  TODO(ghowland): Abstract this for N data sources
+		QueryServer string        // Server this Query came from.  These are stored in Site.QueryServers
+		QueryType   BotQueryType  // Type of the query, for formatting the API request
+		Query       string        // The Query.  We cache off this, so any repeats into the same QueryServer are shared
+		Response    QueryResponse // The normalized Response, from any QueryServerType
+	}
+)
+
+type (
+	// A recorded QueryResponse, from AppConfig.QueryRecordPath.  Archives are JSON lines, 1 QueryRecord per line, so
+	// they can be appended to while running and replayed with a ServerType=Replay QueryServer
+	QueryRecord struct {
+		QueryServer    string        `json:"query_server"`
+		QueryType      BotQueryType  `json:"query_type"`
+		Query          string        `json:"query"`
+		QueryStartTime time.Time     `json:"query_start_time"` // InteractiveSession.QueryStartTime of the request
+		QueryDuration  Duration      `json:"query_duration"`   // InteractiveSession.QueryDuration of the request
+		Response       QueryResponse `json:"response"`
+	}
+)
+
+type (
+	// Maps a JSON response into QuerySeries with JSONPath.  Supported: $, .key, ['key'], [index] and [*].  LabelsPath,
+	// SamplesPath, TimePath and ValuePath are relative to each series or sample, starting at $
+	JsonMapping struct {
+		SeriesPath  string `json:"series_path"`  // Selects each series, ex: "$.data.result[*]"
+		LabelsPath  string `json:"labels_path"`  // Selects an object of labels in a series, ex: "$.metric"
+		SamplesPath string `json:"samples_path"` // Selects each sample in a series, ex: "$.values[*]"
+		TimePath    string `json:"time_path"`    // Selects the sample time, as Unix seconds or RFC3339, ex: "$[0]"
+		ValuePath   string `json:"value_path"`   // Selects the sample value, as a number or numeric string, ex: "$[1]"
+	}
+)
+
+type (
+	// Statistics for a single Query on a QueryServer, for diagnosing Query problems.  BotQuery with the same Query on
+	// the same QueryServer share results, so they share stats.
+	QueryStats struct {
+		QueryServer   string          `json:"query_server"`
+		Query         string          `json:"query"`
+		QueryCount    int             `json:"query_count"`
+		ErrorCount    int             `json:"error_count"`
+		LastRequest   time.Time       `json:"last_request"`
+		LastSuccess   time.Time       `json:"last_success"`
+		LastError     string          `json:"last_error"` // QueryResponse.ErrorMessage of the last failed query
+		LastErrorTime time.Time       `json:"last_error_time"`
+		LastLatency   Duration        `json:"last_latency"` // Includes retries and waiting for the QueryServer concurrency limit
+		SeriesCount   int             `json:"series_count"` // From the last successful query
+		SampleCount   int             `json:"sample_count"` // From the last successful query
+		Consumers     []QueryConsumer `json:"consumers"`    // Filled in when requested, from the Site BotGroups
+	}
+)
+
+type (
+	// A BotGroup using a Query, with the Variables it populates
+	QueryConsumer struct {
+		BotGroupName   string   `json:"bot_group"`
+		QueryName      string   `json:"query_name"` // BotQuery.Name in this BotGroup
+		IsBotExtractor bool     `json:"is_bot_extractor"`
+		Variables      []string `json:"variables"`
 	}
 )
@@ -0,0 +1,54 @@
+package data
+
+import "time"
+
+type (
+	// A Scenario is a deterministic test of BotGroup configs.  Scripted metric Series are served instead of a real
+	// QueryServer, the BotGroups are run as a Backtest, and the executed Conditions and final States must match Expect
+	Scenario struct {
+		Name          string           `json:"name"`
+		Info          string           `json:"info"`
+		BotGroupPaths []string         `json:"bot_group_paths"` // BotGroup configs, relative to the Scenario file
+		StartTime     time.Time        `json:"start_time"`
+		Step          Duration         `json:"step"`  // Simulated time between each step
+		Steps         int              `json:"steps"` // Number of steps to run
+		Series        []ScenarioSeries `json:"series"`
+		Expect        ScenarioExpect   `json:"expect"`
+	}
+)
+
+type (
+	// A scripted metric series, returned for any BotQuery with the same Query
+	ScenarioSeries struct {
+		Query  string            `json:"query"`  // BotQuery.Query this series is returned for
+		Metric map[string]string `json:"metric"` // Labels, ex: {"job": "app-1"}
+		Values []*float64        `json:"values"` // Value at each step.  null is no sample, so it is missing.  If shorter than Scenario.Steps, the last value repeats
+	}
+)
+
+type (
+	// What must happen when a Scenario runs
+	ScenarioExpect struct {
+		Executions  []ScenarioExecution `json:"executions"`   // Every Condition executed, in order.  Nothing else may execute
+		FinalStates []ScenarioBotStates `json:"final_states"` // States of Bots after the last step
+	}
+)
+
+type (
+	// A Condition expected to execute at a step
+	ScenarioExecution struct {
+		Step          int    `json:"step"`
+		BotGroupName  string `json:"bot_group"`
+		BotName       string `json:"bot"`
+		ConditionName string `json:"condition"`
+	}
+)
+
+type (
+	// The States a Bot is expected to have
+	ScenarioBotStates struct {
+		BotGroupName string   `json:"bot_group"`
+		BotName      string   `json:"bot"`
+		States       []string `json:"states"`
+	}
+)
@@ -9,7 +9,7 @@ type (
 	// SireusServerData is Singleton structure for keeping global state
 	SireusServerData struct {
 		AppConfig     AppConfig            // App Server configuration
-		Site          Site                 // For now, only 1 Site.  Later this will be dynamic
+		Sites         []*Site              // All the Sites, in AppConfig.SiteConfigPaths order.  Each Site runs in its own server loop.  Use ServerLock to access
 		IsQuitting    bool                 // When true, this server is quitting and everything will shut down.  Controls RunUntilContextCancelled()
 		ServerContext context.Context      // Context to quickly cancel all activities
 		ServerLock    sync.RWMutex         // For making changes to the server where we need to lock
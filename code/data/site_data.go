@@ -1,17 +1,26 @@
 package data
 
+import "sync"
+
 type (
 	// Top Level of the data structure.  Site silos all BotGroups and QueryServers, so that we can have multiple Sites
 	// which are using different data sets, and should not share any data with each other.
 	Site struct {
-		Name                    string                 `json:"name"`            // Site name.  Full silo for QueryServers and BotGroups
-		Info                    string                 `json:"info"`            // Description
-		BotGroupPaths           []string               `json:"bot_group_paths"` // Paths to bot_group_name.json configs
-		QueryServers            []QueryServer          `json:"query_servers"`   // List of QueryServers for making BotQuery requests
-		FreezeActions           bool                   // If true, no actions will be taken for this Site.  Allows control of all BotGroups Action execution.
-		QueryResultCache        QueryResultPool        // Per Site, we cache all the BotQuery results here.  Per normal server operation, and per InteractiveSession
-		InteractiveSessionCache InteractiveSessionPool // Per Site, we track web app InteractiveSession data to allow users to make changes and see how they alter the Action scoring.  Sites silo everything, so it would be an anti-feature to allow InteractiveSession data to cross Site boundarie
-		LoadedBotGroups         []BotGroup             // These are just JSON loaded values to be cloned for the InteractiveSesssion.BotGroups, which contain Bots which perform the Action scoring in the active States
-		ProductionControl       InteractiveControl     // This is the config loaded production (UUID=0) version of InteractiveControl.  Storing it here means it doesn't have to keep being generated when needed.
+		Name                    string                   `json:"name"`                // Site name.  Full silo for QueryServers and BotGroups
+		Info                    string                   `json:"info"`                // Description
+		BotGroupPaths           []string                 `json:"bot_group_paths"`     // Paths to bot_group_name.json configs
+		BotGroupInstances       []map[string]interface{} `json:"bot_group_instances"` // BotGroup configs inline in the Site, usually a template "extends", relative to the Site config, and its "params", so one template can be used for many services
+		QueryServers            []QueryServer            `json:"query_servers"`       // List of QueryServers for making BotQuery requests
+		FreezeActions           bool                     // If true, no actions will be taken for this Site.  Allows control of all BotGroups Action execution.
+		QueryResultCache        QueryResultPool          // Per Site, we cache all the BotQuery results here.  Per normal server operation, and per InteractiveSession
+		InteractiveSessionCache InteractiveSessionPool   // Per Site, we track web app InteractiveSession data to allow users to make changes and see how they alter the Action scoring.  Sites silo everything, so it would be an anti-feature to allow InteractiveSession data to cross Site boundarie
+		BotGroupWatches         BotGroupWatchPool        // BotGroups being watched in the web app, which query at AppConfig.QueryFastInterval
+		LoadedBotGroups         []BotGroup               // These are just JSON loaded values to be cloned for the InteractiveSesssion.BotGroups, which contain Bots which perform the Action scoring in the active States
+		ProductionControl       InteractiveControl       // This is the config loaded production (UUID=0) version of InteractiveControl.  Storing it here means it doesn't have to keep being generated when needed.
+		UpdateLock              sync.Mutex               // Held by the Site's server loop while it updates, so a config reload never merges BotGroups in the middle of an update
+		ConfigLock              sync.RWMutex             // Held by a config reload while it replaces the config fields.  Read QueryServers and LoadedBotGroups with app.GetSiteQueryServers() and app.GetSiteLoadedBotGroups()
+		IsRemoved               bool                     // Set when a config reload removes this Site, which stops its server loop
+		ConfigPath              string                   // Path this Site's config was loaded from
+		IncludePaths            []string                 // Paths of the files included by this Site's config, so they are watched for reloads
 	}
 )
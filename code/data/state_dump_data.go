@@ -0,0 +1,33 @@
+package data
+
+import "time"
+
+type (
+	// Snapshot of the Site's BotGroups after running every Query once and the full UpdateSiteBotGroups pipeline.
+	// Created by "sireus dump-state" for local debugging.  Commands are never sent
+	StateDump struct {
+		Site      string              `json:"site"`
+		Time      time.Time           `json:"time"` // Time the Queries were run
+		BotGroups []BotGroupStateDump `json:"bot_groups"`
+		Errors    []string            `json:"errors"` // Query errors.  Bots missing the data are still dumped, with the BotVariable.MissingPolicy applied
+	}
+
+	// State of a BotGroup in a StateDump
+	BotGroupStateDump struct {
+		Name            string             `json:"name"`
+		AggregateValues map[string]float64 `json:"aggregates"` // See BotGroup.AggregateValues
+		Bots            []BotStateDump     `json:"bots"`       // Sorted by Bot.Name
+	}
+
+	// State of a Bot in a StateDump
+	BotStateDump struct {
+		Name                string             `json:"name"`
+		Labels              map[string]string  `json:"labels"`
+		States              []string           `json:"states"`
+		Variables           map[string]float64 `json:"variables"`
+		ConditionScores     map[string]float64 `json:"condition_scores"`     // BotConditionData.FinalScore, key is Condition.Name
+		AvailableConditions []string           `json:"available_conditions"` // Conditions that are IsAvailable, sorted
+		IsInvalid           bool               `json:"is_invalid"`
+		InfoInvalid         string             `json:"info_invalid"`
+	}
+)
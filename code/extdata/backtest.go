@@ -0,0 +1,263 @@
+package extdata
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+const (
+	BacktestMaxQuerySamples = 10000  // Prometheus limits range query results to 11000 samples per series, so long ranges are requested in chunks
+	BacktestMaxSteps        = 100000 // Most pipeline runs in a Backtest.  Backtests run in the request or command, so long ranges at short steps are rejected
+)
+
+// Replay the Site's BotGroups across a historical time range.  Each query is requested once as a range query, and
+// every Step the samples at that time are stored in a private query cache, then the full UpdateSiteBotGroups pipeline
+// runs with the simulated clock.  Commands are never sent, and nothing is shared with the live BotGroups.
+func RunBacktest(site *data.Site, backtest data.Backtest) (data.BacktestResult, error) {
+	result, _, err := RunBacktestSession(site, backtest)
+	return result, err
+}
+
+// Run a Backtest, see RunBacktest(), and also return its private session, so the final Bot data can be checked
+func RunBacktestSession(site *data.Site, backtest data.Backtest) (data.BacktestResult, data.InteractiveSession, error) {
+	result := data.BacktestResult{Backtest: backtest, Timeline: []data.BacktestEvent{}, Errors: []string{}}
+
+	err := ValidateBacktestRange(backtest)
+	if util.Check(err) {
+		return result, data.InteractiveSession{}, err
+	}
+	step := time.Duration(backtest.Step)
+
+	// A config reload can replace these, so the whole Backtest uses the same config
+	queryServers := app.GetSiteQueryServers(site)
+	loadedBotGroups := app.GetSiteLoadedBotGroups(site)
+
+	if backtest.BotGroupName != "" {
+		_, err := app.GetBotGroupFromSlice(loadedBotGroups, backtest.BotGroupName)
+		if util.Check(err) {
+			return result, data.InteractiveSession{}, err
+		}
+	}
+
+	// Private Site and Session, so the live query cache and BotGroups are never modified
+	sessionUUID := data.SessionUUID(uuid.New().ID())
+	backtestSite := &data.Site{
+		Name:            site.Name,
+		Info:            site.Info,
+		QueryServers:    queryServers,
+		LoadedBotGroups: loadedBotGroups,
+		QueryResultCache: data.QueryResultPool{
+			PoolItems:  map[string]data.QueryResultPoolItem{},
+			QueryLocks: map[string]time.Time{},
+		},
+	}
+	session := data.InteractiveSession{
+		UUID:           sessionUUID,
+		IsBacktest:     true,
+		BotGroups:      CopyBotGroupsForBacktest(loadedBotGroups),
+		QueryStartTime: backtest.StartTime,
+		QueryDuration:  data.Duration(backtest.EndTime.Sub(backtest.StartTime)),
+	}
+
+	// Request every query once for the full range
+	rangeResults := make(map[string]data.QueryResponse)
+	for _, botGroup := range session.BotGroups {
+		for _, query := range botGroup.Queries {
+			queryKey := GetQueryKey(&session, query)
+			if _, ok := rangeResults[queryKey]; ok {
+				continue
+			}
+
+			queryServer, err := app.GetQueryServer(backtestSite, query.QueryServer)
+			if util.Check(err) {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+
+			response := QueryRangeChunked(queryServer, query, backtest.StartTime, backtest.EndTime, step)
+			if response.IsError {
+				result.Errors = append(result.Errors, response.ErrorMessage)
+			}
+
+			// Sorted once, so every step can search for its samples
+			for _, series := range response.Series {
+				sort.SliceStable(series.Samples, func(i, j int) bool { return series.Samples[i].Time.Before(series.Samples[j].Time) })
+			}
+			rangeResults[queryKey] = response
+		}
+	}
+
+	// Step through time, giving the pipeline only the samples at the simulated time
+	for simulatedTime := backtest.StartTime; !simulatedTime.After(backtest.EndTime); simulatedTime = simulatedTime.Add(step) {
+		session.SimulatedTime = simulatedTime
+
+		for _, botGroup := range session.BotGroups {
+			for _, query := range botGroup.Queries {
+				response, ok := rangeResults[GetQueryKey(&session, query)]
+				if !ok {
+					continue
+				}
+
+				queryResult := data.QueryResult{
+					QueryServer: query.QueryServer,
+					QueryType:   query.QueryType,
+					Query:       query.Query,
+					Response:    SliceQueryResponseAtTime(response, simulatedTime, step),
+				}
+				StoreQueryResult(&session, backtestSite, query, simulatedTime, queryResult)
+			}
+		}
+
+		UpdateSiteBotGroups(&session, backtestSite)
+		result.Steps++
+	}
+
+	result.Timeline = GetBacktestTimeline(&session, backtest.BotGroupName)
+
+	return result, session, nil
+}
+
+// Returns an error if the Backtest's Step is under 1s, its EndTime isn't after its StartTime, or it would run more than
+// BacktestMaxSteps steps
+func ValidateBacktestRange(backtest data.Backtest) error {
+	step := time.Duration(backtest.Step)
+	if step < time.Second {
+		return errors.New(fmt.Sprintf("Backtest step must be at least 1s: %s", step.String()))
+	}
+	if !backtest.EndTime.After(backtest.StartTime) {
+		return errors.New(fmt.Sprintf("Backtest end time must be after start time: %v - %v", backtest.StartTime, backtest.EndTime))
+	}
+
+	steps := backtest.EndTime.Sub(backtest.StartTime) / step
+	if steps > BacktestMaxSteps {
+		return errors.New(fmt.Sprintf("Backtest has too many steps: %d  Max: %d  Use a larger step or a shorter range", steps, BacktestMaxSteps))
+	}
+
+	return nil
+}
+
+// Returns copies of the BotGroups with no Bots or live data, so a Backtest starts fresh and doesn't modify any
+// slices or maps of the live BotGroups.  LockKeys are kept, util locks are never released, so unique keys would leak.
+func CopyBotGroupsForBacktest(botGroups []data.BotGroup) []data.BotGroup {
+	var copied []data.BotGroup
+
+	for _, botGroup := range botGroups {
+		botGroup.Bots = []data.Bot{}
+		botGroup.AggregateValues = map[string]float64{}
+		botGroup.DependencyValues = map[string]float64{}
+
+		lockTimers := make([]data.BotLockTimer, len(botGroup.LockTimers))
+		copy(lockTimers, botGroup.LockTimers)
+		for index := range lockTimers {
+			lockTimers[index].IsActive = false
+			lockTimers[index].Timeout = time.Time{}
+		}
+		botGroup.LockTimers = lockTimers
+
+		copied = append(copied, botGroup)
+	}
+
+	return copied
+}
+
+// Range query the QueryServer from start to end, in chunks so no series exceeds the sample limit.  The chunks are
+// merged into a single response, with each series' samples in time order.
+func QueryRangeChunked(queryServer data.QueryServer, query data.BotQuery, start time.Time, end time.Time, step time.Duration) data.QueryResponse {
+	merged := data.QueryResponse{Series: []data.QuerySeries{}}
+	seriesIndex := make(map[string]int)
+
+	chunkDuration := step * BacktestMaxQuerySamples
+	for chunkStart := start; !chunkStart.After(end); chunkStart = chunkStart.Add(chunkDuration + step) {
+		duration := chunkDuration
+		if chunkStart.Add(duration).After(end) {
+			duration = end.Sub(chunkStart)
+		}
+
+		response := ExecuteQuery(queryServer, query, chunkStart, duration, step)
+		if response.IsError {
+			return response
+		}
+
+		merged.RequestURL = response.RequestURL
+		if merged.RequestTime.IsZero() {
+			merged.RequestTime = response.RequestTime
+		}
+		merged.ResponseTime = response.ResponseTime
+
+		for _, series := range response.Series {
+			key := GetQuerySeriesKey(series.Labels)
+			index, ok := seriesIndex[key]
+			if !ok {
+				seriesIndex[key] = len(merged.Series)
+				merged.Series = append(merged.Series, series)
+				continue
+			}
+			merged.Series[index].Samples = append(merged.Series[index].Samples, series.Samples...)
+		}
+	}
+
+	return merged
+}
+
+// Returns a copy of a range response with only the latest sample of each series at or before the time, within one
+// step.  Series without a sample in that window are removed, so they are missing at that time.  Each series' Samples
+// must be sorted by time.
+func SliceQueryResponseAtTime(response data.QueryResponse, at time.Time, step time.Duration) data.QueryResponse {
+	sliced := response
+	sliced.Series = []data.QuerySeries{}
+
+	oldest := at.Add(-step)
+
+	for _, series := range response.Series {
+		// Index of the first sample after the time, so the sample before it is the latest
+		index := sort.Search(len(series.Samples), func(i int) bool { return series.Samples[i].Time.After(at) })
+		if index == 0 || series.Samples[index-1].Time.Before(oldest) {
+			continue
+		}
+
+		sliced.Series = append(sliced.Series, data.QuerySeries{
+			Labels:  series.Labels,
+			Samples: []data.QuerySample{series.Samples[index-1]},
+		})
+	}
+
+	return sliced
+}
+
+// Returns every Condition executed in the Backtest session, from the Bot CommandHistory, in time order.  If
+// botGroupName is not empty, only that BotGroup is returned.
+func GetBacktestTimeline(session *data.InteractiveSession, botGroupName string) []data.BacktestEvent {
+	timeline := []data.BacktestEvent{}
+
+	for _, botGroup := range session.BotGroups {
+		if botGroupName != "" && botGroup.Name != botGroupName {
+			continue
+		}
+
+		for _, bot := range botGroup.Bots {
+			for _, commandResult := range bot.CommandHistory {
+				timeline = append(timeline, data.BacktestEvent{
+					Time:          commandResult.Started,
+					BotGroupName:  commandResult.BotGroupName,
+					BotName:       commandResult.BotName,
+					ConditionName: commandResult.ConditionName,
+					Score:         commandResult.Score,
+					StatesBefore:  commandResult.StatesBefore,
+					StatesAfter:   commandResult.StatesAfter,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Time.Before(timeline[j].Time)
+	})
+
+	return timeline
+}
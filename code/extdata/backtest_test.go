@@ -0,0 +1,59 @@
+package extdata
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSliceQueryResponseAtTime(t *testing.T) {
+	response := data.QueryResponse{
+		Series: []data.QuerySeries{
+			{Labels: map[string]string{"job": "a"}, Samples: []data.QuerySample{{Time: time.Unix(100, 0), Value: 1}, {Time: time.Unix(160, 0), Value: 2}, {Time: time.Unix(220, 0), Value: 3}}},
+			{Labels: map[string]string{"job": "b"}, Samples: []data.QuerySample{{Time: time.Unix(100, 0), Value: 5}}},
+		},
+	}
+
+	sliced := SliceQueryResponseAtTime(response, time.Unix(170, 0), 60*time.Second)
+	assert.Len(t, sliced.Series, 1, "Series b has no sample within a step, so it is missing")
+	assert.Equal(t, 2.0, sliced.Series[0].Samples[0].Value)
+
+	sliced = SliceQueryResponseAtTime(response, time.Unix(100, 0), 60*time.Second)
+	assert.Len(t, sliced.Series, 2)
+	assert.Len(t, response.Series[0].Samples, 3, "Original response is not modified")
+}
+
+func TestValidateBacktestRange(t *testing.T) {
+	start := time.Unix(1000, 0)
+	backtest := data.Backtest{StartTime: start, EndTime: start.Add(time.Hour), Step: data.Duration(time.Minute)}
+	assert.Nil(t, ValidateBacktestRange(backtest))
+
+	backtest.Step = data.Duration(time.Millisecond)
+	assert.NotNil(t, ValidateBacktestRange(backtest), "Steps under 1s are rejected")
+
+	backtest.Step = data.Duration(time.Second)
+	backtest.EndTime = start
+	assert.NotNil(t, ValidateBacktestRange(backtest), "End must be after start")
+
+	backtest.EndTime = start.Add(BacktestMaxSteps * time.Second)
+	assert.Nil(t, ValidateBacktestRange(backtest), "BacktestMaxSteps is allowed")
+
+	backtest.EndTime = backtest.EndTime.Add(time.Second)
+	assert.NotNil(t, ValidateBacktestRange(backtest), "Over BacktestMaxSteps is rejected")
+}
+
+func TestCopyBotGroupsForBacktest(t *testing.T) {
+	botGroups := []data.BotGroup{{
+		Name:       "App",
+		Bots:       []data.Bot{{Name: "bot"}},
+		LockTimers: []data.BotLockTimer{{Name: "Lock", IsActive: true}},
+	}}
+
+	copied := CopyBotGroupsForBacktest(botGroups)
+
+	assert.Len(t, copied[0].Bots, 0)
+	assert.False(t, copied[0].LockTimers[0].IsActive)
+	assert.True(t, botGroups[0].LockTimers[0].IsActive, "Live Lock Timers are not modified")
+	assert.Len(t, botGroups[0].Bots, 1)
+}
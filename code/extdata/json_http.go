@@ -0,0 +1,186 @@
+package extdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type (
+	// JsonHttpBackend queries any HTTP endpoint that returns JSON, and maps the JSON into QuerySeries with
+	// QueryServer.JsonMapping
+	JsonHttpBackend struct{}
+)
+
+// Query a JSON HTTP endpoint with QueryServer.UrlFormat
+func (backend JsonHttpBackend) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	requestTime := util.GetTimeNow()
+	requestUrl := GetJsonHttpRequestUrl(queryServer, query, start, duration, step)
+
+	resp, err := QueryServerGet(ctx, queryServer, requestUrl)
+	if util.Check(err) {
+		response := GetQueryResponseError(fmt.Sprintf("Couldn't fetch JSON HTTP URL: %v   URL: %s", err, requestUrl), requestUrl)
+		response.IsRetryable = true
+		log.Printf(response.ErrorMessage)
+		return response
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if util.Check(err) {
+		response := GetQueryResponseError(fmt.Sprintf("Couldn't read JSON HTTP body: %v   URL: %s", err, requestUrl), requestUrl)
+		response.IsRetryable = true
+		log.Printf(response.ErrorMessage)
+		return response
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response := GetQueryResponseError(fmt.Sprintf("JSON HTTP status: %s   URL: %s", resp.Status, requestUrl), requestUrl)
+		response.IsRetryable = IsHttpStatusRetryable(resp.StatusCode)
+		log.Printf(response.ErrorMessage)
+		return response
+	}
+
+	var document interface{}
+	err = json.Unmarshal(body, &document)
+	if util.Check(err) {
+		response := GetQueryResponseError(fmt.Sprintf("Couldn't unmarshall JSON: %v   URL: %s", err, requestUrl), requestUrl)
+		log.Printf(response.ErrorMessage)
+		return response
+	}
+
+	series, err := MapJsonSeries(document, queryServer.JsonMapping)
+	if util.Check(err) {
+		response := GetQueryResponseError(fmt.Sprintf("Couldn't map JSON: %v   URL: %s", err, requestUrl), requestUrl)
+		log.Printf(response.ErrorMessage)
+		return response
+	}
+
+	return data.QueryResponse{
+		Series:       series,
+		RequestURL:   requestUrl,
+		RequestTime:  requestTime,
+		ResponseTime: util.GetTimeNow(),
+	}
+}
+
+// Format the QueryServer.UrlFormat for this query
+func GetJsonHttpRequestUrl(queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) string {
+	end := start.Add(duration)
+
+	formatMap := map[string]string{
+		"scheme":       GetQueryServerScheme(queryServer),
+		"host":         queryServer.Host,
+		"port":         strconv.Itoa(queryServer.Port),
+		"query":        url.QueryEscape(query.Query),
+		"start":        start.UTC().Format(time.RFC3339),
+		"end":          end.UTC().Format(time.RFC3339),
+		"start_unix":   strconv.FormatInt(start.Unix(), 10),
+		"end_unix":     strconv.FormatInt(end.Unix(), 10),
+		"step_seconds": strconv.FormatInt(int64(step.Seconds()), 10),
+	}
+
+	return util.HandlebarFormatText(queryServer.UrlFormat, formatMap)
+}
+
+// Map a decoded JSON document into QuerySeries with the JsonMapping.  Samples with a missing or invalid time or value
+// are dropped, so they are missing
+func MapJsonSeries(document interface{}, mapping data.JsonMapping) ([]data.QuerySeries, error) {
+	seriesList := []data.QuerySeries{}
+
+	seriesItems, err := util.JsonPathSelect(document, mapping.SeriesPath)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	for _, seriesItem := range seriesItems {
+		series := data.QuerySeries{Labels: map[string]string{}, Samples: []data.QuerySample{}}
+
+		if mapping.LabelsPath != "" {
+			labelItems, err := util.JsonPathSelect(seriesItem, mapping.LabelsPath)
+			if util.Check(err) {
+				return nil, err
+			}
+			for _, labelItem := range labelItems {
+				labels, ok := labelItem.(map[string]interface{})
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("Labels are not an object: %s", mapping.LabelsPath))
+				}
+				for key, value := range labels {
+					series.Labels[key] = fmt.Sprintf("%v", value)
+				}
+			}
+		}
+
+		sampleItems, err := util.JsonPathSelect(seriesItem, mapping.SamplesPath)
+		if util.Check(err) {
+			return nil, err
+		}
+
+		for _, sampleItem := range sampleItems {
+			sample, ok, err := MapJsonSample(sampleItem, mapping)
+			if util.Check(err) {
+				return nil, err
+			}
+			if ok {
+				series.Samples = append(series.Samples, sample)
+			}
+		}
+
+		seriesList = append(seriesList, series)
+	}
+
+	return seriesList, nil
+}
+
+// Map a single JSON sample with the JsonMapping TimePath and ValuePath.  Returns false if it isn't a valid sample
+func MapJsonSample(sampleItem interface{}, mapping data.JsonMapping) (data.QuerySample, bool, error) {
+	timeItems, err := util.JsonPathSelect(sampleItem, mapping.TimePath)
+	if util.Check(err) {
+		return data.QuerySample{}, false, err
+	}
+	valueItems, err := util.JsonPathSelect(sampleItem, mapping.ValuePath)
+	if util.Check(err) {
+		return data.QuerySample{}, false, err
+	}
+	if len(timeItems) == 0 || len(valueItems) == 0 {
+		return data.QuerySample{}, false, nil
+	}
+
+	sampleTime, ok := GetSampleTimeValue(timeItems[0])
+	if !ok {
+		return data.QuerySample{}, false, nil
+	}
+
+	value, ok := GetSampleValue(valueItems[0])
+	if !ok {
+		return data.QuerySample{}, false, nil
+	}
+
+	return data.QuerySample{Time: sampleTime, Value: value}, true, nil
+}
+
+// Returns a sample time from Unix seconds, as a number or numeric string, or an RFC3339 string
+func GetSampleTimeValue(timeValue interface{}) (time.Time, bool) {
+	if text, ok := timeValue.(string); ok {
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err == nil {
+			return parsed.UTC(), true
+		}
+	}
+
+	sampleSeconds, ok := GetSampleValue(timeValue)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return GetSampleTime(sampleSeconds), true
+}
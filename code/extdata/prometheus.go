@@ -1,19 +1,32 @@
 package extdata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/util"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// Query the Prometheus metric server
-func QueryPrometheus(host string, port int, queryType data.BotQueryType, query string, timeStart time.Time, duration time.Duration) data.PrometheusResponse {
+const (
+	PrometheusQueryStep = 15 * time.Second // Step between samples for normal range queries
+)
+
+type (
+	// PrometheusBackend queries a Prometheus server over HTTP
+	PrometheusBackend struct{}
+)
+
+// Query the Prometheus metric server.  step is the duration between the samples returned
+func QueryPrometheus(ctx context.Context, queryServer data.QueryServer, queryType data.BotQueryType, query string, timeStart time.Time, duration time.Duration, step time.Duration) data.PrometheusResponse {
 	queryStartTime := util.GetTimeNow()
 
 	start := timeStart.UTC().Format(time.RFC3339)
@@ -22,7 +35,7 @@ func QueryPrometheus(host string, port int, queryType data.BotQueryType, query s
 
 	end := timeStart.UTC().Add(time.Second * time.Duration(durationSeconds)).Format(time.RFC3339)
 
-	requestUrl := fmt.Sprintf("http://%s:%d/api/v1/%s?query=%s&start=%s&end=%s&step=15s", host, port, queryType.String(), url.QueryEscape(query), start, end)
+	requestUrl := fmt.Sprintf("%s/api/v1/%s?query=%s&start=%s&end=%s&step=%ds", GetQueryServerBaseUrl(queryServer), queryType.String(), url.QueryEscape(query), start, end, int64(step.Seconds()))
 
 	var jsonResponse data.PrometheusResponse
 
@@ -31,23 +44,38 @@ func QueryPrometheus(host string, port int, queryType data.BotQueryType, query s
 	jsonResponse.RequestTime = queryStartTime
 	jsonResponse.ResponseTime = util.GetTimeNow()
 
-	resp, err := http.Get(requestUrl)
+	resp, err := QueryServerGet(ctx, queryServer, requestUrl)
 	if util.Check(err) {
 		jsonResponse.IsError = true
+		jsonResponse.IsRetryable = true
 		jsonResponse.ErrorMessage = fmt.Sprintf("Couldn't fetch Prometheus URL: %v   URL: %s", err, requestUrl)
 		log.Printf(jsonResponse.ErrorMessage)
 		return jsonResponse
 	}
+	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	util.CheckLog(err)
 	if util.Check(err) {
 		jsonResponse.IsError = true
+		jsonResponse.IsRetryable = true
 		jsonResponse.ErrorMessage = fmt.Sprintf("Couldn't read Prometheus body: %v   URL: %s", err, requestUrl)
 		log.Printf(jsonResponse.ErrorMessage)
 		return jsonResponse
 	}
 
+	jsonResponse.ResponseTime = util.GetTimeNow()
+
+	// Prometheus returns JSON errors for bad queries, but proxies return their own error pages, so check the status first
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_ = json.Unmarshal(body, &jsonResponse)
+		jsonResponse.IsError = true
+		jsonResponse.IsRetryable = IsHttpStatusRetryable(resp.StatusCode)
+		jsonResponse.ErrorMessage = fmt.Sprintf("Prometheus HTTP status: %s  Error: %s   URL: %s", resp.Status, jsonResponse.Error, requestUrl)
+		log.Printf(jsonResponse.ErrorMessage)
+		return jsonResponse
+	}
+
 	err = json.Unmarshal(body, &jsonResponse)
 	util.CheckLog(err)
 	if util.Check(err) {
@@ -57,34 +85,93 @@ func QueryPrometheus(host string, port int, queryType data.BotQueryType, query s
 		return jsonResponse
 	}
 
+	// Only "success" has data.  Warnings still have status "success"
+	if jsonResponse.Status != "success" {
+		jsonResponse.IsError = true
+		jsonResponse.ErrorMessage = fmt.Sprintf("Prometheus status: %s  Error Type: %s  Error: %s   URL: %s", jsonResponse.Status, jsonResponse.ErrorType, jsonResponse.Error, requestUrl)
+		log.Printf(jsonResponse.ErrorMessage)
+		return jsonResponse
+	}
+
 	return jsonResponse
 }
 
-// Extract our ephemeral Bots from the Prometheus response, using the BotKey extractor information
-func ExtractBotsFromPromData(response data.PrometheusResponse, botGroup *data.BotGroup) []data.Bot {
-	bots := make(map[string]data.Bot)
-
-	for _, resultItem := range response.Data.Result {
-		name := resultItem.Metric[botGroup.BotExtractor.Key]
-
-		_, exists := bots[name]
-		if !exists {
-			bots[name] = data.Bot{
-				Name:           name,
-				LockKey:        fmt.Sprintf("%s.%s", botGroup.LockKey, name),
-				ConditionData:  map[string]data.BotConditionData{},
-				StateValues:    []string{},
-				VariableValues: map[string]float64{},
+// Returns true if a request with this HTTP status may succeed when retried.  Client errors are bad requests, and
+// retrying them only adds load, except for rate limiting
+func IsHttpStatusRetryable(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+}
+
+// Query Prometheus and normalize the response
+func (backend PrometheusBackend) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	return NormalizePrometheusResponse(QueryPrometheus(ctx, queryServer, query.QueryType, query.Query, start, duration, step))
+}
+
+// Convert a PrometheusResponse into a QueryResponse.  Samples that aren't valid numbers, NaN or Inf are dropped, so
+// they are missing
+func NormalizePrometheusResponse(response data.PrometheusResponse) data.QueryResponse {
+	normalized := data.QueryResponse{
+		Series:       []data.QuerySeries{},
+		RequestURL:   response.RequestURL,
+		RequestTime:  response.RequestTime,
+		ResponseTime: response.ResponseTime,
+		IsError:      response.IsError,
+		ErrorMessage: response.ErrorMessage,
+		IsRetryable:  response.IsRetryable,
+	}
+
+	for _, result := range response.Data.Result {
+		series := data.QuerySeries{Labels: result.Metric, Samples: []data.QuerySample{}}
+
+		for _, sample := range result.Values {
+			if len(sample) < 2 {
+				continue
+			}
+
+			sampleSeconds, ok := sample[0].(float64)
+			if !ok {
+				continue
+			}
+
+			value, ok := GetSampleValue(sample[1])
+			if !ok {
+				continue
 			}
+
+			series.Samples = append(series.Samples, data.QuerySample{Time: GetSampleTime(sampleSeconds), Value: value})
 		}
+
+		normalized.Series = append(normalized.Series, series)
 	}
 
-	// Add all the bots to a final array.  The map allowed us to ensure no duplicate entries, as that is allowed.
-	var botArray []data.Bot
-	for _, bot := range bots {
-		botArray = append(botArray, bot)
+	return normalized
+}
+
+// Returns a sample value from a number or numeric string.  Returns false if it is not a number, or is NaN or Inf
+func GetSampleValue(sampleValue interface{}) (float64, bool) {
+	var value float64
+
+	switch typed := sampleValue.(type) {
+	case float64:
+		value = typed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(typed), 64)
+		if util.Check(err) {
+			return 0, false
+		}
+		value = parsed
+	default:
+		return 0, false
 	}
 
-	//log.Print("Bots: ", botArray)
-	return botArray
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+
+	return value, true
+}
+
+// Returns the time of a sample's Unix seconds
+func GetSampleTime(sampleSeconds float64) time.Time {
+	return time.UnixMilli(int64(math.Round(sampleSeconds * 1000))).UTC()
 }
@@ -0,0 +1,84 @@
+package extdata
+
+import (
+	"context"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"time"
+)
+
+type (
+	// QueryBackend makes BotQuery requests to a QueryServer, and normalizes the response into QuerySeries, so the
+	// rest of Sireus doesn't depend on the data source
+	QueryBackend interface {
+		Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse
+	}
+)
+
+type (
+	// QueryServerClient queries each QueryServer with the QueryBackend for its ServerType.  This is the default
+	// ActiveQueryClient
+	QueryServerClient struct{}
+)
+
+var (
+	// QueryBackend for each QueryServerType
+	QueryBackends = map[data.QueryServerType]QueryBackend{
+		data.Prometheus: PrometheusBackend{},
+		data.Replay:     ReplayBackend{},
+		data.JsonHttp:   JsonHttpBackend{},
+		data.File:       FileBackend{},
+	}
+
+	// All queries go through the ActiveQueryClient, so tests can replace it with scripted results
+	ActiveQueryClient QueryBackend = QueryServerClient{}
+)
+
+// Replace the ActiveQueryClient.  Returns the previous QueryBackend, so it can be restored
+func SetQueryClient(queryClient QueryBackend) QueryBackend {
+	previous := ActiveQueryClient
+	ActiveQueryClient = queryClient
+	return previous
+}
+
+// Query the QueryServer with the QueryBackend for its ServerType
+func (client QueryServerClient) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	backend, ok := QueryBackends[queryServer.ServerType]
+	if !ok {
+		return GetQueryResponseError(fmt.Sprintf("Unknown Query Server Type: %d  Query Server: %s", queryServer.ServerType, queryServer.Name), "")
+	}
+
+	return backend.Query(ctx, queryServer, query, start, duration, step)
+}
+
+// Returns a QueryResponse with an error
+func GetQueryResponseError(message string, requestUrl string) data.QueryResponse {
+	return data.QueryResponse{
+		Series:       []data.QuerySeries{},
+		RequestURL:   requestUrl,
+		RequestTime:  util.GetTimeNow(),
+		ResponseTime: util.GetTimeNow(),
+		IsError:      true,
+		ErrorMessage: message,
+	}
+}
+
+// Returns a copy of the QuerySeries with only the samples from start to end, inclusive
+func GetQuerySeriesInRange(series data.QuerySeries, start time.Time, end time.Time) data.QuerySeries {
+	ranged := data.QuerySeries{Labels: series.Labels, Samples: []data.QuerySample{}}
+
+	for _, sample := range series.Samples {
+		if sample.Time.Before(start) || sample.Time.After(end) {
+			continue
+		}
+		ranged.Samples = append(ranged.Samples, sample)
+	}
+
+	return ranged
+}
+
+// Returns the key for a series, from its sorted labels, so the same series can be found across responses
+func GetQuerySeriesKey(labels map[string]string) string {
+	return util.PrintJsonData(labels)
+}
@@ -0,0 +1,84 @@
+package extdata
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalizePrometheusResponse(t *testing.T) {
+	response := data.PrometheusResponse{
+		Data: data.PrometheusResponseData{
+			Result: []data.PrometheusResponseDataResult{
+				{Metric: map[string]string{"job": "a"}, Values: [][]interface{}{{100.0, "1.5"}, {115.0, "NaN"}, {130.0, "+Inf"}, {145.0, "2"}}},
+			},
+		},
+	}
+
+	normalized := NormalizePrometheusResponse(response)
+	assert.Len(t, normalized.Series, 1)
+	assert.Equal(t, "a", normalized.Series[0].Labels["job"])
+	assert.Equal(t, []float64{1.5, 2}, GetSampleValues(normalized.Series[0]), "NaN and Inf samples are missing")
+	assert.Equal(t, int64(145), normalized.Series[0].Samples[1].Time.Unix())
+}
+
+func TestMapJsonSeries(t *testing.T) {
+	body := `{"results": [
+		{"tags": {"host": "db-1", "port": 5432}, "points": [{"ts": 100, "v": 3}, {"ts": "1970-01-01T00:01:55Z", "v": "4"}, {"ts": 130}]},
+		{"tags": {"host": "db-2"}, "points": []}
+	]}`
+
+	var document interface{}
+	assert.Nil(t, json.Unmarshal([]byte(body), &document))
+
+	mapping := data.JsonMapping{
+		SeriesPath:  "$.results[*]",
+		LabelsPath:  "$.tags",
+		SamplesPath: "$['points'][*]",
+		TimePath:    "$.ts",
+		ValuePath:   "$.v",
+	}
+
+	series, err := MapJsonSeries(document, mapping)
+	assert.Nil(t, err)
+	assert.Len(t, series, 2)
+	assert.Equal(t, map[string]string{"host": "db-1", "port": "5432"}, series[0].Labels)
+	assert.Equal(t, []float64{3, 4}, GetSampleValues(series[0]), "Samples without a value are missing")
+	assert.Equal(t, int64(115), series[0].Samples[1].Time.Unix())
+	assert.Len(t, series[1].Samples, 0)
+
+	mapping.SeriesPath = "results"
+	_, err = MapJsonSeries(document, mapping)
+	assert.NotNil(t, err, "JSONPath must start with $")
+}
+
+func TestFileBackend(t *testing.T) {
+	csvPath := filepath.Join(t.TempDir(), "series.csv")
+	csvData := "query,job,time,value\nwait_queue,db-1,100,1\nwait_queue,db-1,200,2\nwait_queue,db-2,100,x\ntimeouts,db-1,100,7\n"
+	assert.Nil(t, os.WriteFile(csvPath, []byte(csvData), 0644))
+
+	queryServer := data.QueryServer{Name: "file", ServerType: data.File, FilePath: csvPath}
+	response := QueryServerClient{}.Query(context.Background(), queryServer, data.BotQuery{Query: "wait_queue"}, time.Unix(50, 0), 100*time.Second, PrometheusQueryStep)
+	assert.False(t, response.IsError)
+	assert.Len(t, response.Series, 2, "db-2 has no valid samples, but still exists so a Bot is extracted")
+	assert.Equal(t, []float64{1}, GetSampleValues(response.Series[0]), "Samples after the range are not returned")
+	assert.Len(t, response.Series[1].Samples, 0)
+
+	jsonPath := filepath.Join(t.TempDir(), "series.json")
+	jsonData := `[{"query": "wait_queue", "labels": {"job": "db-1"}, "samples": [{"value": 9}]}]`
+	assert.Nil(t, os.WriteFile(jsonPath, []byte(jsonData), 0644))
+
+	queryServer.FilePath = jsonPath
+	response = QueryServerClient{}.Query(context.Background(), queryServer, data.BotQuery{Query: "wait_queue"}, time.Unix(50, 0), 100*time.Second, PrometheusQueryStep)
+	assert.Equal(t, []float64{9}, GetSampleValues(response.Series[0]))
+	assert.Equal(t, int64(150), response.Series[0].Samples[0].Time.Unix(), "Samples without a time are current values")
+
+	queryServer.ServerType = data.QueryServerType(99)
+	response = QueryServerClient{}.Query(context.Background(), queryServer, data.BotQuery{Query: "wait_queue"}, time.Unix(50, 0), 100*time.Second, PrometheusQueryStep)
+	assert.True(t, response.IsError)
+}
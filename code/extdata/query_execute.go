@@ -0,0 +1,212 @@
+package extdata
+
+import (
+	"context"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	QueryTimeoutDefault            = 30 * time.Second       // Default QueryServer.QueryTimeout
+	MaxConcurrentQueriesDefault    = 4                      // Default QueryServer.MaxConcurrentQueries
+	RetryBackoffDefault            = 500 * time.Millisecond // Default QueryServer.RetryBackoff
+	CircuitFailureThresholdDefault = 5                      // Default QueryServer.CircuitFailureThreshold
+	CircuitOpenDurationDefault     = 30 * time.Second       // Default QueryServer.CircuitOpenDuration
+)
+
+var (
+	// Health of every QueryServer that has been queried.  Key=GetQueryServerKey()
+	QueryServerHealthStates = make(map[string]*data.QueryServerHealth)
+	QueryServerHealthLock   sync.Mutex
+
+	// Limits the queries running at once to each QueryServer.  Key=GetQueryServerKey()
+	QueryServerSemaphores     = make(map[string]chan struct{})
+	QueryServerSemaphoresLock sync.Mutex
+)
+
+// Returns the SireusData.ServerContext, so queries are cancelled when the server quits.  Tests don't configure the
+// server, so they get a background context.
+func GetServerContext() context.Context {
+	if data.SireusData.ServerContext != nil {
+		return data.SireusData.ServerContext
+	}
+	return context.Background()
+}
+
+// Execute a query with the ActiveQueryClient.  Each attempt has the QueryServer.QueryTimeout, at most
+// QueryServer.MaxConcurrentQueries run at once, and errors that can be retried are retried with backoff.  If the
+// QueryServer keeps failing its circuit opens, and queries fail immediately until it is tried again.
+func ExecuteQuery(queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	ctx := GetServerContext()
+
+	if !IsQueryServerCircuitClosed(queryServer) {
+		health := GetQueryServerHealth(queryServer.SiteName, queryServer.Name)
+		return GetQueryResponseError(fmt.Sprintf("Query Server is unhealthy, circuit is open until %s: %s  Last Error: %s", health.CircuitOpenUntil.Format(time.RFC3339), queryServer.Name, health.LastError), "")
+	}
+
+	semaphore := GetQueryServerSemaphore(queryServer)
+	select {
+	case semaphore <- struct{}{}:
+		defer func() { <-semaphore }()
+	case <-ctx.Done():
+		return GetQueryResponseError(fmt.Sprintf("Query cancelled waiting for Query Server: %s  Error: %v", queryServer.Name, ctx.Err()), "")
+	}
+
+	timeout := GetDurationOrDefault(queryServer.QueryTimeout, QueryTimeoutDefault)
+	backoff := GetDurationOrDefault(queryServer.RetryBackoff, RetryBackoffDefault)
+
+	var response data.QueryResponse
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		response = ActiveQueryClient.Query(attemptCtx, queryServer, query, start, duration, step)
+		cancel()
+
+		if !response.IsError || !response.IsRetryable || attempt >= queryServer.RetryCount || ctx.Err() != nil {
+			break
+		}
+
+		log.Printf("Query retry %d/%d in %s: %s: %s", attempt+1, queryServer.RetryCount, backoff, queryServer.Name, response.ErrorMessage)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+
+	// Errors that can't be retried came from a working QueryServer, ex: a bad query, so only the query failed
+	if response.IsError && response.IsRetryable {
+		RecordQueryServerFailure(queryServer, response.ErrorMessage)
+	} else {
+		RecordQueryServerSuccess(queryServer)
+	}
+
+	return response
+}
+
+// Returns the duration, or the default if it isn't set
+func GetDurationOrDefault(duration data.Duration, defaultDuration time.Duration) time.Duration {
+	if duration <= 0 {
+		return defaultDuration
+	}
+	return time.Duration(duration)
+}
+
+// Returns the semaphore limiting the queries running at once to this QueryServer.  If MaxConcurrentQueries changed, ex:
+// the config was reloaded, a new semaphore is made.  Queries running with the old semaphore release it when done.
+func GetQueryServerSemaphore(queryServer data.QueryServer) chan struct{} {
+	QueryServerSemaphoresLock.Lock()
+	defer QueryServerSemaphoresLock.Unlock()
+
+	maxConcurrent := queryServer.MaxConcurrentQueries
+	if maxConcurrent <= 0 {
+		maxConcurrent = MaxConcurrentQueriesDefault
+	}
+
+	key := GetQueryServerKey(queryServer.SiteName, queryServer.Name)
+	semaphore, ok := QueryServerSemaphores[key]
+	if !ok || cap(semaphore) != maxConcurrent {
+		semaphore = make(chan struct{}, maxConcurrent)
+		QueryServerSemaphores[key] = semaphore
+	}
+
+	return semaphore
+}
+
+// Returns true if queries can be made to this QueryServer.  When an open circuit's duration passes, this returns true
+// once and re-opens the circuit, so only 1 query tests the QueryServer until it succeeds
+func IsQueryServerCircuitClosed(queryServer data.QueryServer) bool {
+	QueryServerHealthLock.Lock()
+	defer QueryServerHealthLock.Unlock()
+
+	health, ok := QueryServerHealthStates[GetQueryServerKey(queryServer.SiteName, queryServer.Name)]
+	if !ok || health.IsHealthy {
+		return true
+	}
+
+	now := util.GetTimeNow()
+	if now.Before(health.CircuitOpenUntil) {
+		return false
+	}
+
+	health.CircuitOpenUntil = now.Add(GetDurationOrDefault(queryServer.CircuitOpenDuration, CircuitOpenDurationDefault))
+	return true
+}
+
+// Record a successful query, which makes the QueryServer healthy and closes its circuit
+func RecordQueryServerSuccess(queryServer data.QueryServer) {
+	QueryServerHealthLock.Lock()
+	defer QueryServerHealthLock.Unlock()
+
+	health := GetQueryServerHealthState(queryServer.SiteName, queryServer.Name)
+
+	if !health.IsHealthy {
+		log.Printf("Query Server is healthy: %s: %s", queryServer.SiteName, queryServer.Name)
+	}
+
+	health.IsHealthy = true
+	health.ConsecutiveFailures = 0
+	health.LastSuccess = util.GetTimeNow()
+	health.CircuitOpenUntil = time.Time{}
+}
+
+// Record a failed query.  After QueryServer.CircuitFailureThreshold failures in a row, the QueryServer is unhealthy
+// and its circuit opens
+func RecordQueryServerFailure(queryServer data.QueryServer, errorMessage string) {
+	QueryServerHealthLock.Lock()
+	defer QueryServerHealthLock.Unlock()
+
+	health := GetQueryServerHealthState(queryServer.SiteName, queryServer.Name)
+	now := util.GetTimeNow()
+
+	health.ConsecutiveFailures++
+	health.LastError = errorMessage
+	health.LastFailure = now
+
+	threshold := queryServer.CircuitFailureThreshold
+	if threshold <= 0 {
+		threshold = CircuitFailureThresholdDefault
+	}
+
+	if health.ConsecutiveFailures >= threshold {
+		if health.IsHealthy {
+			log.Printf("Query Server is unhealthy after %d failures: %s: %s  Last Error: %s", health.ConsecutiveFailures, queryServer.SiteName, queryServer.Name, errorMessage)
+		}
+		health.IsHealthy = false
+		health.CircuitOpenUntil = now.Add(GetDurationOrDefault(queryServer.CircuitOpenDuration, CircuitOpenDurationDefault))
+	}
+}
+
+// Returns the key for a QueryServer's health and semaphore.  Sites can have QueryServers with the same name, so they
+// are kept per Site.
+func GetQueryServerKey(siteName string, queryServerName string) string {
+	return fmt.Sprintf("%s.%s", siteName, queryServerName)
+}
+
+// Returns the health state for a Site's QueryServer, creating it as healthy.  QueryServerHealthLock must be held
+func GetQueryServerHealthState(siteName string, name string) *data.QueryServerHealth {
+	key := GetQueryServerKey(siteName, name)
+	health, ok := QueryServerHealthStates[key]
+	if !ok {
+		health = &data.QueryServerHealth{Name: name, IsHealthy: true}
+		QueryServerHealthStates[key] = health
+	}
+	return health
+}
+
+// Returns a copy of a Site's QueryServer health.  QueryServers that haven't been queried are healthy
+func GetQueryServerHealth(siteName string, name string) data.QueryServerHealth {
+	QueryServerHealthLock.Lock()
+	defer QueryServerHealthLock.Unlock()
+
+	return *GetQueryServerHealthState(siteName, name)
+}
+
+// Returns true if the Site's QueryServer is healthy
+func IsQueryServerHealthy(siteName string, name string) bool {
+	return GetQueryServerHealth(siteName, name).IsHealthy
+}
@@ -0,0 +1,152 @@
+package extdata
+
+import (
+	"context"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns scripted errors, and counts the attempts
+type testFailingQueryClient struct {
+	attempts    *int
+	isError     bool
+	isRetryable bool
+	delay       time.Duration
+}
+
+func (client testFailingQueryClient) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	*client.attempts++
+
+	select {
+	case <-time.After(client.delay):
+	case <-ctx.Done():
+		response := GetQueryResponseError("timeout", "")
+		response.IsRetryable = true
+		return response
+	}
+
+	if client.isError {
+		response := GetQueryResponseError("failed", "")
+		response.IsRetryable = client.isRetryable
+		return response
+	}
+	return data.QueryResponse{}
+}
+
+func TestExecuteQueryRetriesAndCircuitBreaker(t *testing.T) {
+	resetQueryServerHealthStates(t)
+
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	defer util.SetClock(util.SetClock(clock))
+
+	attempts := 0
+	client := testFailingQueryClient{attempts: &attempts, isError: true, isRetryable: true}
+	defer SetQueryClient(SetQueryClient(client))
+
+	queryServer := data.QueryServer{
+		Name:                    "test_circuit",
+		SiteName:                "Site",
+		RetryCount:              2,
+		RetryBackoff:            data.Duration(time.Millisecond),
+		CircuitFailureThreshold: 2,
+		CircuitOpenDuration:     data.Duration(30 * time.Second),
+	}
+	query := data.BotQuery{QueryServer: queryServer.Name, Query: "up"}
+
+	response := ExecuteQuery(queryServer, query, clock.Now(), time.Minute, PrometheusQueryStep)
+	assert.True(t, response.IsError)
+	assert.Equal(t, 3, attempts, "1 attempt and 2 retries")
+	assert.True(t, IsQueryServerHealthy(queryServer.SiteName, queryServer.Name), "1 failure is under the threshold")
+
+	ExecuteQuery(queryServer, query, clock.Now(), time.Minute, PrometheusQueryStep)
+	assert.False(t, IsQueryServerHealthy(queryServer.SiteName, queryServer.Name))
+	assert.True(t, IsQueryServerHealthy("Other", queryServer.Name), "Query Servers with the same name in another Site have their own health")
+
+	// The circuit is open, so nothing is queried
+	attempts = 0
+	response = ExecuteQuery(queryServer, query, clock.Now(), time.Minute, PrometheusQueryStep)
+	assert.True(t, response.IsError)
+	assert.Equal(t, 0, attempts)
+
+	// After the open duration, a query is tried, and success closes the circuit
+	clock.Advance(31 * time.Second)
+	SetQueryClient(testFailingQueryClient{attempts: &attempts})
+	response = ExecuteQuery(queryServer, query, clock.Now(), time.Minute, PrometheusQueryStep)
+	assert.False(t, response.IsError)
+	assert.True(t, IsQueryServerHealthy(queryServer.SiteName, queryServer.Name))
+
+	// Bad queries aren't retried, and don't make the Query Server unhealthy
+	attempts = 0
+	SetQueryClient(testFailingQueryClient{attempts: &attempts, isError: true})
+	for i := 0; i < 3; i++ {
+		ExecuteQuery(queryServer, query, clock.Now(), time.Minute, PrometheusQueryStep)
+	}
+	assert.Equal(t, 3, attempts)
+	assert.True(t, IsQueryServerHealthy(queryServer.SiteName, queryServer.Name))
+}
+
+func TestExecuteQueryTimeout(t *testing.T) {
+	attempts := 0
+	defer SetQueryClient(SetQueryClient(testFailingQueryClient{attempts: &attempts, delay: time.Minute}))
+
+	queryServer := data.QueryServer{Name: "test_timeout", QueryTimeout: data.Duration(10 * time.Millisecond)}
+
+	started := time.Now()
+	response := ExecuteQuery(queryServer, data.BotQuery{Query: "up"}, time.Now(), time.Minute, PrometheusQueryStep)
+	assert.True(t, response.IsError)
+	assert.Less(t, time.Since(started), 5*time.Second, "The attempt was cancelled by the timeout")
+}
+
+// Replace the global QueryServer health with an empty map for a test, and restore it after
+func resetQueryServerHealthStates(t *testing.T) {
+	QueryServerHealthLock.Lock()
+	previous := QueryServerHealthStates
+	QueryServerHealthStates = make(map[string]*data.QueryServerHealth)
+	QueryServerHealthLock.Unlock()
+
+	t.Cleanup(func() {
+		QueryServerHealthLock.Lock()
+		QueryServerHealthStates = previous
+		QueryServerHealthLock.Unlock()
+	})
+}
+
+func TestGetQueryServerSemaphoreResized(t *testing.T) {
+	queryServer := data.QueryServer{Name: "test_semaphore", MaxConcurrentQueries: 2}
+
+	semaphore := GetQueryServerSemaphore(queryServer)
+	assert.Equal(t, 2, cap(semaphore))
+	assert.Equal(t, semaphore, GetQueryServerSemaphore(queryServer), "Unchanged configs keep the semaphore")
+
+	queryServer.MaxConcurrentQueries = 8
+	assert.Equal(t, 8, cap(GetQueryServerSemaphore(queryServer)))
+
+	queryServer.MaxConcurrentQueries = 0
+	assert.Equal(t, MaxConcurrentQueriesDefault, cap(GetQueryServerSemaphore(queryServer)))
+}
+
+func TestUpdateBotsWithUnhealthyQueryServers(t *testing.T) {
+	resetQueryServerHealthStates(t)
+	RecordQueryServerFailure(data.QueryServer{Name: "test_unhealthy", CircuitFailureThreshold: 1}, "down")
+
+	getSession := func(uuid data.SessionUUID) data.InteractiveSession {
+		return data.InteractiveSession{UUID: uuid, BotGroups: []data.BotGroup{{
+			Name:    "App",
+			Queries: []data.BotQuery{{QueryServer: "test_unhealthy", Name: "Requests"}},
+			Bots:    []data.Bot{{Name: "app-1", LockKey: "test_unhealthy.app-1"}},
+		}}}
+	}
+
+	session := getSession(0)
+	UpdateBotsWithUnhealthyQueryServers(&session, 0)
+	assert.True(t, session.BotGroups[0].Bots[0].IsInvalid)
+	assert.Contains(t, session.BotGroups[0].Bots[0].InfoInvalid, "test_unhealthy")
+
+	// Interactive sessions aren't production, so the live health doesn't invalidate them
+	session = getSession(12345)
+	UpdateBotsWithUnhealthyQueryServers(&session, 0)
+	assert.False(t, session.BotGroups[0].Bots[0].IsInvalid)
+}
@@ -0,0 +1,172 @@
+package extdata
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FileColumnQuery = "query" // CSV column matched against BotQuery.Query.  If there is no query column, every row matches
+	FileColumnTime  = "time"  // CSV column for the sample time, Unix seconds or RFC3339.  If there is no time column, the rows are current values
+	FileColumnValue = "value" // CSV column for the sample value.  Every other column is a label
+)
+
+type (
+	// FileBackend reads series from a local CSV or JSON file in QueryServer.FilePath.  The file is read on every
+	// query, so it can be updated by another process.
+	FileBackend struct{}
+)
+
+// Query the series in QueryServer.FilePath matching BotQuery.Query, with samples from start to start+duration
+func (backend FileBackend) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	requestTime := util.GetTimeNow()
+	requestUrl := fmt.Sprintf("file://%s?query=%s", queryServer.FilePath, query.Query)
+	end := start.Add(duration)
+
+	var fileSeries []data.FileQuerySeries
+	var err error
+
+	switch strings.ToLower(filepath.Ext(queryServer.FilePath)) {
+	case ".csv":
+		fileSeries, err = LoadFileQuerySeriesCSV(queryServer.FilePath)
+	case ".json":
+		fileSeries, err = LoadFileQuerySeriesJSON(queryServer.FilePath)
+	default:
+		err = errors.New(fmt.Sprintf("File must be .csv or .json: %s", queryServer.FilePath))
+	}
+	if util.Check(err) {
+		return GetQueryResponseError(fmt.Sprintf("Couldn't read Query file: %v   Path: %s", err, queryServer.FilePath), requestUrl)
+	}
+
+	response := data.QueryResponse{
+		Series:      []data.QuerySeries{},
+		RequestURL:  requestUrl,
+		RequestTime: requestTime,
+	}
+
+	seriesIndex := make(map[string]int)
+
+	for _, item := range fileSeries {
+		if item.Query != "" && item.Query != query.Query {
+			continue
+		}
+
+		// Samples without a time are current values
+		series := data.QuerySeries{Labels: item.Labels, Samples: []data.QuerySample{}}
+		for _, sample := range item.Samples {
+			if sample.Time.IsZero() {
+				sample.Time = end
+			}
+			series.Samples = append(series.Samples, sample)
+		}
+		series = GetQuerySeriesInRange(series, start, end)
+
+		key := GetQuerySeriesKey(series.Labels)
+		if index, ok := seriesIndex[key]; ok {
+			response.Series[index].Samples = append(response.Series[index].Samples, series.Samples...)
+			continue
+		}
+		seriesIndex[key] = len(response.Series)
+		response.Series = append(response.Series, series)
+	}
+
+	response.ResponseTime = util.GetTimeNow()
+
+	return response
+}
+
+// Load a JSON file of FileQuerySeries
+func LoadFileQuerySeriesJSON(path string) ([]data.FileQuerySeries, error) {
+	fileData, err := os.ReadFile(path)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	var fileSeries []data.FileQuerySeries
+	err = json.Unmarshal(fileData, &fileSeries)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return fileSeries, nil
+}
+
+// Load a CSV file with a header row.  Each row is a single sample, with the FileColumnQuery, FileColumnTime and
+// FileColumnValue columns, and every other column is a label.  Rows with the same query and labels are 1 series.
+func LoadFileQuerySeriesCSV(path string) ([]data.FileQuerySeries, error) {
+	file, err := os.Open(path)
+	if util.Check(err) {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if util.Check(err) {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New(fmt.Sprintf("CSV has no header row: %s", path))
+	}
+
+	header := rows[0]
+	valueColumn := -1
+	for column, name := range header {
+		if name == FileColumnValue {
+			valueColumn = column
+		}
+	}
+	if valueColumn == -1 {
+		return nil, errors.New(fmt.Sprintf("CSV has no %s column: %s", FileColumnValue, path))
+	}
+
+	var fileSeries []data.FileQuerySeries
+	seriesIndex := make(map[string]int)
+
+	for rowIndex, row := range rows[1:] {
+		item := data.FileQuerySeries{Labels: map[string]string{}}
+		var sample data.QuerySample
+
+		for column, name := range header {
+			switch name {
+			case FileColumnQuery:
+				item.Query = row[column]
+			case FileColumnTime:
+				sampleTime, ok := GetSampleTimeValue(row[column])
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("CSV time is not Unix seconds or RFC3339: %s:%d: %s", path, rowIndex+2, row[column]))
+				}
+				sample.Time = sampleTime
+			case FileColumnValue:
+			default:
+				item.Labels[name] = row[column]
+			}
+		}
+
+		// Invalid values are missing samples, but the series still exists
+		value, ok := GetSampleValue(row[valueColumn])
+
+		key := fmt.Sprintf("%s.%s", item.Query, GetQuerySeriesKey(item.Labels))
+		index, exists := seriesIndex[key]
+		if !exists {
+			index = len(fileSeries)
+			seriesIndex[key] = index
+			fileSeries = append(fileSeries, item)
+		}
+
+		if ok {
+			sample.Value = value
+			fileSeries[index].Samples = append(fileSeries[index].Samples, sample)
+		}
+	}
+
+	return fileSeries, nil
+}
@@ -0,0 +1,196 @@
+package extdata
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// HTTP clients are created once per QueryServer TLS config, so connections are reused.  Key=GetQueryServerTLSKey()
+	QueryHttpClients     = make(map[string]*http.Client)
+	QueryHttpClientsLock sync.Mutex
+)
+
+// Returns the base URL for a QueryServer, with HTTPS if UseTLS
+func GetQueryServerBaseUrl(queryServer data.QueryServer) string {
+	return fmt.Sprintf("%s://%s:%d", GetQueryServerScheme(queryServer), queryServer.Host, queryServer.Port)
+}
+
+// Returns the URL scheme for a QueryServer
+func GetQueryServerScheme(queryServer data.QueryServer) string {
+	if queryServer.UseTLS {
+		return "https"
+	}
+	return "http"
+}
+
+// Make an authenticated GET request to a QueryServer
+func QueryServerGet(ctx context.Context, queryServer data.QueryServer, requestUrl string) (*http.Response, error) {
+	client, err := GetQueryServerHttpClient(queryServer)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	request, err := NewQueryServerRequest(ctx, queryServer, requestUrl)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return client.Do(request)
+}
+
+// Create a GET request with the QueryServer authentication and headers
+func NewQueryServerRequest(ctx context.Context, queryServer data.QueryServer, requestUrl string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	for header, value := range queryServer.Headers {
+		request.Header.Set(header, value)
+	}
+	for header, envName := range queryServer.HeadersEnv {
+		value, err := GetSecretFromEnv(envName)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Query Server: %s  Header: %s  Error: %s", queryServer.Name, header, err.Error()))
+		}
+		request.Header.Set(header, value)
+	}
+	for header, path := range queryServer.HeadersFile {
+		value, err := GetSecretFromFile(path)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Query Server: %s  Header: %s  Error: %s", queryServer.Name, header, err.Error()))
+		}
+		request.Header.Set(header, value)
+	}
+
+	authType := queryServer.AuthType
+	// Configs from before AuthType had only AuthUser, which is Basic auth
+	if authType == data.AuthNone && queryServer.AuthUser != "" {
+		authType = data.AuthBasic
+	}
+
+	switch authType {
+	case data.AuthNone:
+	case data.AuthBasic:
+		secret, err := GetQueryServerAuthSecret(queryServer)
+		if util.Check(err) {
+			return nil, err
+		}
+		request.SetBasicAuth(queryServer.AuthUser, secret)
+	case data.AuthBearer:
+		secret, err := GetQueryServerAuthSecret(queryServer)
+		if util.Check(err) {
+			return nil, err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+	default:
+		return nil, errors.New(fmt.Sprintf("Query Server: %s  Unknown Auth Type: %d", queryServer.Name, queryServer.AuthType))
+	}
+
+	return request, nil
+}
+
+// Returns the AuthSecret, from AuthSecretFile, AuthSecretEnv or AuthSecret, in that order.  Secrets are read on every
+// request, so rotated secrets are used without a restart.
+func GetQueryServerAuthSecret(queryServer data.QueryServer) (string, error) {
+	if queryServer.AuthSecretFile != "" {
+		return GetSecretFromFile(queryServer.AuthSecretFile)
+	}
+	if queryServer.AuthSecretEnv != "" {
+		return GetSecretFromEnv(queryServer.AuthSecretEnv)
+	}
+	return queryServer.AuthSecret, nil
+}
+
+// Returns a secret from an environment variable.  It is an error if it isn't set, so a missing secret isn't sent empty
+func GetSecretFromEnv(envName string) (string, error) {
+	value, ok := os.LookupEnv(envName)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Secret environment variable is not set: %s", envName))
+	}
+	return value, nil
+}
+
+// Returns a secret from a file, without the trailing newline
+func GetSecretFromFile(path string) (string, error) {
+	secretData, err := os.ReadFile(path)
+	if util.Check(err) {
+		return "", errors.New(fmt.Sprintf("Couldn't read secret file: %s  Error: %s", path, err.Error()))
+	}
+	return strings.TrimRight(string(secretData), "\r\n"), nil
+}
+
+// Returns the HTTP client for the QueryServer TLS config, creating it the first time
+func GetQueryServerHttpClient(queryServer data.QueryServer) (*http.Client, error) {
+	if !queryServer.UseTLS {
+		return http.DefaultClient, nil
+	}
+
+	key := GetQueryServerTLSKey(queryServer)
+
+	QueryHttpClientsLock.Lock()
+	defer QueryHttpClientsLock.Unlock()
+
+	if client, ok := QueryHttpClients[key]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := GetQueryServerTLSConfig(queryServer)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{Transport: transport}
+	QueryHttpClients[key] = client
+
+	return client, nil
+}
+
+// Returns the key for a QueryServer's TLS config, so QueryServers with the same TLS config share an HTTP client
+func GetQueryServerTLSKey(queryServer data.QueryServer) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%v", queryServer.TlsCaFile, queryServer.TlsCertFile, queryServer.TlsKeyFile, queryServer.TlsServerName, queryServer.TlsSkipVerify)
+}
+
+// Create the TLS config for a QueryServer, with its CA and client certificates
+func GetQueryServerTLSConfig(queryServer data.QueryServer) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         queryServer.TlsServerName,
+		InsecureSkipVerify: queryServer.TlsSkipVerify,
+	}
+
+	if queryServer.TlsCaFile != "" {
+		caData, err := os.ReadFile(queryServer.TlsCaFile)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Query Server: %s  Couldn't read TLS CA file: %s  Error: %s", queryServer.Name, queryServer.TlsCaFile, err.Error()))
+		}
+
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caData) {
+			return nil, errors.New(fmt.Sprintf("Query Server: %s  No PEM certificates in TLS CA file: %s", queryServer.Name, queryServer.TlsCaFile))
+		}
+		tlsConfig.RootCAs = caPool
+	}
+
+	if queryServer.TlsCertFile != "" || queryServer.TlsKeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(queryServer.TlsCertFile, queryServer.TlsKeyFile)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Query Server: %s  Couldn't load TLS client certificate: %s  Key: %s  Error: %s", queryServer.Name, queryServer.TlsCertFile, queryServer.TlsKeyFile, err.Error()))
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
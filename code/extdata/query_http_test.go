@@ -0,0 +1,88 @@
+package extdata
+
+import (
+	"context"
+	"encoding/pem"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQueryPrometheusWithTLSAndAuth(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "sireus" || password != "file-secret" || r.Header.Get("X-Scope-OrgID") != "env-org" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "success", "data": {"resultType": "matrix", "result": [{"metric": {"job": "a"}, "values": [[100, "1"]]}]}}`))
+	}))
+	defer server.Close()
+
+	serverUrl, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+
+	tempDir := t.TempDir()
+	caPath := filepath.Join(tempDir, "ca.pem")
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(caPath, caData, 0644))
+
+	secretPath := filepath.Join(tempDir, "secret")
+	assert.Nil(t, os.WriteFile(secretPath, []byte("file-secret\n"), 0600))
+
+	t.Setenv("SIREUS_TEST_ORG", "env-org")
+
+	queryServer := data.QueryServer{
+		Name:           "secure",
+		Host:           serverUrl.Hostname(),
+		Port:           port,
+		UseTLS:         true,
+		AuthType:       data.AuthBasic,
+		AuthUser:       "sireus",
+		AuthSecret:     "config-secret",
+		AuthSecretFile: secretPath,
+		HeadersEnv:     map[string]string{"X-Scope-OrgID": "SIREUS_TEST_ORG"},
+		TlsCaFile:      caPath,
+	}
+
+	response := QueryPrometheus(context.Background(), queryServer, data.Range, "up", time.Unix(100, 0), time.Minute, PrometheusQueryStep)
+	assert.False(t, response.IsError, response.ErrorMessage)
+	assert.Len(t, response.Data.Result, 1)
+
+	// AuthSecretFile takes priority over AuthSecret
+	queryServer.AuthSecretFile = ""
+	response = QueryPrometheus(context.Background(), queryServer, data.Range, "up", time.Unix(100, 0), time.Minute, PrometheusQueryStep)
+	assert.True(t, response.IsError, "Authentication failed")
+
+	// Without the CA the server certificate can't be verified
+	queryServer.AuthSecretFile = secretPath
+	queryServer.TlsCaFile = ""
+	response = QueryPrometheus(context.Background(), queryServer, data.Range, "up", time.Unix(100, 0), time.Minute, PrometheusQueryStep)
+	assert.True(t, response.IsError, "Certificate not verified")
+
+	queryServer.TlsSkipVerify = true
+	response = QueryPrometheus(context.Background(), queryServer, data.Range, "up", time.Unix(100, 0), time.Minute, PrometheusQueryStep)
+	assert.False(t, response.IsError, response.ErrorMessage)
+}
+
+func TestNewQueryServerRequest(t *testing.T) {
+	queryServer := data.QueryServer{Name: "proxy", AuthType: data.AuthBearer, AuthSecretEnv: "SIREUS_TEST_TOKEN", Headers: map[string]string{"X-Team": "sre"}}
+
+	_, err := NewQueryServerRequest(context.Background(), queryServer, "http://localhost:9090/api/v1/query_range")
+	assert.NotNil(t, err, "Unset secret environment variables are an error, not an empty secret")
+
+	t.Setenv("SIREUS_TEST_TOKEN", "token-1")
+	request, err := NewQueryServerRequest(context.Background(), queryServer, "http://localhost:9090/api/v1/query_range")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer token-1", request.Header.Get("Authorization"))
+	assert.Equal(t, "sre", request.Header.Get("X-Team"))
+
+	assert.Equal(t, "https://prom:443", GetQueryServerBaseUrl(data.QueryServer{Host: "prom", Port: 443, UseTLS: true}))
+}
@@ -0,0 +1,326 @@
+package extdata
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// All the samples recorded in a QueryRecord archive, merged by Query and series, so any time range can be replayed
+	ReplayArchive struct {
+		Path      string
+		ModTime   time.Time                               // Modification time of the archive file when it was loaded, so changes are reloaded
+		LoadTime  time.Time                               // When the archive was loaded, so changes are reloaded at most every ReplayArchiveReloadInterval
+		StartTime time.Time                               // Earliest sample in the archive
+		EndTime   time.Time                               // Latest sample or recorded error in the archive
+		Queries   map[string]map[string]*data.QuerySeries // Key 1: GetReplayQueryKey(), Key 2: GetQuerySeriesKey()
+		Responses map[string][]ReplayResponse             // Key: GetReplayQueryKey().  Every recorded response in time order, to replay errors
+	}
+
+	// When a recorded response was received, and its error if it failed.  The latest response at a requested time
+	// decides if the replayed query fails
+	ReplayResponse struct {
+		Time         time.Time // QueryRecord.QueryStartTime + QueryRecord.QueryDuration
+		IsError      bool
+		ErrorMessage string
+		IsRetryable  bool
+	}
+)
+
+type (
+	// ReplayBackend serves the samples recorded in QueryServer.ReplayPath instead of querying a live QueryServer
+	ReplayBackend struct{}
+)
+
+const (
+	// A changed ReplayArchive is re-parsed entirely, so an archive that is still being recorded to is only reloaded
+	// this often, instead of on every query
+	ReplayArchiveReloadInterval = 30 * time.Second
+)
+
+var (
+	// ReplayArchives are only loaded once, Key=ReplayArchive.Path.  ReplayArchivesLock only guards the maps.  Each path
+	// is loaded under its own lock in ReplayArchiveLoadLocks, so loading one archive doesn't block the others
+	ReplayArchives         = make(map[string]*ReplayArchive)
+	ReplayArchiveLoadLocks = make(map[string]*sync.Mutex)
+	ReplayArchivesLock     sync.Mutex
+)
+
+// Append a QueryRecord to the archive at recordPath, as a JSON line.  If maxBytes is over 0, and this record would
+// make the archive larger than maxBytes, the archive is rotated to "(recordPath).1" first, replacing any previous
+// rotation, so recording can't grow without limit
+func RecordQueryResponse(recordPath string, maxBytes int64, queryServer data.QueryServer, query data.BotQuery, queryStartTime time.Time, queryDuration data.Duration, response data.QueryResponse) error {
+	record := data.QueryRecord{
+		QueryServer:    queryServer.Name,
+		QueryType:      query.QueryType,
+		Query:          query.Query,
+		QueryStartTime: queryStartTime,
+		QueryDuration:  queryDuration,
+		Response:       response,
+	}
+
+	recordData, err := json.Marshal(record)
+	if util.Check(err) {
+		return err
+	}
+
+	// Background queries record concurrently, so keep each line whole
+	lockKey := fmt.Sprintf("query_record.%s", recordPath)
+	util.LockAcquire(lockKey)
+	defer util.LockRelease(lockKey)
+
+	if maxBytes > 0 {
+		fileInfo, err := os.Stat(recordPath)
+		if err == nil && fileInfo.Size() > 0 && fileInfo.Size()+int64(len(recordData))+1 > maxBytes {
+			err = os.Rename(recordPath, recordPath+".1")
+			if util.Check(err) {
+				return err
+			}
+		}
+	}
+
+	file, err := os.OpenFile(recordPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if util.Check(err) {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(recordData, '\n'))
+	return err
+}
+
+// Load all the QueryRecords in an archive
+func LoadQueryRecords(recordPath string) ([]data.QueryRecord, error) {
+	file, err := os.Open(recordPath)
+	if util.Check(err) {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []data.QueryRecord
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record data.QueryRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Could not parse Query Record: %s:%d  Error: %s", recordPath, lineNumber, err.Error()))
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Create a ReplayArchive from QueryRecords.  Overlapping responses are merged, so each sample time is only kept once.
+// Error responses are kept, so they are replayed as errors at the same time
+func GetReplayArchive(recordPath string, records []data.QueryRecord) *ReplayArchive {
+	archive := &ReplayArchive{Path: recordPath, Queries: make(map[string]map[string]*data.QuerySeries), Responses: make(map[string][]ReplayResponse)}
+
+	seenSamples := make(map[string]bool)
+
+	for _, record := range records {
+		queryKey := GetReplayQueryKey(record.QueryType, record.Query)
+
+		responseTime := record.QueryStartTime.Add(time.Duration(record.QueryDuration))
+		archive.Responses[queryKey] = append(archive.Responses[queryKey], ReplayResponse{
+			Time:         responseTime,
+			IsError:      record.Response.IsError,
+			ErrorMessage: record.Response.ErrorMessage,
+			IsRetryable:  record.Response.IsRetryable,
+		})
+
+		if record.Response.IsError {
+			// The archive must reach the error, so it is replayed when the archive loops
+			if responseTime.After(archive.EndTime) {
+				archive.EndTime = responseTime
+			}
+			continue
+		}
+
+		if _, ok := archive.Queries[queryKey]; !ok {
+			archive.Queries[queryKey] = make(map[string]*data.QuerySeries)
+		}
+
+		for _, recordSeries := range record.Response.Series {
+			seriesKey := GetQuerySeriesKey(recordSeries.Labels)
+			series, ok := archive.Queries[queryKey][seriesKey]
+			if !ok {
+				series = &data.QuerySeries{Labels: recordSeries.Labels}
+				archive.Queries[queryKey][seriesKey] = series
+			}
+
+			for _, sample := range recordSeries.Samples {
+				sampleKey := fmt.Sprintf("%s.%s.%d", queryKey, seriesKey, sample.Time.UnixMilli())
+				if seenSamples[sampleKey] {
+					continue
+				}
+				seenSamples[sampleKey] = true
+
+				series.Samples = append(series.Samples, sample)
+
+				if archive.StartTime.IsZero() || sample.Time.Before(archive.StartTime) {
+					archive.StartTime = sample.Time
+				}
+				if sample.Time.After(archive.EndTime) {
+					archive.EndTime = sample.Time
+				}
+			}
+		}
+	}
+
+	for _, querySeries := range archive.Queries {
+		for _, series := range querySeries {
+			sort.SliceStable(series.Samples, func(i, j int) bool {
+				return series.Samples[i].Time.Before(series.Samples[j].Time)
+			})
+		}
+	}
+
+	for _, responses := range archive.Responses {
+		sort.SliceStable(responses, func(i, j int) bool {
+			return responses[i].Time.Before(responses[j].Time)
+		})
+	}
+
+	return archive
+}
+
+// Returns the ReplayArchive for this path.  It is loaded the first time, and reloaded when the file's modification
+// time changes, ex: it is still being recorded to.  Reloads happen at most every ReplayArchiveReloadInterval, until
+// then the previously loaded archive is returned.
+func GetCachedReplayArchive(recordPath string) (*ReplayArchive, error) {
+	fileInfo, err := os.Stat(recordPath)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	ReplayArchivesLock.Lock()
+	loadLock, ok := ReplayArchiveLoadLocks[recordPath]
+	if !ok {
+		loadLock = &sync.Mutex{}
+		ReplayArchiveLoadLocks[recordPath] = loadLock
+	}
+	ReplayArchivesLock.Unlock()
+
+	loadLock.Lock()
+	defer loadLock.Unlock()
+
+	ReplayArchivesLock.Lock()
+	archive, ok := ReplayArchives[recordPath]
+	ReplayArchivesLock.Unlock()
+
+	if ok && (archive.ModTime.Equal(fileInfo.ModTime()) || util.GetTimeNow().Sub(archive.LoadTime) < ReplayArchiveReloadInterval) {
+		return archive, nil
+	}
+
+	records, err := LoadQueryRecords(recordPath)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	archive = GetReplayArchive(recordPath, records)
+	archive.ModTime = fileInfo.ModTime()
+	archive.LoadTime = util.GetTimeNow()
+
+	ReplayArchivesLock.Lock()
+	ReplayArchives[recordPath] = archive
+	ReplayArchivesLock.Unlock()
+
+	return archive, nil
+}
+
+// Returns the latest recorded response for the query at or before the archive time, and false if there is none
+func GetReplayResponse(archive *ReplayArchive, queryKey string, archiveTime time.Time) (ReplayResponse, bool) {
+	responses := archive.Responses[queryKey]
+
+	index := sort.Search(len(responses), func(i int) bool {
+		return responses[i].Time.After(archiveTime)
+	})
+	if index == 0 {
+		return ReplayResponse{}, false
+	}
+
+	return responses[index-1], true
+}
+
+// Replay the recorded samples for this query, instead of querying a live QueryServer.  Requests inside the archive's
+// time range get exactly what was recorded, so incidents can be reproduced and backtested offline.  Requests outside
+// it (ex: the live server loop) wrap around the archive, with the sample times shifted to the requested time, so the
+// archive replays in a loop.
+func (backend ReplayBackend) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	requestUrl := fmt.Sprintf("replay://%s/%s?query=%s", queryServer.Name, queryServer.ReplayPath, query.Query)
+
+	archive, err := GetCachedReplayArchive(queryServer.ReplayPath)
+	if util.Check(err) {
+		return GetQueryResponseError(fmt.Sprintf("Couldn't load Replay archive: %v   Path: %s", err, queryServer.ReplayPath), requestUrl)
+	}
+
+	response := data.QueryResponse{
+		Series:      []data.QuerySeries{},
+		RequestURL:  requestUrl,
+		RequestTime: util.GetTimeNow(),
+	}
+
+	end := start.Add(duration)
+	offset := GetReplayOffset(archive, end)
+	queryKey := GetReplayQueryKey(query.QueryType, query.Query)
+
+	// If the query failed when it was recorded, it fails the same way now
+	if recorded, ok := GetReplayResponse(archive, queryKey, end.Add(-offset)); ok && recorded.IsError {
+		response = GetQueryResponseError(recorded.ErrorMessage, requestUrl)
+		response.IsRetryable = recorded.IsRetryable
+		return response
+	}
+
+	for _, series := range archive.Queries[queryKey] {
+		replayed := GetQuerySeriesInRange(*series, start.Add(-offset), end.Add(-offset))
+		if len(replayed.Samples) == 0 {
+			continue
+		}
+
+		for index := range replayed.Samples {
+			replayed.Samples[index].Time = replayed.Samples[index].Time.Add(offset)
+		}
+
+		response.Series = append(response.Series, replayed)
+	}
+
+	response.ResponseTime = util.GetTimeNow()
+
+	return response
+}
+
+// Returns how far the requested time is shifted from the archive's time.  0 inside the archive, otherwise a whole
+// number of archive lengths, so the requested time wraps into the archive.
+func GetReplayOffset(archive *ReplayArchive, requestTime time.Time) time.Duration {
+	span := archive.EndTime.Sub(archive.StartTime)
+	if span <= 0 || (!requestTime.Before(archive.StartTime) && !requestTime.After(archive.EndTime)) {
+		return 0
+	}
+
+	loops := int64(math.Floor(float64(requestTime.Sub(archive.StartTime)) / float64(span)))
+
+	return time.Duration(loops) * span
+}
+
+// Returns the key for a query in a ReplayArchive
+func GetReplayQueryKey(queryType data.BotQueryType, query string) string {
+	return fmt.Sprintf("%s.%s", queryType.String(), query)
+}
@@ -0,0 +1,137 @@
+package extdata
+
+import (
+	"context"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplayQueryResponses(t *testing.T) {
+	recordPath := filepath.Join(t.TempDir(), "records.jsonl")
+	queryServer := data.QueryServer{Name: "prometheus_primary"}
+	query := data.BotQuery{QueryServer: "prometheus_primary", Query: "demo_req_queue_wait"}
+	labels := map[string]string{"job": "a"}
+
+	responses := []data.QueryResponse{
+		{Series: []data.QuerySeries{{Labels: labels, Samples: []data.QuerySample{{Time: time.Unix(100, 0), Value: 1}, {Time: time.Unix(115, 0), Value: 2}}}}},
+		{Series: []data.QuerySeries{{Labels: labels, Samples: []data.QuerySample{{Time: time.Unix(115, 0), Value: 2}, {Time: time.Unix(130, 0), Value: 3}}}}},
+		{IsError: true, ErrorMessage: "Query Server returned: 503", IsRetryable: true},
+		{Series: []data.QuerySeries{{Labels: labels, Samples: []data.QuerySample{{Time: time.Unix(145, 0), Value: 4}, {Time: time.Unix(160, 0), Value: 5}}}}},
+	}
+	for index, response := range responses {
+		err := RecordQueryResponse(recordPath, 0, queryServer, query, time.Unix(int64(100+index*15), 0), data.Duration(15*time.Second), response)
+		assert.Nil(t, err)
+	}
+
+	records, err := LoadQueryRecords(recordPath)
+	assert.Nil(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, data.Duration(15*time.Second), records[0].QueryDuration)
+
+	archive := GetReplayArchive(recordPath, records)
+	assert.Equal(t, time.Unix(100, 0).UTC(), archive.StartTime.UTC())
+	assert.Equal(t, time.Unix(160, 0).UTC(), archive.EndTime.UTC())
+
+	replayServer := data.QueryServer{Name: "prometheus_primary", ServerType: data.Replay, ReplayPath: recordPath}
+
+	response := QueryServerClient{}.Query(context.Background(), replayServer, query, time.Unix(110, 0), 20*time.Second, PrometheusQueryStep)
+	assert.False(t, response.IsError)
+	assert.Len(t, response.Series, 1)
+	assert.Equal(t, []float64{2, 3}, GetSampleValues(response.Series[0]), "Overlapping samples are only replayed once")
+
+	// The query failed when it was recorded, so it fails at the same time when replayed
+	response = ReplayBackend{}.Query(context.Background(), replayServer, query, time.Unix(130, 0), 15*time.Second, PrometheusQueryStep)
+	assert.True(t, response.IsError)
+	assert.Equal(t, "Query Server returned: 503", response.ErrorMessage)
+	assert.True(t, response.IsRetryable)
+
+	// After the archive ends, it wraps around with the sample times shifted to the request
+	response = ReplayBackend{}.Query(context.Background(), replayServer, query, time.Unix(160, 0), 5*time.Second, PrometheusQueryStep)
+	assert.False(t, response.IsError)
+	assert.Equal(t, []float64{1}, GetSampleValues(response.Series[0]))
+	assert.Equal(t, int64(160), response.Series[0].Samples[0].Time.Unix())
+
+	response = ReplayBackend{}.Query(context.Background(), replayServer, query, time.Unix(190, 0), 15*time.Second, PrometheusQueryStep)
+	assert.True(t, response.IsError, "Recorded errors are replayed when the archive loops")
+
+	response = ReplayBackend{}.Query(context.Background(), replayServer, data.BotQuery{Query: "missing"}, time.Unix(110, 0), 20*time.Second, PrometheusQueryStep)
+	assert.Len(t, response.Series, 0)
+}
+
+func TestGetCachedReplayArchiveReloads(t *testing.T) {
+	recordPath := filepath.Join(t.TempDir(), "records.jsonl")
+	queryServer := data.QueryServer{Name: "prometheus_primary"}
+	query := data.BotQuery{QueryServer: "prometheus_primary", Query: "demo_req_queue_wait"}
+	series := func(value float64) []data.QuerySeries {
+		return []data.QuerySeries{{Labels: map[string]string{"job": "a"}, Samples: []data.QuerySample{{Time: time.Unix(int64(100+value), 0), Value: value}}}}
+	}
+
+	clock := util.NewManualClock(time.Unix(1000, 0))
+	defer util.SetClock(util.SetClock(clock))
+
+	assert.Nil(t, RecordQueryResponse(recordPath, 0, queryServer, query, time.Unix(100, 0), data.Duration(time.Second), data.QueryResponse{Series: series(1)}))
+
+	archive, err := GetCachedReplayArchive(recordPath)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(101, 0).UTC(), archive.EndTime.UTC())
+
+	cached, err := GetCachedReplayArchive(recordPath)
+	assert.Nil(t, err)
+	assert.Same(t, archive, cached, "Unchanged archives are only loaded once")
+
+	// Appending changes the modification time, but the archive was just loaded
+	assert.Nil(t, RecordQueryResponse(recordPath, 0, queryServer, query, time.Unix(101, 0), data.Duration(time.Second), data.QueryResponse{Series: series(2)}))
+	assert.Nil(t, os.Chtimes(recordPath, time.Now(), time.Now().Add(time.Minute)))
+
+	cached, err = GetCachedReplayArchive(recordPath)
+	assert.Nil(t, err)
+	assert.Same(t, archive, cached, "Changed archives are reloaded at most every ReplayArchiveReloadInterval")
+
+	clock.Advance(ReplayArchiveReloadInterval)
+
+	archive, err = GetCachedReplayArchive(recordPath)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(102, 0).UTC(), archive.EndTime.UTC())
+}
+
+func TestRecordQueryResponseRotates(t *testing.T) {
+	recordPath := filepath.Join(t.TempDir(), "records.jsonl")
+	queryServer := data.QueryServer{Name: "prometheus_primary"}
+	query := data.BotQuery{QueryServer: "prometheus_primary", Query: "demo_req_queue_wait"}
+
+	record := func(value float64) {
+		response := data.QueryResponse{Series: []data.QuerySeries{{Labels: map[string]string{"job": "a"}, Samples: []data.QuerySample{{Time: time.Unix(int64(100+value), 0), Value: value}}}}}
+		assert.Nil(t, RecordQueryResponse(recordPath, 1024, queryServer, query, time.Unix(int64(100+value), 0), data.Duration(time.Second), response))
+	}
+
+	// Each record is a few hundred bytes, so only a few fit in 1024 bytes
+	for value := 0; value < 20; value++ {
+		record(float64(value))
+	}
+
+	fileInfo, err := os.Stat(recordPath)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, fileInfo.Size(), int64(1024), "The archive is rotated before it grows over the limit")
+
+	rotatedInfo, err := os.Stat(recordPath + ".1")
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, rotatedInfo.Size(), int64(1024))
+
+	records, err := LoadQueryRecords(recordPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 19.0, records[len(records)-1].Response.Series[0].Samples[0].Value, "The newest record is in the current archive")
+}
+
+// Returns just the values of a series' samples
+func GetSampleValues(series data.QuerySeries) []float64 {
+	var values []float64
+	for _, sample := range series.Samples {
+		values = append(values, sample.Value)
+	}
+	return values
+}
@@ -0,0 +1,219 @@
+package extdata
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"sort"
+	"time"
+)
+
+var (
+	// Stats for every Query that has run.  Key=GetQueryStatsKey()
+	QueryStatsPool     = make(map[string]*data.QueryStats)
+	QueryStatsPoolLock = "query_stats_pool"
+)
+
+// Run a Query for a session, and store the result in the Site cache.  Records the Query stats and metrics, and the
+// response when AppConfig.QueryRecordPath is set
+func RunQuery(session *data.InteractiveSession, site *data.Site, query data.BotQuery) data.QueryResult {
+	queryServer, err := app.GetQueryServer(site, query.QueryServer)
+	util.CheckLog(err)
+
+	startTime := util.GetTimeNow()
+
+	response := ExecuteQuery(queryServer, query, session.QueryStartTime, time.Duration(session.QueryDuration), PrometheusQueryStep)
+
+	RecordQueryStats(queryServer, query, response, util.GetTimeNow().Sub(startTime))
+
+	// Record responses, including errors, so they can be replayed offline.  Replayed responses are already recorded
+	recordPath := data.SireusData.AppConfig.QueryRecordPath
+	if recordPath != "" && queryServer.ServerType != data.Replay {
+		err = RecordQueryResponse(recordPath, data.SireusData.AppConfig.QueryRecordMaxBytes, queryServer, query, session.QueryStartTime, session.QueryDuration, response)
+		util.CheckLog(err)
+	}
+
+	// Create the Query Result from
+	newResult := data.QueryResult{
+		QueryServer: query.QueryServer,
+		QueryType:   query.QueryType,
+		Query:       query.Query,
+		Response:    response,
+	}
+
+	StoreQueryResult(session, site, query, startTime, newResult)
+
+	return newResult
+}
+
+// Run a Query now for the production session, from the web app.  Any BotGroup Query with this QueryServer and Query
+// can be run.
+func RunQueryNow(site *data.Site, queryServerName string, queryText string) (data.QueryStats, error) {
+	query, ok := GetSiteBotQuery(site, queryServerName, queryText)
+	if !ok {
+		return data.QueryStats{}, errors.New(fmt.Sprintf("Query not found: Server: %s  Query: %s", queryServerName, queryText))
+	}
+
+	now := util.GetTimeNow()
+	session := data.InteractiveSession{
+		UUID:           0,
+		QueryStartTime: now.Add(-60 * time.Second),
+		QueryDuration:  data.Duration(60 * time.Second),
+	}
+
+	RunQuery(&session, site, query)
+
+	return GetQueryStats(site, queryServerName, queryText), nil
+}
+
+// Returns the first BotGroup Query in the Site with this QueryServer and Query
+func GetSiteBotQuery(site *data.Site, queryServerName string, queryText string) (data.BotQuery, bool) {
+	for _, botGroup := range app.GetSiteLoadedBotGroups(site) {
+		for _, query := range botGroup.Queries {
+			if query.QueryServer == queryServerName && query.Query == queryText {
+				return query, true
+			}
+		}
+	}
+
+	return data.BotQuery{}, false
+}
+
+// Returns the key for QueryStatsPool.  Sites can have QueryServers with the same name, so stats are kept per Site.
+func GetQueryStatsKey(siteName string, queryServerName string, queryText string) string {
+	return fmt.Sprintf("%s.%s.%s", siteName, queryServerName, queryText)
+}
+
+// Record the stats and export the metrics for a Query response
+func RecordQueryStats(queryServer data.QueryServer, query data.BotQuery, response data.QueryResponse, latency time.Duration) {
+	util.LockAcquire(QueryStatsPoolLock)
+
+	key := GetQueryStatsKey(queryServer.SiteName, queryServer.Name, query.Query)
+	stats, ok := QueryStatsPool[key]
+	if !ok {
+		stats = &data.QueryStats{QueryServer: queryServer.Name, Query: query.Query}
+		QueryStatsPool[key] = stats
+	}
+
+	now := util.GetTimeNow()
+	stats.QueryCount++
+	stats.LastRequest = now
+	stats.LastLatency = data.Duration(latency)
+
+	if response.IsError {
+		stats.ErrorCount++
+		stats.LastError = response.ErrorMessage
+		stats.LastErrorTime = now
+	} else {
+		stats.LastSuccess = now
+		stats.SeriesCount = len(response.Series)
+		stats.SampleCount = 0
+		for _, series := range response.Series {
+			stats.SampleCount += len(series.Samples)
+		}
+	}
+
+	statsCopy := *stats
+
+	util.LockRelease(QueryStatsPoolLock)
+
+	ExportQueryMetrics(queryServer, statsCopy, response.IsError)
+}
+
+// Export the Query stats and QueryServer health as Prometheus metrics
+func ExportQueryMetrics(queryServer data.QueryServer, stats data.QueryStats, isError bool) {
+	labels := app.GetMetricLabelsAndInfo_Query(queryServer.SiteName, stats.QueryServer, stats.Query)
+
+	app.AddToMetricCounter("sireus_query_total", 1, "Queries made to Query Servers, including failed queries", labels)
+	if isError {
+		app.AddToMetricCounter("sireus_query_errors_total", 1, "Queries that failed, after any retries", labels)
+	} else {
+		app.SetMetricGauge("sireus_query_series", float64(stats.SeriesCount), "Series returned by the last successful query", labels)
+		app.SetMetricGauge("sireus_query_samples", float64(stats.SampleCount), "Samples returned by the last successful query", labels)
+	}
+	app.SetMetricGauge("sireus_query_latency_seconds", time.Duration(stats.LastLatency).Seconds(), "Latency of the last query, including retries", labels)
+
+	health := GetQueryServerHealth(queryServer.SiteName, queryServer.Name)
+	serverLabels := app.GetMetricLabelsAndInfo_QueryServer(queryServer.SiteName, queryServer.Name)
+	app.SetMetricGauge("sireus_query_server_healthy", util.BoolToFloat64(health.IsHealthy), "1 if the Query Server is healthy, 0 if its circuit is open", serverLabels)
+	app.SetMetricGauge("sireus_query_server_consecutive_failures", float64(health.ConsecutiveFailures), "Failed queries in a row to the Query Server", serverLabels)
+}
+
+// Returns the stats for a Query, with its Consumers from the Site BotGroups
+func GetQueryStats(site *data.Site, queryServerName string, queryText string) data.QueryStats {
+	util.LockAcquire(QueryStatsPoolLock)
+	stats := data.QueryStats{QueryServer: queryServerName, Query: queryText}
+	if poolStats, ok := QueryStatsPool[GetQueryStatsKey(site.Name, queryServerName, queryText)]; ok {
+		stats = *poolStats
+	}
+	util.LockRelease(QueryStatsPoolLock)
+
+	stats.Consumers = GetQueryConsumers(site, queryServerName, queryText)
+
+	return stats
+}
+
+// Returns the stats for every Query in the Site BotGroups, including Queries that haven't run yet, sorted by
+// QueryServer and Query
+func GetQueryStatsAll(site *data.Site) []data.QueryStats {
+	var statsAll []data.QueryStats
+	seen := make(map[string]bool)
+
+	for _, botGroup := range app.GetSiteLoadedBotGroups(site) {
+		for _, query := range botGroup.Queries {
+			key := GetQueryStatsKey(site.Name, query.QueryServer, query.Query)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			statsAll = append(statsAll, GetQueryStats(site, query.QueryServer, query.Query))
+		}
+	}
+
+	sort.SliceStable(statsAll, func(i, j int) bool {
+		return GetQueryStatsKey(site.Name, statsAll[i].QueryServer, statsAll[i].Query) < GetQueryStatsKey(site.Name, statsAll[j].QueryServer, statsAll[j].Query)
+	})
+
+	return statsAll
+}
+
+// Returns the BotGroups using this Query, and the Variables it populates
+func GetQueryConsumers(site *data.Site, queryServerName string, queryText string) []data.QueryConsumer {
+	consumers := []data.QueryConsumer{}
+
+	for _, botGroup := range app.GetSiteLoadedBotGroups(site) {
+		for _, query := range botGroup.Queries {
+			if query.QueryServer != queryServerName || query.Query != queryText {
+				continue
+			}
+
+			consumer := data.QueryConsumer{
+				BotGroupName:   botGroup.Name,
+				QueryName:      query.Name,
+				IsBotExtractor: botGroup.BotExtractor.QueryName == query.Name,
+				Variables:      []string{},
+			}
+			for _, variable := range botGroup.Variables {
+				if variable.QueryName == query.Name && len(variable.Evaluate) == 0 {
+					consumer.Variables = append(consumer.Variables, variable.Name)
+				}
+			}
+
+			consumers = append(consumers, consumer)
+		}
+	}
+
+	return consumers
+}
+
+// Returns the health of every QueryServer in the Site.  QueryServers that haven't been queried are healthy
+func GetQueryServerHealthAll(site *data.Site) []data.QueryServerHealth {
+	var healthAll []data.QueryServerHealth
+	for _, queryServer := range app.GetSiteQueryServers(site) {
+		healthAll = append(healthAll, GetQueryServerHealth(site.Name, queryServer.Name))
+	}
+	return healthAll
+}
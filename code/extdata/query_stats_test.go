@@ -0,0 +1,56 @@
+package extdata
+
+import (
+	"context"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns 2 series with 3 samples
+type testStatsQueryClient struct{}
+
+func (client testStatsQueryClient) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	return data.QueryResponse{Series: []data.QuerySeries{
+		{Labels: map[string]string{"job": "a"}, Samples: []data.QuerySample{{Time: start, Value: 1}, {Time: start.Add(step), Value: 2}}},
+		{Labels: map[string]string{"job": "b"}, Samples: []data.QuerySample{{Time: start, Value: 3}}},
+	}}
+}
+
+func TestRunQueryNow(t *testing.T) {
+	defer SetQueryClient(SetQueryClient(testStatsQueryClient{}))
+
+	site := &data.Site{
+		QueryServers: []data.QueryServer{{Name: "test_stats"}},
+		QueryResultCache: data.QueryResultPool{
+			PoolItems:  map[string]data.QueryResultPoolItem{},
+			QueryLocks: map[string]time.Time{},
+		},
+		LoadedBotGroups: []data.BotGroup{{
+			Name:         "App",
+			BotExtractor: data.BotExtractorQueryKey{QueryName: "Requests"},
+			Queries:      []data.BotQuery{{QueryServer: "test_stats", Name: "Requests", Query: "requests"}},
+			Variables:    []data.BotVariable{{Name: "requests", QueryName: "Requests"}, {Name: "double", Evaluate: "requests * 2"}},
+		}},
+	}
+
+	_, err := RunQueryNow(site, "test_stats", "missing")
+	assert.NotNil(t, err)
+
+	stats, err := RunQueryNow(site, "test_stats", "requests")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.QueryCount)
+	assert.Equal(t, 2, stats.SeriesCount)
+	assert.Equal(t, 3, stats.SampleCount)
+	assert.False(t, stats.LastSuccess.IsZero())
+	assert.Equal(t, []data.QueryConsumer{{BotGroupName: "App", QueryName: "Requests", IsBotExtractor: true, Variables: []string{"requests"}}}, stats.Consumers)
+
+	// The production cache has the result
+	_, err = GetCachedQueryResult(&data.InteractiveSession{}, site, site.LoadedBotGroups[0].Queries[0])
+	assert.Nil(t, err)
+
+	statsAll := GetQueryStatsAll(site)
+	assert.Len(t, statsAll, 1)
+	assert.True(t, GetQueryServerHealthAll(site)[0].IsHealthy)
+}
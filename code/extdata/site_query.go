@@ -17,7 +17,7 @@ func StoreQueryResult(session *data.InteractiveSession, site *data.Site, query d
 		Query:           query.Query,
 		InteractiveUUID: session.UUID,
 		TimeRequested:   startTime,
-		TimeReceived:    util.GetTimeNow(),
+		TimeReceived:    app.GetSessionTimeNow(session),
 		Result:          queryResult,
 		IsValid:         true, //TODO(ghowland): Check instead of force set.  If it's not valid, we need a way to tell them about the problem, and show them for the BotGroup and Bots so they arent confused as to why it's not working.  Can tell them why it's malformed and show them the result so they can troubleshoot it.
 		QueryStartTime:  session.QueryStartTime,
@@ -43,7 +43,7 @@ func GetCachedQueryResult(session *data.InteractiveSession, site *data.Site, que
 	}
 
 	// Test if it is older than the Interval refresh, this
-	since := util.GetTimeNow().Sub(result.TimeReceived)
+	since := app.GetSessionTimeNow(session).Sub(result.TimeReceived)
 
 	// If we don't want to return values if they are over the Interval, then mark them
 	if since.Seconds() > time.Duration(query.Interval).Seconds() {
@@ -65,6 +65,7 @@ func QueryCacheSet(session *data.InteractiveSession, site *data.Site, query data
 	site.QueryResultCache.QueryPoolSyncLock.Lock()
 	defer site.QueryResultCache.QueryPoolSyncLock.Unlock()
 
+	newCacheItem.TimeAccessed = util.GetTimeNow()
 	site.QueryResultCache.PoolItems[queryKey] = newCacheItem
 }
 
@@ -2,7 +2,6 @@ package extdata
 
 import (
 	"fmt"
-	"github.com/Knetic/govaluate"
 	"github.com/ghowland/sireus/code/app"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/fixgo"
@@ -10,28 +9,50 @@ import (
 	"log"
 	"math"
 	"sort"
-	"strconv"
+	"strings"
 	"time"
 )
 
-// Update all the BotGroups in this Site
-func UpdateSiteBotGroups(session *data.InteractiveSession) {
-	for index := range session.BotGroups {
+// Update all the BotGroups in this Site.  BotGroups are processed in their BotGroup.DependsOn order
+func UpdateSiteBotGroups(session *data.InteractiveSession, site *data.Site) {
+	order, err := app.GetBotGroupDependencyOrder(session.BotGroups)
+	if util.CheckLog(err) {
+		// This was validated at load, so it should never happen, but process them in config order instead of stopping
+		order = []int{}
+		for index := range session.BotGroups {
+			order = append(order, index)
+		}
+	}
+
+	for _, index := range order {
 		// Create Bots in the BotGroup from the Prometheus ExtractorKey query
-		UpdateBotGroupFromPrometheus(session, &data.SireusData.Site, index)
+		UpdateBotGroupFromBotExtractor(session, site, index)
 
 		// Update Bot Variables from our Queries
-		UpdateBotsFromQueries(session, &data.SireusData.Site, index)
+		queryUpdateTime := app.GetSessionTimeNow(session)
+		UpdateBotsFromQueries(session, site, index)
+
+		// Apply the BotVariable.MissingPolicy to Query Variables that didn't get a valid value this pass
+		UpdateBotsWithMissingVariables(session, index, queryUpdateTime)
+
+		// Bots can't be scored on stale data from an unhealthy Query Server, so they are invalid until it recovers
+		UpdateBotsWithUnhealthyQueryServers(session, index)
 
 		// Update Bot Variables from other Query Variables.  Creates Synthetic Variables.
 		//NOTE(ghowland): These can be exported to Prometheus to be used in other apps, as well as Bot.ConditionData
 		UpdateBotsWithSyntheticVariables(session, index)
 
-		// Export Metrics on Variables marked for export
+		// Update the BotGroup Aggregates across all the Bots, and their Peer relative Variables
+		app.UpdateBotGroupAggregates(&session.BotGroups[index])
+
+		// Get the Aggregates and State counts from the BotGroups we depend on.  They were already processed this loop
+		app.UpdateBotGroupDependencyValues(session.BotGroups, index)
+
+		// Export Metrics on Variables and Aggregates marked for export
 		ExportMetricsOnVariables(session, index)
 
 		// Update all the ConditionConsiderations for each bot, so we have all the BotConditionData.FinalScore values
-		UpdateBotConditionConsiderations(session, index)
+		UpdateBotConditionConsiderations(session, index, true)
 
 		// Sort alpha, so they print consistently
 		SortAllVariablesAndConditions(session, index)
@@ -42,7 +63,7 @@ func UpdateSiteBotGroups(session *data.InteractiveSession) {
 		// If we executed conditions, we need to make sure things are updated and sorted again, because they have changed
 		if executedConditions {
 			// Repeat this, to ensure things that are now Inactive after a state change from Executing Conditions
-			UpdateBotConditionConsiderations(session, index)
+			UpdateBotConditionConsiderations(session, index, false)
 			SortAllVariablesAndConditions(session, index)
 		}
 
@@ -63,6 +84,12 @@ func ExecuteBotGroupConditions(session *data.InteractiveSession, botGroupIndex i
 		// Lock the bot, as we are accessing the Condition map
 		util.LockAcquire(bot.LockKey)
 
+		// Invalid Bots don't have all their Variables, so they cannot execute any Conditions
+		if bot.IsInvalid {
+			util.LockRelease(bot.LockKey)
+			continue
+		}
+
 		// Take the top scoring item only and see if it is available and meets any additional requirements
 		if bot.SortedConditionData.Len() > 0 {
 			conditionDataName := bot.SortedConditionData[0].Key
@@ -76,7 +103,7 @@ func ExecuteBotGroupConditions(session *data.InteractiveSession, botGroupIndex i
 
 			// If the condition is available, and the final score is over the threshold, test next steps
 			if conditionData.IsAvailable && conditionData.FinalScore > botGroup.ConditionThreshold {
-				timeAvailable := time.Now().Sub(conditionData.AvailableStartTime)
+				timeAvailable := app.GetSessionTimeNow(session).Sub(conditionData.AvailableStartTime)
 
 				// If we have been available for long enough, this should be the final check, we can execute this Condition
 				if timeAvailable.Seconds() > time.Duration(condition.RequiredAvailable).Seconds() {
@@ -102,7 +129,7 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 	conditionLastExecuteTime, err := app.GetConditionLastExecuteTime(session, botGroup, bot, condition, condition.ExecuteRepeatDelay)
 
 	// Return early if we executed within the delay threshold.  In this case, err means it wasn't executed, so we will perform the execution.  err is not a failure case here
-	if !util.Check(err) && util.GetTimeNow().Sub(conditionLastExecuteTime) < time.Duration(condition.ExecuteRepeatDelay) {
+	if !util.Check(err) && app.GetSessionTimeNow(session).Sub(conditionLastExecuteTime) < time.Duration(condition.ExecuteRepeatDelay) {
 		//log.Printf(fmt.Sprintf("Session Bot Execute Conditions returning early because called too soon: %d  Last: %v  Cur: %v", session.UUID, util.GetTimeNow(), util.GetTimeNow()))
 		return
 	}
@@ -112,7 +139,7 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 		BotGroupName:  botGroup.Name,
 		BotName:       bot.Name,
 		ConditionName: condition.Name,
-		Started:       util.GetTimeNow(),
+		Started:       app.GetSessionTimeNow(session),
 		Score:         conditionData.FinalScore,
 		StatesBefore:  util.CopyStringSlice(bot.StateValues),
 	}
@@ -121,6 +148,7 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 	formatMap := map[string]interface{}{
 		"botGroup":         botGroup,
 		"bot":              bot,
+		"labels":           bot.Labels,
 		"condition":        condition,
 		"conditionCommand": condition.Command,
 		"conditionData":    conditionData,
@@ -129,7 +157,7 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 	commandResult.CommandLog = util.HandlebarFormatData(condition.Command.LogFormat, formatMap)
 
 	// Set the Lock Timers
-	app.SetAllConditionLockTimers(condition, botGroup, condition.Command.LockTimerDuration)
+	app.SetAllConditionLockTimers(condition, botGroup, condition.Command.LockTimerDuration, app.GetSessionTimeNow(session))
 
 	// Update the states
 	err = app.SetBotStates(botGroup, bot, condition.Command.SetBotStates)
@@ -150,9 +178,11 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 	// Save the States after our changes
 	commandResult.StatesAfter = util.CopyStringSlice(bot.StateValues)
 
-	// Execute command
+	// Execute command.  Backtests only record what would have been executed, they never send Commands
 	//TODO(ghowland): Move this to the Sireus Client, so it can be run in different locations to get different access
-	if condition.Command.Type == 1 || condition.Command.Type == 2 {
+	if session.IsBacktest {
+		commandResult.ResultContent = "Backtest: Command not sent"
+	} else if condition.Command.Type == 1 || condition.Command.Type == 2 {
 		url := util.HandlebarFormatData(condition.Command.Content, formatMap)
 		body, err := util.HttpGet(url)
 		if util.Check(err) {
@@ -165,12 +195,15 @@ func ExecuteBotCondition(session *data.InteractiveSession, botGroup *data.BotGro
 	}
 
 	// Mark our completion time
-	commandResult.Finished = util.GetTimeNow()
+	commandResult.Finished = app.GetSessionTimeNow(session)
 
 	// Append the Command Result to the Bots Command History
 	bot.CommandHistory = append(bot.CommandHistory, commandResult)
 
-	// Increment the Metric Counter, that we executed this Condition's Command
+	// Increment the Metric Counter, that we executed this Condition's Command.  Backtests don't change live Metrics
+	if session.IsBacktest {
+		return
+	}
 	app.AddToMetricCounter("sireus_execute_condition", 1, "A Condition met all the requirements and had the highest score, so was executed", app.GetMetricLabelsAndInfo_Condition(botGroup, bot, condition))
 }
 
@@ -180,14 +213,14 @@ func CreateFormattedVariables(session *data.InteractiveSession, botGroupIndex in
 
 	for botIndex := range botGroup.Bots {
 		for varIndex, value := range session.BotGroups[botGroupIndex].Bots[botIndex].SortedVariableValues {
-			variable, err := app.GetVariable(botGroup, value.Key)
+			format, err := GetVariableOrAggregateFormat(botGroup, value.Key)
 			if util.Check(err) {
 				// Mark this bot as Invalid, because it is missing information
 				session.BotGroups[botGroupIndex].Bots[botIndex].IsInvalid = true
 				session.BotGroups[botGroupIndex].Bots[botIndex].InfoInvalid += fmt.Sprintf("Missing Variable: %s.  ", value.Key)
 			}
 
-			result := app.FormatBotVariable(variable.Format, value.Value)
+			result := app.FormatBotVariable(format, value.Value)
 
 			newPair := session.BotGroups[botGroupIndex].Bots[botIndex].SortedVariableValues[varIndex]
 			newPair.Formatted = result
@@ -197,15 +230,46 @@ func CreateFormattedVariables(session *data.InteractiveSession, botGroupIndex in
 	}
 }
 
+// Returns the format for a Bot.VariableValues key.  These are BotVariables, or Peer relative BotGroupAggregates
+func GetVariableOrAggregateFormat(botGroup *data.BotGroup, name string) (data.BotVariableFormat, error) {
+	variable, err := app.GetVariableOrFamily(botGroup, name)
+	if !util.Check(err) {
+		return variable.Format, nil
+	}
+
+	aggregate, errAggregate := app.GetBotGroupAggregate(botGroup, name)
+	if !util.Check(errAggregate) && aggregate.Type.IsPeerRelative() {
+		return aggregate.Format, nil
+	}
+
+	return data.FormatFloat, err
+}
+
 func ExportMetricsOnVariables(session *data.InteractiveSession, botGroupIndex int) {
 	botGroup := &session.BotGroups[botGroupIndex]
 
+	// Backtests replay historical data, which would overwrite the live Metrics
+	if session.IsBacktest {
+		return
+	}
+
 	// For all the BotGroup variables that are marked for Export...
 	for _, varData := range botGroup.Variables {
 		if varData.Export {
 			// Export them for every bot that has them
 			for botIndex := range botGroup.Bots {
 				bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
+
+				// Variable Families export every member
+				if app.IsVariableFamily(varData.Name) {
+					for memberName, value := range bot.VariableValues {
+						if owner, ok := app.GetVariableFamilyOwner(botGroup, memberName); ok && owner.Name == varData.Name {
+							app.SetMetricGauge("sireus_variable", value, "A Bot variable marked for exporting, probably synthesized", app.GetMetricLabelsAndInfo_BotVariable(botGroup, bot, memberName))
+						}
+					}
+					continue
+				}
+
 				value, ok := bot.VariableValues[varData.Name]
 				if !ok {
 					continue
@@ -216,6 +280,31 @@ func ExportMetricsOnVariables(session *data.InteractiveSession, botGroupIndex in
 		}
 	}
 
+	// Export the Aggregates marked for export.  Peer relative ones are per Bot, like Variables
+	for _, aggregate := range botGroup.Aggregates {
+		if !aggregate.Export {
+			continue
+		}
+
+		if aggregate.Type.IsPeerRelative() {
+			for botIndex := range botGroup.Bots {
+				bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
+				value, ok := bot.VariableValues[aggregate.Name]
+				if !ok {
+					continue
+				}
+
+				app.SetMetricGauge("sireus_variable", value, "A Bot variable marked for exporting, probably synthesized", app.GetMetricLabelsAndInfo_BotVariable(botGroup, bot, aggregate.Name))
+			}
+		} else {
+			value, ok := botGroup.AggregateValues[aggregate.Name]
+			if !ok {
+				continue
+			}
+
+			app.SetMetricGauge("sireus_aggregate", value, "A Bot Group aggregate across all Bots, marked for exporting", app.GetMetricLabelsAndInfo_BotGroupAggregate(botGroup, aggregate.Name))
+		}
+	}
 }
 
 // Sort all the Variables by name and Conditions by Final Score
@@ -242,8 +331,10 @@ func SortAllVariablesAndConditions(session *data.InteractiveSession, botGroupInd
 	}
 }
 
-// For this BotGroup, update all the BotConditionData with new ConditionConsideration scores
-func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroupIndex int) {
+// For this BotGroup, update all the BotConditionData with new ConditionConsideration scores.  If updateHistory is true,
+// the Condition.ScoreSmoothing and Condition.AvailableWindowSize state is advanced.  Only once per pass, so
+// re-evaluations don't count twice.
+func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroupIndex int, updateHistory bool) {
 	botGroup := &session.BotGroups[botGroupIndex]
 
 	for botIndex := range botGroup.Bots {
@@ -251,12 +342,12 @@ func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroup
 		util.LockAcquire(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 		bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
 
-		evalMap := GetBotEvalMapAllVariables(bot)
+		evalMap := GetBotEvalMapAllVariables(botGroup, bot)
 
 		for _, condition := range botGroup.Conditions {
 			// If we don't have this ConditionData yet, add it.  This will stay with the Bot for its lifetime, tracking ActiveStateTime and LastExecutionTime.
-			if _, ok := session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name]; !ok {
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name] = data.BotConditionData{
+			if _, ok := bot.ConditionData[condition.Name]; !ok {
+				bot.ConditionData[condition.Name] = data.BotConditionData{
 					ConsiderationFinalScores:  map[string]float64{},
 					ConsiderationCurvedScores: map[string]float64{},
 					ConsiderationRangedScores: map[string]float64{},
@@ -264,71 +355,76 @@ func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroup
 				}
 			}
 
+			explanation := data.ConditionExplanation{
+				ConditionName:  condition.Name,
+				ScoreSmoothing: condition.ScoreSmoothing,
+			}
+
 			for _, consider := range condition.Considerations {
-				// Compile Express to be used by every bot, with their own data
-				expression, err := govaluate.NewEvaluableExpression(consider.Evaluate)
+				// Get the Expression compiled at config load, to be used by every bot, with their own data
+				expression, err := app.GetBotGroupExpression(botGroup, consider.Evaluate)
 				util.CheckLog(err)
 
-				// Start assuming the data is invalid, and then mark it valid later
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationFinalScores[consider.Name] = math.SmallestNonzeroFloat64
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationCurvedScores[consider.Name] = math.SmallestNonzeroFloat64
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationRangedScores[consider.Name] = math.SmallestNonzeroFloat64
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationRawScores[consider.Name] = math.SmallestNonzeroFloat64
-
-				resultInt, err := expression.Evaluate(evalMap)
-				if util.Check(err) {
-					// Invalidate this consideration, evaluation failed
-					//log.Printf("ERROR: Evaluate failed on Eval Map data: %s   Map: %s", consider.Evaluate, util.PrintJson(evalMap))
-					continue
-				}
-
-				resultRaw, err := util.ConvertInterfaceToFloat(resultInt)
-				if util.Check(err) { //TODO(ghowland): Need to handle these invalid values, so that this Bot is marked as Invalid, because the scoring cannot be done properly for every Condition
-					// Invalidate this consideration, result was invalid
-					//log.Printf("Set Consideration Invalid: %s", consider.Name)
-					continue
-				}
+				considerExplanation := app.ScoreConsideration(consider, expression, evalMap)
+				explanation.Considerations = append(explanation.Considerations, considerExplanation)
 
-				// Apply the Range and Curve to the Raw score
-				resultRanged := util.RangeMapper(resultRaw, consider.RangeStart, consider.RangeEnd)
-				curve, err := app.GetCurve(consider.CurveName)
-				if util.Check(err) {
-					// Invalidate this consideration, result was invalid
-					log.Printf("Set Consideration Invalid, no curve: %s   Curve missing: %s", consider.Name, consider.CurveName)
+				if !considerExplanation.IsValid {
+					// Invalidate this consideration.  SmallestNonzeroFloat64 marks it invalid without forcing the Condition to 0
+					//log.Printf("Set Consideration Invalid: %s  Error: %s", consider.Name, considerExplanation.Error)
+					bot.ConditionData[condition.Name].ConsiderationFinalScores[consider.Name] = math.SmallestNonzeroFloat64
+					bot.ConditionData[condition.Name].ConsiderationCurvedScores[consider.Name] = math.SmallestNonzeroFloat64
+					bot.ConditionData[condition.Name].ConsiderationRangedScores[consider.Name] = math.SmallestNonzeroFloat64
+					bot.ConditionData[condition.Name].ConsiderationRawScores[consider.Name] = math.SmallestNonzeroFloat64
 					continue
 				}
-				resultCurved := app.GetCurveValue(curve, resultRanged)
-
-				//log.Printf("Set Consideration Result: %s = %v", consider.Name, resultCurved)
-
-				considerationScore := resultCurved * consider.Weight
 
 				// Set the value.  Only valid values will exist.
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationFinalScores[consider.Name] = considerationScore
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationCurvedScores[consider.Name] = resultCurved
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationRangedScores[consider.Name] = resultRanged
-				session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name].ConsiderationRawScores[consider.Name] = resultRaw
+				bot.ConditionData[condition.Name].ConsiderationFinalScores[consider.Name] = considerExplanation.Weighted
+				bot.ConditionData[condition.Name].ConsiderationCurvedScores[consider.Name] = considerExplanation.Curved
+				bot.ConditionData[condition.Name].ConsiderationRangedScores[consider.Name] = considerExplanation.Ranged
+				bot.ConditionData[condition.Name].ConsiderationRawScores[consider.Name] = considerExplanation.Raw
 			}
 
 			// Get a Final Score for this Condition
-			calculatedScore, details := app.CalculateScore(condition, session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name])
-			finalScore := calculatedScore * condition.Weight
+			calculatedScore, details, aggregation := app.CalculateScore(condition, bot.ConditionData[condition.Name])
+			rawScore := calculatedScore * condition.Weight
+			explanation.Aggregation = aggregation
 
-			details = append(details, fmt.Sprintf("All Consider Scores: %0.2f * Condition Weight: %0.2f = Final Score: %0.2f", calculatedScore, condition.Weight, finalScore))
+			details = append(details, fmt.Sprintf("All Consider Scores: %0.2f * Condition Weight: %0.2f = Raw Score: %0.2f", calculatedScore, condition.Weight, rawScore))
 
 			// Copy out the ConditionData struct, updated it, and assign it back into the map.
-			conditionData := session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name]
+			conditionData := bot.ConditionData[condition.Name]
+			conditionData.RawScore = rawScore
+
+			// Smoothing and the Available window are only advanced once per pass, re-evaluations after executing use the current values
+			if updateHistory {
+				conditionData.SmoothedScore = app.SmoothConditionScore(condition, conditionData, rawScore)
+				conditionData.EvaluationCount++
+			}
+			finalScore := rawScore
+			if condition.ScoreSmoothing > 0 {
+				finalScore = conditionData.SmoothedScore
+				details = append(details, fmt.Sprintf("Raw Score: %0.2f  Smoothing: %0.2f = Final Score: %0.2f", rawScore, condition.ScoreSmoothing, finalScore))
+			}
 			conditionData.FinalScore = finalScore
 
-			allConditionStatesAreActive := app.AreAllConditionStatesActive(condition, bot)
+			allConditionStatesAreActive := app.AreAllConditionStatesActive(condition, bot, session.BotGroups)
+
+			allConditionRequiredLocksTimersAvailable := app.AreAllConditionLockTimersAvailable(condition, botGroup, app.GetSessionTimeNow(session))
 
-			allConditionRequiredLocksTimersAvailable := app.AreAllConditionLockTimersAvailable(condition, botGroup)
+			// Condition.WeightThreshold and Condition.WeightThresholdExit determine if the score allows this Condition to be available
+			isOverThreshold := app.IsConditionScoreOverThreshold(condition, conditionData.IsAvailable, finalScore)
+			if updateHistory {
+				conditionData.AvailableHistory = app.AddConditionAvailableHistory(condition, conditionData.AvailableHistory, isOverThreshold)
+			}
+			isWindowMet := app.IsConditionAvailableWindowMet(condition, conditionData.AvailableHistory)
 
-			// Condition.WeightThreshold determines if a Condition is available for possible execution
-			if finalScore >= condition.WeightThreshold && allConditionStatesAreActive && allConditionRequiredLocksTimersAvailable {
+			explanation.Gates = app.GetConditionAvailableGates(condition, conditionData.IsAvailable, finalScore, isOverThreshold, isWindowMet, allConditionStatesAreActive, allConditionRequiredLocksTimersAvailable)
+
+			if isOverThreshold && isWindowMet && allConditionStatesAreActive && allConditionRequiredLocksTimersAvailable {
 				if !conditionData.IsAvailable {
 					conditionData.IsAvailable = true
-					conditionData.AvailableStartTime = util.GetTimeNow()
+					conditionData.AvailableStartTime = app.GetSessionTimeNow(session)
 				}
 			} else {
 				if !allConditionStatesAreActive {
@@ -340,17 +436,35 @@ func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroup
 					details = append(details, fmt.Sprintf("Not available.  Missing required Lock Timers: %s", util.PrintStringArrayCSV(condition.RequiredLockTimers)))
 				}
 
-				if finalScore < condition.WeightThreshold {
-					details = append(details, fmt.Sprintf("Final Score (%.2f) less tha Condition Weight Threshold (%.2f)", finalScore, condition.WeightThreshold))
+				if !isOverThreshold {
+					if conditionData.IsAvailable && condition.WeightThresholdExit != 0 {
+						details = append(details, fmt.Sprintf("Final Score (%.2f) less than Condition Weight Threshold Exit (%.2f)", finalScore, condition.WeightThresholdExit))
+					} else {
+						details = append(details, fmt.Sprintf("Final Score (%.2f) less tha Condition Weight Threshold (%.2f)", finalScore, condition.WeightThreshold))
+					}
+				}
+
+				if !isWindowMet {
+					details = append(details, fmt.Sprintf("Not available.  Over threshold in fewer than %d of the last %d evaluations", condition.AvailableWindowRequired, condition.AvailableWindowSize))
 				}
 
 				conditionData.IsAvailable = false
 				conditionData.AvailableStartTime = time.UnixMilli(0)
 			}
 
-			// Details explain what happen in text, so users can better understand their results
+			// Execution gates are checked after availability, because Required Available depends on it
+			explanation.Gates = append(explanation.Gates, app.GetConditionExecuteGates(session, botGroup, bot, condition, conditionData)...)
+
+			explanation.RawScore = conditionData.RawScore
+			explanation.SmoothedScore = conditionData.SmoothedScore
+			explanation.FinalScore = conditionData.FinalScore
+			explanation.IsAvailable = conditionData.IsAvailable
+			explanation.CanExecute = app.AreAllConditionGatesPassed(explanation.Gates)
+
+			// Details explain what happen in text, so users can better understand their results.  Explanation is the structured version
 			conditionData.Details = details
-			session.BotGroups[botGroupIndex].Bots[botIndex].ConditionData[condition.Name] = conditionData
+			conditionData.Explanation = explanation
+			bot.ConditionData[condition.Name] = conditionData
 		}
 
 		// Cant use defer, because we are processing many in 1 condition
@@ -358,36 +472,40 @@ func UpdateBotConditionConsiderations(session *data.InteractiveSession, botGroup
 	}
 }
 
-// Update bot with Synthetic Variables.  Happens after all the Query Variables are set.  Synthetic vars can't work on each other
+// Update bot with Synthetic Variables.  Happens after all the Query Variables are set.  Synthetic Variables are
+// evaluated in BotGroup.SyntheticVariableOrder, so they can use Query Variables and any Synthetic Variables they reference
 func UpdateBotsWithSyntheticVariables(session *data.InteractiveSession, botGroupIndex int) {
 	botGroup := &session.BotGroups[botGroupIndex]
 
-	// Create a list of names
-	var queryVariableNames []string
+	// Create a list of names that are available to evaluate.  Starts with the Query Variables, and each Synthetic
+	// Variable is added after it is evaluated
+	var availableVariableNames []string
 	for _, variable := range botGroup.Variables {
-		// Skip non-Synthetic variables
+		// Skip Synthetic variables
 		if len(variable.Evaluate) > 0 {
 			continue
 		}
 
-		queryVariableNames = append(queryVariableNames, variable.Name)
+		availableVariableNames = append(availableVariableNames, variable.Name)
 	}
 
-	for _, variable := range botGroup.Variables {
-		// Skip non-Synthetic variables
-		if len(variable.Evaluate) == 0 {
+	for _, variableName := range botGroup.SyntheticVariableOrder {
+		variable, err := app.GetVariable(botGroup, variableName)
+		if util.CheckLog(err) {
 			continue
 		}
 
-		// Compile Express to be used by every bot, with their own data
-		expression, err := govaluate.NewEvaluableExpression(variable.Evaluate)
-		util.CheckLog(err)
+		// Get the Expression compiled at config load, to be used by every bot, with their own data
+		expression, err := app.GetBotGroupExpression(botGroup, variable.Evaluate)
+		if util.CheckLog(err) {
+			continue
+		}
 
 		for botIndex := range botGroup.Bots {
 			// Lock the bot
 			util.LockAcquire(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 
-			evalMap := GetBotEvalMapOnlyQueries(session.BotGroups[botGroupIndex].Bots[botIndex], queryVariableNames)
+			evalMap := GetBotEvalMapOnlyVariables(botGroup, session.BotGroups[botGroupIndex].Bots[botIndex], availableVariableNames)
 
 			//log.Printf("Eval Map: %v", evalMap)
 
@@ -396,6 +514,8 @@ func UpdateBotsWithSyntheticVariables(session *data.InteractiveSession, botGroup
 
 			result, err := util.ConvertInterfaceToFloat(resultInt)
 			if util.CheckLog(err) {
+				// Remove any previous value, this Synthetic Variable is missing because a Variable it uses is missing
+				delete(session.BotGroups[botGroupIndex].Bots[botIndex].VariableValues, variable.Name)
 				util.LockRelease(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 				continue // Skip this variable, it was invalid
 			}
@@ -409,40 +529,64 @@ func UpdateBotsWithSyntheticVariables(session *data.InteractiveSession, botGroup
 			// Unlock the bot
 			util.LockRelease(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 		}
+
+		// Later Synthetic Variables can use this one now
+		availableVariableNames = append(availableVariableNames, variable.Name)
 	}
 }
 
-// Returns the map for doing the Evaluate against a Query to create our Scores.  Uses Govaluate.Evaluate()
+// Returns the map for doing the Evaluate against only the named Variables, so Synthetic Variables only see Variables
+// which have already been set on this pass.  Uses Govaluate.Evaluate()
 // NOTE(ghowland): bot.AccessLock should already be locked before we come here, because we are accessing a map
-func GetBotEvalMapOnlyQueries(bot data.Bot, queryVariableNames []string) map[string]interface{} {
+func GetBotEvalMapOnlyVariables(botGroup *data.BotGroup, bot data.Bot, variableNames []string) map[string]interface{} {
 	evalMap := make(map[string]interface{})
 
 	// Build a map from bots variables
 	for variableName, value := range bot.VariableValues {
-		// Only add variables that are Query Variables, because they are known before synthetic evaluation
-		if util.StringInSlice(queryVariableNames, variableName) {
+		// Only add variables that are in our list, because they are known to be set before this evaluation
+		if util.StringInSlice(variableNames, variableName) || IsVariableFamilyMemberInList(botGroup, variableNames, variableName) {
 			evalMap[variableName] = value
 		}
 	}
 
+	app.AddExpressionContext(evalMap, botGroup, &bot)
+
 	return evalMap
 }
 
-// Returns the map for doing the Evaluate with a Bots VariableValues.  Uses Govaluate.Evaluate()
+// Returns true if the name is a member of a Variable Family in the list of Variable names
+func IsVariableFamilyMemberInList(botGroup *data.BotGroup, variableNames []string, name string) bool {
+	owner, ok := app.GetVariableFamilyOwner(botGroup, name)
+	return ok && util.StringInSlice(variableNames, owner.Name)
+}
+
+// Returns the map for doing the Evaluate with a Bots VariableValues and the BotGroup.AggregateValues.  Uses Govaluate.Evaluate()
 // NOTE(ghowland): bot.AccessLock should already be locked before we come here, because we are accessing a map
-func GetBotEvalMapAllVariables(bot *data.Bot) map[string]interface{} {
+func GetBotEvalMapAllVariables(botGroup *data.BotGroup, bot *data.Bot) map[string]interface{} {
 	evalMap := make(map[string]interface{})
 
+	// Values from the BotGroup.DependsOn BotGroups are shared by all the Bots.  Their keys always contain a "."
+	for dependencyName, value := range botGroup.DependencyValues {
+		evalMap[dependencyName] = value
+	}
+
+	// Group level Aggregates are shared by all the Bots.  Bot variables are added after, so they win any name conflict
+	for aggregateName, value := range botGroup.AggregateValues {
+		evalMap[aggregateName] = value
+	}
+
 	// Build a map bot variables
 	for variableName, value := range bot.VariableValues {
 		evalMap[variableName] = value
 	}
 
+	app.AddExpressionContext(evalMap, botGroup, bot)
+
 	return evalMap
 }
 
-// Runs Queries against Prometheus for a BotGroup
-func UpdateBotGroupFromPrometheus(session *data.InteractiveSession, site *data.Site, botGroupIndex int) {
+// Creates new Bots for a BotGroup from its BotExtractor Query
+func UpdateBotGroupFromBotExtractor(session *data.InteractiveSession, site *data.Site, botGroupIndex int) {
 	query, err := app.GetQuery(&session.BotGroups[botGroupIndex], session.BotGroups[botGroupIndex].BotExtractor.QueryName)
 	util.CheckLog(err)
 
@@ -450,7 +594,7 @@ func UpdateBotGroupFromPrometheus(session *data.InteractiveSession, site *data.S
 
 	//log.Printf("Extractor Query: %s", util.PrintJson(queryResult))
 
-	extractedBots := ExtractBotsFromPromData(queryResult.PrometheusResponse, &session.BotGroups[botGroupIndex])
+	extractedBots := ExtractBotsFromQueryResponse(queryResult.Response, &session.BotGroups[botGroupIndex])
 
 	//log.Printf("Extracted Bots: %s", util.PrintJson(extractedBots))
 
@@ -458,9 +602,15 @@ func UpdateBotGroupFromPrometheus(session *data.InteractiveSession, site *data.S
 	//NOTE(ghowland): Removing bots is done by looking at bots that haven't had data updated past BotGroup.BotTimeoutRemove
 	for _, botNew := range extractedBots {
 		var foundBot bool
-		for _, botCur := range session.BotGroups[botGroupIndex].Bots {
+		for botIndex := range session.BotGroups[botGroupIndex].Bots {
+			botCur := &session.BotGroups[botGroupIndex].Bots[botIndex]
 			if botCur.Name == botNew.Name {
 				foundBot = true
+
+				// Labels outside the Keys can change, like a version, so always take the latest
+				util.LockAcquire(botCur.LockKey)
+				botCur.Labels = botNew.Labels
+				util.LockRelease(botCur.LockKey)
 			}
 		}
 
@@ -473,7 +623,9 @@ func UpdateBotGroupFromPrometheus(session *data.InteractiveSession, site *data.S
 		}
 
 		// Export that this bot exists, so we can track when they come and go
-		app.SetMetricGauge("sireus_bot_exists", 1, "As long as Sireus sees this bot in the metrics, it will set this to 1, can verify Sireus could see this information", app.GetMetricLabelsAndInfo_Bot(&session.BotGroups[botGroupIndex], &botNew))
+		if !session.IsBacktest {
+			app.SetMetricGauge("sireus_bot_exists", 1, "As long as Sireus sees this bot in the metrics, it will set this to 1, can verify Sireus could see this information", app.GetMetricLabelsAndInfo_Bot(&session.BotGroups[botGroupIndex], &botNew))
+		}
 	}
 }
 
@@ -490,6 +642,187 @@ func InitializeBotStates(botGroup *data.BotGroup, bot *data.Bot) {
 	sort.Strings(bot.StateValues)
 }
 
+// Returns the first sample value of a QuerySeries.  Returns false if there is no sample, so it is missing
+func GetQuerySeriesValue(series data.QuerySeries) (float64, bool) {
+	if len(series.Samples) == 0 {
+		return 0, false
+	}
+
+	return series.Samples[0].Value, true
+}
+
+// Extract our ephemeral Bots from the QueryResponse, using the BotKey extractor information
+func ExtractBotsFromQueryResponse(response data.QueryResponse, botGroup *data.BotGroup) []data.Bot {
+	bots := make(map[string]data.Bot)
+
+	for _, series := range response.Series {
+		name, ok := GetBotNameFromLabels(botGroup.BotExtractor, series.Labels)
+		if !ok {
+			continue
+		}
+
+		_, exists := bots[name]
+		if !exists {
+			bots[name] = data.Bot{
+				Name:                name,
+				Labels:              CopyLabels(series.Labels),
+				LockKey:             fmt.Sprintf("%s.%s", botGroup.LockKey, name),
+				ConditionData:       map[string]data.BotConditionData{},
+				StateValues:         []string{},
+				VariableValues:      map[string]float64{},
+				VariableUpdateTimes: map[string]time.Time{},
+			}
+		}
+	}
+
+	// Add all the bots to a final array.  The map allowed us to ensure no duplicate entries, as that is allowed.
+	var botArray []data.Bot
+	for _, bot := range bots {
+		botArray = append(botArray, bot)
+	}
+
+	return botArray
+}
+
+// Returns the BotExtractorQueryKey.Keys, or the single Key if Keys is not set
+func GetBotExtractorKeys(extractor data.BotExtractorQueryKey) []string {
+	if len(extractor.Keys) > 0 {
+		return extractor.Keys
+	}
+	return []string{extractor.Key}
+}
+
+// Returns the Bot.Name for a series' labels, from the BotExtractorQueryKey.  Returns false if the series is missing
+// any of the Keys, so it can't identify a Bot.  A single Key keeps the original behavior of any value being the name.
+func GetBotNameFromLabels(extractor data.BotExtractorQueryKey, labels map[string]string) (string, bool) {
+	if len(extractor.Keys) == 0 {
+		return labels[extractor.Key], true
+	}
+
+	var values []string
+	for _, key := range extractor.Keys {
+		value, ok := labels[key]
+		if !ok || value == "" {
+			return "", false
+		}
+		values = append(values, value)
+	}
+
+	if extractor.NameFormat != "" {
+		return util.HandlebarFormatText(extractor.NameFormat, labels), true
+	}
+
+	return strings.Join(values, "/"), true
+}
+
+// Returns true if a Query Variable's series belongs to this Bot.  BotKeys must all match Bot.Labels, BotKey must match
+// Bot.Name, and with neither every Bot accepts the series
+func IsQuerySeriesForBot(variable data.BotVariable, labels map[string]string, bot *data.Bot) bool {
+	if len(variable.BotKeys) > 0 {
+		for _, key := range variable.BotKeys {
+			value, ok := labels[key]
+			if !ok || value != bot.Labels[key] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(variable.BotKey) > 0 {
+		return labels[variable.BotKey] == bot.Name
+	}
+
+	return true
+}
+
+// Returns a copy of a labels map, so Bots don't share the cached QueryResponse's maps
+func CopyLabels(labels map[string]string) map[string]string {
+	output := make(map[string]string, len(labels))
+	for key, value := range labels {
+		output[key] = value
+	}
+	return output
+}
+
+// Apply the BotVariable.MissingPolicy to every Query Variable that did not get a valid value since updateTime.  This
+// also resets Bot.IsInvalid, so a Bot becomes valid again as soon as its Variables return.
+func UpdateBotsWithMissingVariables(session *data.InteractiveSession, botGroupIndex int, updateTime time.Time) {
+	botGroup := &session.BotGroups[botGroupIndex]
+
+	for botIndex := range botGroup.Bots {
+		bot := &botGroup.Bots[botIndex]
+
+		util.LockAcquire(bot.LockKey)
+
+		bot.IsInvalid = false
+		bot.InfoInvalid = ""
+
+		for _, variable := range botGroup.Variables {
+			// Synthetic Variables are missing when their inputs are missing, and templated names have no fixed name to check
+			if len(variable.Evaluate) > 0 || strings.Contains(variable.Name, "{{") {
+				continue
+			}
+
+			lastUpdate, ok := bot.VariableUpdateTimes[variable.Name]
+			if ok && !lastUpdate.Before(updateTime) {
+				continue
+			}
+
+			switch variable.MissingPolicy {
+			case data.MissingTreatAsZero:
+				bot.VariableValues[variable.Name] = 0
+			case data.MissingUseDefault:
+				bot.VariableValues[variable.Name] = variable.MissingDefault
+			case data.MissingHoldLast:
+				// Keep the last valid value, until it has been held too long
+				if ok && updateTime.Sub(lastUpdate) <= time.Duration(variable.MissingHoldDuration) {
+					continue
+				}
+				delete(bot.VariableValues, variable.Name)
+				bot.IsInvalid = true
+				bot.InfoInvalid += fmt.Sprintf("Missing Variable past hold duration: %s.  ", variable.Name)
+			case data.MissingInvalidate:
+				delete(bot.VariableValues, variable.Name)
+				bot.IsInvalid = true
+				bot.InfoInvalid += fmt.Sprintf("Missing Variable: %s.  ", variable.Name)
+			}
+		}
+
+		util.LockRelease(bot.LockKey)
+	}
+}
+
+// Invalidate all the Bots in a BotGroup if any of its Queries use an unhealthy QueryServer.  This runs after
+// UpdateBotsWithMissingVariables, which resets Bot.IsInvalid.  Only the production session (UUID 0) uses the live
+// QueryServer health.  Interactive sessions and Backtests query other times, so their Bots are not invalidated.
+func UpdateBotsWithUnhealthyQueryServers(session *data.InteractiveSession, botGroupIndex int) {
+	if session.UUID != 0 {
+		return
+	}
+
+	botGroup := &session.BotGroups[botGroupIndex]
+
+	infoInvalid := ""
+	for _, query := range botGroup.Queries {
+		if !IsQueryServerHealthy(botGroup.SiteName, query.QueryServer) {
+			infoInvalid += fmt.Sprintf("Query Server unhealthy: %s  Query: %s.  ", query.QueryServer, query.Name)
+		}
+	}
+
+	if infoInvalid == "" {
+		return
+	}
+
+	for botIndex := range botGroup.Bots {
+		bot := &botGroup.Bots[botIndex]
+
+		util.LockAcquire(bot.LockKey)
+		bot.IsInvalid = true
+		bot.InfoInvalid += infoInvalid
+		util.LockRelease(bot.LockKey)
+	}
+}
+
 // Update all the Bot VariableValues from our Queries
 func UpdateBotsFromQueries(session *data.InteractiveSession, site *data.Site, botGroupIndex int) {
 	botGroup := session.BotGroups[botGroupIndex]
@@ -502,8 +835,8 @@ func UpdateBotsFromQueries(session *data.InteractiveSession, site *data.Site, bo
 			continue // Couldn't get this query, skip
 		}
 
-		// Loop over the Prom Results, matching Variables to Bots to save their VariableValues
-		for _, promResult := range queryResult.PrometheusResponse.Data.Result {
+		// Loop over the Query Series, matching Variables to Bots to save their VariableValues
+		for _, series := range queryResult.Response.Series {
 			// Loop through all the Variables, for every Bot.  In a Bot Group, all Bots are expected to have the same vars
 			for _, variable := range botGroup.Variables {
 				// Skip variables that don't match this query, OR we have an Evaluate value, so this is a Synthetic Variable (not from Query)
@@ -511,38 +844,41 @@ func UpdateBotsFromQueries(session *data.InteractiveSession, site *data.Site, bo
 					continue
 				}
 
-				//log.Printf("Bot Group: %s  Variable: %s  Key: %s == %v", botGroup.Name, variable.Name, variable.QueryKeyValue, promResult.Metric[variable.QueryKey])
+				//log.Printf("Bot Group: %s  Variable: %s  Key: %s == %v", botGroup.Name, variable.Name, variable.QueryKeyValue, series.Labels[variable.QueryKey])
 
 				// If we have a match for this variable, next look for what Bot it matches, or it has no QueryKey we always accept it
-				if len(variable.QueryKey) == 0 || (len(variable.QueryKey) > 0 && variable.QueryKeyValue == promResult.Metric[variable.QueryKey]) {
+				if len(variable.QueryKey) == 0 || (len(variable.QueryKey) > 0 && variable.QueryKeyValue == series.Labels[variable.QueryKey]) {
 					//if variable.QueryKey == "volume" {
-					//	log.Printf("Bot Group: %s   Var Bot Key: '%s'  Variable: %s  Key: %s == %v -> %v", botGroup.Name, variable.BotKey, variable.Name, variable.QueryKeyValue, promResult.Metric[variable.QueryKey], variable.QueryKeyValue == promResult.Metric[variable.QueryKey])
+					//	log.Printf("Bot Group: %s   Var Bot Key: '%s'  Variable: %s  Key: %s == %v -> %v", botGroup.Name, variable.BotKey, variable.Name, variable.QueryKeyValue, series.Labels[variable.QueryKey], variable.QueryKeyValue == series.Labels[variable.QueryKey])
 					//}
 
 					for botIndex := range botGroup.Bots {
 						// Lock
 						util.LockAcquire(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 
-						// If this Metric BotKey matches the Bot name OR the BotKey is empty, it is always accepted
+						// If this Metric BotKey or BotKeys matches the Bot OR they are empty, it is always accepted
 						//NOTE(ghowland): Empty BotKey is used to pull data that is not specific to this Bot, but can be used as a general signal
-						if promResult.Metric[variable.BotKey] == session.BotGroups[botGroupIndex].Bots[botIndex].Name || len(variable.BotKey) == 0 {
+						if IsQuerySeriesForBot(variable, series.Labels, &session.BotGroups[botGroupIndex].Bots[botIndex]) {
 
 							//if variable.QueryName == "CPU Usage" {
-							//	log.Printf("Bot Group: %s  Bot: %s   Var Bot Key: '%s'  Variable: %s  Key: %s == %v -> %v", botGroup.Name, bot.Name, variable.BotKey, variable.Name, variable.QueryKeyValue, promResult.Metric[variable.QueryKey], variable.QueryKeyValue == promResult.Metric[variable.QueryKey])
+							//	log.Printf("Bot Group: %s  Bot: %s   Var Bot Key: '%s'  Variable: %s  Key: %s == %v -> %v", botGroup.Name, bot.Name, variable.BotKey, variable.Name, variable.QueryKeyValue, series.Labels[variable.QueryKey], variable.QueryKeyValue == series.Labels[variable.QueryKey])
 							//}
 
-							value := math.SmallestNonzeroFloat64
-							if len(promResult.Values) > 0 && len(promResult.Values[0]) > 0 {
-								value, err = strconv.ParseFloat(promResult.Values[0][1].(string), 32)
-								util.CheckLog(err)
+							nameFormatted := util.HandlebarFormatText(variable.Name, series.Labels)
+
+							// Only valid samples are set.  No sample, NaN or Inf are missing, and BotVariable.MissingPolicy is applied after all the Queries
+							value, ok := GetQuerySeriesValue(series)
+							if ok {
+								bot := &session.BotGroups[botGroupIndex].Bots[botIndex]
+								bot.VariableValues[nameFormatted] = value
+								if bot.VariableUpdateTimes == nil {
+									bot.VariableUpdateTimes = make(map[string]time.Time)
+								}
+								bot.VariableUpdateTimes[nameFormatted] = app.GetSessionTimeNow(session)
 							}
 
-							nameFormatted := util.HandlebarFormatText(variable.Name, promResult.Metric)
-
-							session.BotGroups[botGroupIndex].Bots[botIndex].VariableValues[nameFormatted] = value
-
-							// If we were matching on a BotKey (normal), stop looking.  If no BotKey, do them all.
-							if len(variable.BotKey) > 0 {
+							// If we were matching on a BotKey or BotKeys (normal), stop looking.  If no BotKey, do them all.
+							if len(variable.BotKey) > 0 || len(variable.BotKeys) > 0 {
 								// Unlock
 								util.LockRelease(session.BotGroups[botGroupIndex].Bots[botIndex].LockKey)
 								break
@@ -0,0 +1,113 @@
+package extdata
+
+import (
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGetBotNameFromLabels(t *testing.T) {
+	labels := map[string]string{"cluster": "east", "instance": "db1", "version": "2"}
+
+	name, ok := GetBotNameFromLabels(data.BotExtractorQueryKey{Key: "instance"}, labels)
+	assert.True(t, ok)
+	assert.Equal(t, "db1", name)
+
+	name, ok = GetBotNameFromLabels(data.BotExtractorQueryKey{Keys: []string{"cluster", "instance"}}, labels)
+	assert.True(t, ok)
+	assert.Equal(t, "east/db1", name)
+
+	name, ok = GetBotNameFromLabels(data.BotExtractorQueryKey{Keys: []string{"cluster", "instance"}, NameFormat: "{{instance}}.{{cluster}}"}, labels)
+	assert.True(t, ok)
+	assert.Equal(t, "db1.east", name)
+
+	_, ok = GetBotNameFromLabels(data.BotExtractorQueryKey{Keys: []string{"cluster", "region"}}, labels)
+	assert.False(t, ok)
+}
+
+func TestExtractBotsCompositeKeys(t *testing.T) {
+	botGroup := data.BotGroup{LockKey: "site.db", BotExtractor: data.BotExtractorQueryKey{Keys: []string{"cluster", "instance"}}}
+	response := data.QueryResponse{Series: []data.QuerySeries{
+		{Labels: map[string]string{"cluster": "east", "instance": "db1"}},
+		{Labels: map[string]string{"cluster": "west", "instance": "db1"}},
+		{Labels: map[string]string{"cluster": "west", "instance": "db1", "role": "replica"}},
+		{Labels: map[string]string{"instance": "db2"}},
+	}}
+
+	bots := ExtractBotsFromQueryResponse(response, &botGroup)
+	assert.Len(t, bots, 2)
+
+	names := []string{bots[0].Name, bots[1].Name}
+	assert.ElementsMatch(t, []string{"east/db1", "west/db1"}, names)
+	for _, bot := range bots {
+		assert.Equal(t, "db1", bot.Labels["instance"])
+		assert.Equal(t, "site.db."+bot.Name, bot.LockKey)
+	}
+}
+
+func TestIsQuerySeriesForBot(t *testing.T) {
+	bot := data.Bot{Name: "east/db1", Labels: map[string]string{"cluster": "east", "instance": "db1"}}
+
+	composite := data.BotVariable{BotKeys: []string{"cluster", "instance"}}
+	assert.True(t, IsQuerySeriesForBot(composite, map[string]string{"cluster": "east", "instance": "db1", "mode": "read"}, &bot))
+	assert.False(t, IsQuerySeriesForBot(composite, map[string]string{"cluster": "west", "instance": "db1"}, &bot))
+	assert.False(t, IsQuerySeriesForBot(composite, map[string]string{"instance": "db1"}, &bot))
+
+	single := data.BotVariable{BotKey: "name"}
+	assert.True(t, IsQuerySeriesForBot(single, map[string]string{"name": "east/db1"}, &bot))
+	assert.False(t, IsQuerySeriesForBot(single, map[string]string{"name": "db1"}, &bot))
+
+	assert.True(t, IsQuerySeriesForBot(data.BotVariable{}, map[string]string{}, &bot))
+}
+
+func TestUpdateBotsWithMissingVariables(t *testing.T) {
+	updateTime := time.Now()
+
+	tests := []struct {
+		name        string
+		variable    data.BotVariable
+		updateTimes map[string]time.Time
+		value       float64
+		hasValue    bool
+		isInvalid   bool
+		infoInvalid string
+	}{
+		{"updated this pass", data.BotVariable{MissingPolicy: data.MissingInvalidate}, map[string]time.Time{"requests": updateTime}, 7, true, false, ""},
+		{"treat as zero", data.BotVariable{MissingPolicy: data.MissingTreatAsZero}, map[string]time.Time{}, 0, true, false, ""},
+		{"use default", data.BotVariable{MissingPolicy: data.MissingUseDefault, MissingDefault: 3.5}, map[string]time.Time{}, 3.5, true, false, ""},
+		{"hold last within duration", data.BotVariable{MissingPolicy: data.MissingHoldLast, MissingHoldDuration: data.Duration(time.Minute)}, map[string]time.Time{"requests": updateTime.Add(-10 * time.Second)}, 7, true, false, ""},
+		{"hold last past duration", data.BotVariable{MissingPolicy: data.MissingHoldLast, MissingHoldDuration: data.Duration(time.Minute)}, map[string]time.Time{"requests": updateTime.Add(-2 * time.Minute)}, 0, false, true, "Missing Variable past hold duration: requests.  "},
+		{"hold last never updated", data.BotVariable{MissingPolicy: data.MissingHoldLast, MissingHoldDuration: data.Duration(time.Minute)}, map[string]time.Time{}, 0, false, true, "Missing Variable past hold duration: requests.  "},
+		{"invalidate", data.BotVariable{MissingPolicy: data.MissingInvalidate}, map[string]time.Time{}, 0, false, true, "Missing Variable: requests.  "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.variable.Name = "requests"
+
+			// The Bot starts Invalid from a previous pass, which must be reset
+			session := data.InteractiveSession{BotGroups: []data.BotGroup{{
+				Name:      "App",
+				Variables: []data.BotVariable{test.variable},
+				Bots: []data.Bot{{
+					Name:                "app-1",
+					LockKey:             "test_missing.app-1",
+					VariableValues:      map[string]float64{"requests": 7},
+					VariableUpdateTimes: test.updateTimes,
+					IsInvalid:           true,
+					InfoInvalid:         "Missing Variable: requests.  ",
+				}},
+			}}}
+
+			UpdateBotsWithMissingVariables(&session, 0, updateTime)
+
+			bot := session.BotGroups[0].Bots[0]
+			value, ok := bot.VariableValues["requests"]
+			assert.Equal(t, test.hasValue, ok)
+			assert.Equal(t, test.value, value)
+			assert.Equal(t, test.isInvalid, bot.IsInvalid)
+			assert.Equal(t, test.infoInvalid, bot.InfoInvalid)
+		})
+	}
+}
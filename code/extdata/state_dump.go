@@ -0,0 +1,100 @@
+package extdata
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"sort"
+	"time"
+)
+
+// Run every Query in the Site once, then the full UpdateSiteBotGroups pipeline, and return the resulting States,
+// Variables and Condition scores.  Works on a private copy of the BotGroups, like a Backtest, so Commands are never
+// sent and Metrics are not exported.  If botGroupName is set, only that BotGroup is returned, but all are run so
+// dependencies work.
+func RunStateDump(site *data.Site, botGroupName string) (data.StateDump, error) {
+	now := util.GetTimeNow()
+	stateDump := data.StateDump{Site: site.Name, Time: now, BotGroups: []data.BotGroupStateDump{}, Errors: []string{}}
+	loadedBotGroups := app.GetSiteLoadedBotGroups(site)
+
+	if botGroupName != "" {
+		_, err := app.GetBotGroupFromSlice(loadedBotGroups, botGroupName)
+		if util.Check(err) {
+			return stateDump, err
+		}
+	}
+
+	session := data.InteractiveSession{
+		UUID:                    0,
+		IsBacktest:              true,
+		BotGroups:               CopyBotGroupsForBacktest(loadedBotGroups),
+		QueryStartTime:          now.Add(-60 * time.Second),
+		QueryDuration:           data.Duration(60 * time.Second),
+		IgnoreCacheOverInterval: true,
+	}
+
+	// Run each Query once, they are shared between BotGroups with the same QueryServer and Query
+	ranQueries := make(map[string]bool)
+	for _, botGroup := range session.BotGroups {
+		for _, query := range botGroup.Queries {
+			queryKey := GetQueryKey(&session, query)
+			if ranQueries[queryKey] {
+				continue
+			}
+			ranQueries[queryKey] = true
+
+			result := RunQuery(&session, site, query)
+			if result.Response.IsError {
+				stateDump.Errors = append(stateDump.Errors, fmt.Sprintf("%s: %s: %s", botGroup.Name, query.Name, result.Response.ErrorMessage))
+			}
+		}
+	}
+
+	UpdateSiteBotGroups(&session, site)
+
+	for _, botGroup := range session.BotGroups {
+		if botGroupName != "" && botGroup.Name != botGroupName {
+			continue
+		}
+		stateDump.BotGroups = append(stateDump.BotGroups, GetBotGroupStateDump(&botGroup))
+	}
+
+	return stateDump, nil
+}
+
+// Returns the BotGroupStateDump for a BotGroup, with its Bots sorted by name
+func GetBotGroupStateDump(botGroup *data.BotGroup) data.BotGroupStateDump {
+	botGroupDump := data.BotGroupStateDump{
+		Name:            botGroup.Name,
+		AggregateValues: botGroup.AggregateValues,
+		Bots:            []data.BotStateDump{},
+	}
+
+	for _, bot := range botGroup.Bots {
+		botDump := data.BotStateDump{
+			Name:                bot.Name,
+			Labels:              bot.Labels,
+			States:              bot.StateValues,
+			Variables:           bot.VariableValues,
+			ConditionScores:     make(map[string]float64),
+			AvailableConditions: []string{},
+			IsInvalid:           bot.IsInvalid,
+			InfoInvalid:         bot.InfoInvalid,
+		}
+
+		for conditionName, conditionData := range bot.ConditionData {
+			botDump.ConditionScores[conditionName] = conditionData.FinalScore
+			if conditionData.IsAvailable {
+				botDump.AvailableConditions = append(botDump.AvailableConditions, conditionName)
+			}
+		}
+		sort.Strings(botDump.AvailableConditions)
+
+		botGroupDump.Bots = append(botGroupDump.Bots, botDump)
+	}
+
+	sort.Slice(botGroupDump.Bots, func(i, j int) bool { return botGroupDump.Bots[i].Name < botGroupDump.Bots[j].Name })
+
+	return botGroupDump
+}
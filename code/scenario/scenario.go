@@ -0,0 +1,221 @@
+package scenario
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/extdata"
+	"github.com/ghowland/sireus/code/util"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+type (
+	// FakeQueryClient serves the Scenario.Series instead of querying a QueryServer
+	FakeQueryClient struct {
+		Scenario data.Scenario
+	}
+)
+
+// Load a Scenario from a JSON file
+func LoadScenario(path string) (data.Scenario, error) {
+	scenarioData, err := os.ReadFile(path)
+	if util.Check(err) {
+		return data.Scenario{}, err
+	}
+
+	var scenario data.Scenario
+	err = json.Unmarshal(scenarioData, &scenario)
+	if util.Check(err) {
+		return data.Scenario{}, errors.New(fmt.Sprintf("Could not parse Scenario: %s  Error: %s", path, err.Error()))
+	}
+
+	return scenario, nil
+}
+
+// Run a Scenario file and return the differences from its Expect.  No differences means it passed.  The AppConfig
+// must already be set, so the Curves can be loaded.
+func RunScenarioFile(path string) ([]string, error) {
+	scenario, err := LoadScenario(path)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	result, session, err := RunScenario(scenario, filepath.Dir(path))
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return CompareScenarioResult(scenario, result, &session), nil
+}
+
+// Run a Scenario as a Backtest with the FakeQueryClient, and a ManualClock so nothing depends on the wall clock.
+// BotGroupPaths are relative to baseDir.  Returns the Backtest session too, for the final Bot data.
+func RunScenario(scenario data.Scenario, baseDir string) (data.BacktestResult, data.InteractiveSession, error) {
+	if scenario.Steps < 1 {
+		return data.BacktestResult{}, data.InteractiveSession{}, errors.New(fmt.Sprintf("Scenario must have at least 1 step: %s", scenario.Name))
+	}
+
+	site, err := GetScenarioSite(scenario, baseDir)
+	if util.Check(err) {
+		return data.BacktestResult{}, data.InteractiveSession{}, err
+	}
+
+	previousClient := extdata.SetQueryClient(FakeQueryClient{Scenario: scenario})
+	defer extdata.SetQueryClient(previousClient)
+
+	previousClock := util.SetClock(util.NewManualClock(scenario.StartTime))
+	defer util.SetClock(previousClock)
+
+	backtest := data.Backtest{
+		StartTime: scenario.StartTime,
+		EndTime:   GetScenarioStepTime(scenario, scenario.Steps-1),
+		Step:      scenario.Step,
+	}
+
+	// A single step has no range, but a Backtest needs one
+	if scenario.Steps == 1 {
+		backtest.EndTime = backtest.StartTime.Add(time.Duration(scenario.Step) / 2)
+	}
+
+	return extdata.RunBacktestSession(site, backtest)
+}
+
+// Create the Site for a Scenario, with its BotGroups and a QueryServer for every BotQuery.QueryServer they use
+func GetScenarioSite(scenario data.Scenario, baseDir string) (*data.Site, error) {
+	site := &data.Site{Name: fmt.Sprintf("Scenario %s", scenario.Name)}
+
+	for _, botGroupPath := range scenario.BotGroupPaths {
+		botGroup, err := app.LoadBotGroupConfigFile(filepath.Join(baseDir, botGroupPath))
+		if util.Check(err) {
+			return nil, errors.New(fmt.Sprintf("Could not load Scenario Bot Group: %s  Error: %s", botGroupPath, err.Error()))
+		}
+
+		err = app.PrepareBotGroup(site, &botGroup)
+		if util.Check(err) {
+			return nil, err
+		}
+
+		for _, query := range botGroup.Queries {
+			if _, err := app.GetQueryServer(site, query.QueryServer); err != nil {
+				site.QueryServers = append(site.QueryServers, data.QueryServer{Name: query.QueryServer, SiteName: site.Name, Info: "Scenario fake Query Server"})
+			}
+		}
+
+		site.LoadedBotGroups = append(site.LoadedBotGroups, botGroup)
+	}
+
+	err := app.ValidateBotGroupDependencies(site.LoadedBotGroups)
+	if util.Check(err) {
+		return nil, err
+	}
+
+	return site, nil
+}
+
+// Returns the time of a Scenario step
+func GetScenarioStepTime(scenario data.Scenario, step int) time.Time {
+	return scenario.StartTime.Add(time.Duration(scenario.Step) * time.Duration(step))
+}
+
+// Returns the Scenario step for a time
+func GetScenarioStep(scenario data.Scenario, stepTime time.Time) int {
+	return int(stepTime.Sub(scenario.StartTime) / time.Duration(scenario.Step))
+}
+
+// Returns the differences between what the Scenario expected and the BacktestResult.  The final States are checked in
+// the Backtest session.
+func CompareScenarioResult(scenario data.Scenario, result data.BacktestResult, session *data.InteractiveSession) []string {
+	var differences []string
+
+	for _, queryError := range result.Errors {
+		differences = append(differences, fmt.Sprintf("Query error: %s", queryError))
+	}
+
+	for index := 0; index < len(scenario.Expect.Executions) || index < len(result.Timeline); index++ {
+		expected := "nothing"
+		if index < len(scenario.Expect.Executions) {
+			execution := scenario.Expect.Executions[index]
+			expected = fmt.Sprintf("Step %d: %s: %s: %s", execution.Step, execution.BotGroupName, execution.BotName, execution.ConditionName)
+		}
+
+		actual := "nothing"
+		if index < len(result.Timeline) {
+			event := result.Timeline[index]
+			actual = fmt.Sprintf("Step %d: %s: %s: %s", GetScenarioStep(scenario, event.Time), event.BotGroupName, event.BotName, event.ConditionName)
+		}
+
+		if expected != actual {
+			differences = append(differences, fmt.Sprintf("Execution %d: Expected: %s  Actual: %s", index, expected, actual))
+		}
+	}
+
+	for _, expectedStates := range scenario.Expect.FinalStates {
+		botGroup, err := app.GetBotGroupFromSlice(session.BotGroups, expectedStates.BotGroupName)
+		if util.Check(err) {
+			differences = append(differences, fmt.Sprintf("Final States: Missing Bot Group: %s", expectedStates.BotGroupName))
+			continue
+		}
+
+		bot, err := app.GetBot(botGroup, expectedStates.BotName)
+		if util.Check(err) {
+			differences = append(differences, fmt.Sprintf("Final States: Missing Bot: %s: %s", expectedStates.BotGroupName, expectedStates.BotName))
+			continue
+		}
+		states := bot.StateValues
+
+		expected := util.CopyStringSlice(expectedStates.States)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(expected, states) {
+			differences = append(differences, fmt.Sprintf("Final States: %s: %s  Expected: %s  Actual: %s", expectedStates.BotGroupName, expectedStates.BotName, util.PrintStringArrayCSV(expected), util.PrintStringArrayCSV(states)))
+		}
+	}
+
+	return differences
+}
+
+// Returns the Scenario.Series for this BotQuery as a range response, with a sample for every step in the range
+func (client FakeQueryClient) Query(ctx context.Context, queryServer data.QueryServer, query data.BotQuery, start time.Time, duration time.Duration, step time.Duration) data.QueryResponse {
+	response := data.QueryResponse{
+		Series:      []data.QuerySeries{},
+		RequestURL:  fmt.Sprintf("scenario://%s/%s", queryServer.Name, query.Query),
+		RequestTime: util.GetTimeNow(),
+	}
+	end := start.Add(duration)
+
+	for _, series := range client.Scenario.Series {
+		if series.Query != query.Query || len(series.Values) == 0 {
+			continue
+		}
+
+		result := data.QuerySeries{Labels: series.Metric, Samples: []data.QuerySample{}}
+		for stepIndex := 0; stepIndex < client.Scenario.Steps; stepIndex++ {
+			stepTime := GetScenarioStepTime(client.Scenario, stepIndex)
+			if stepTime.Before(start) || stepTime.After(end) {
+				continue
+			}
+
+			value := series.Values[len(series.Values)-1]
+			if stepIndex < len(series.Values) {
+				value = series.Values[stepIndex]
+			}
+			if value == nil {
+				continue
+			}
+
+			result.Samples = append(result.Samples, data.QuerySample{Time: stepTime, Value: *value})
+		}
+
+		response.Series = append(response.Series, result)
+	}
+
+	response.ResponseTime = util.GetTimeNow()
+
+	return response
+}
@@ -0,0 +1,38 @@
+package scenario
+
+import (
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// NOTE(ghowland): Have to go back 2 directories here, and also in the config data, so need a separate config
+var testAppConfigPath = "../../config/test_config.json"
+
+var testScenarioGlob = "../../config/scenarios/*.json"
+
+func TestScenarios(t *testing.T) {
+	data.SireusData.AppConfig = app.LoadConfig(testAppConfigPath)
+
+	paths, err := filepath.Glob(testScenarioGlob)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, paths, "Scenario files found")
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			differences, err := RunScenarioFile(path)
+			assert.Nil(t, err, "Scenario loaded and ran")
+			assert.Empty(t, differences, "Scenario matched its expectations")
+		})
+	}
+}
+
+func TestGetScenarioSiteMissingBotGroup(t *testing.T) {
+	scenario := data.Scenario{Name: "Missing", BotGroupPaths: []string{"missing_bot_group.json"}}
+
+	_, err := GetScenarioSite(scenario, t.TempDir())
+	assert.NotNil(t, err, "A missing Bot Group is an error, not a panic")
+	assert.Contains(t, err.Error(), "missing_bot_group.json")
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type (
+	// A request to reload the config.  Reloads run in the RunForever loop, and wait for each Site's Site.UpdateLock, so
+	// BotGroups are never merged while they are being updated
+	configReloadRequest struct {
+		reason string
+		result chan data.ConfigReloadResult // If not nil, the result is sent when the reload finishes
+	}
+)
+
+var (
+	// Pending config reload requests, serviced by RunForever
+	configReloadRequests = make(chan configReloadRequest, 16)
+
+	// Modification times of the config files at the last load or check, for AppConfig.ConfigWatchInterval
+	configFileTimes    map[string]time.Time
+	configWatchLastRun time.Time
+)
+
+// Request a config reload, without waiting for it.  If reloads are already pending, they will load the latest config
+func RequestConfigReload(reason string) {
+	select {
+	case configReloadRequests <- configReloadRequest{reason: reason}:
+	default:
+		log.Printf("Config Reload (%s): Reload already pending", reason)
+	}
+}
+
+// Request a config reload and wait for the result, for the API.  Fails if RunForever doesn't service it in time
+func RequestConfigReloadAndWait(reason string, timeout time.Duration) (data.ConfigReloadResult, error) {
+	request := configReloadRequest{reason: reason, result: make(chan data.ConfigReloadResult, 1)}
+
+	select {
+	case configReloadRequests <- request:
+	default:
+		return data.ConfigReloadResult{}, errors.New("Too many config reloads pending")
+	}
+
+	select {
+	case result := <-request.result:
+		return result, nil
+	case <-time.After(timeout):
+		return data.ConfigReloadResult{}, errors.New(fmt.Sprintf("Config reload did not finish in %s", timeout.String()))
+	}
+}
+
+// Run all the pending config reload requests.  Called from RunForever
+func RunConfigReloadRequests() {
+	for {
+		select {
+		case request := <-configReloadRequests:
+			result := ReloadConfig(request.reason)
+			if request.result != nil {
+				request.result <- result
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Reload the config from appConfigPath, and merge it into the live Sites.  The new config is validated first, and
+// if it's invalid nothing is changed.  Live Bots, States, Lock Timers, Command History, sessions and query results
+// are kept.  Sites are matched by name: new Sites start their server loop, and removed Sites stop.  All the changes
+// are logged.
+func ReloadConfig(reason string) data.ConfigReloadResult {
+	result := data.ConfigReloadResult{Time: util.GetTimeNow(), Reason: reason, Errors: []string{}, Changes: []string{}}
+
+	appConfig, err := app.LoadConfigFile(appConfigPath)
+	if util.Check(err) {
+		result.Errors = append(result.Errors, app.GetConfigParseError(appConfigPath, err).String())
+		return logConfigReloadResult(result)
+	}
+	app.ApplyConfigOverrides(&appConfig, appConfigOverrides)
+
+	for _, validationError := range app.ValidateAppConfig(appConfig) {
+		result.Errors = append(result.Errors, validationError.String())
+	}
+	if len(result.Errors) > 0 {
+		return logConfigReloadResult(result)
+	}
+
+	loadedSites, err := loadSiteConfigsRecover(appConfig)
+	if util.Check(err) {
+		result.Errors = append(result.Errors, err.Error())
+		return logConfigReloadResult(result)
+	}
+
+	data.SireusData.ServerLock.Lock()
+
+	result.Changes = append(result.Changes, app.GetAppConfigChanges(data.SireusData.AppConfig, appConfig)...)
+
+	var sites []*data.Site
+	var addedSites []*data.Site
+	for _, loadedSite := range loadedSites {
+		liveSite := findSite(data.SireusData.Sites, loadedSite.Name)
+		if liveSite == nil {
+			result.Changes = append(result.Changes, fmt.Sprintf("Added Site: %s", loadedSite.Name))
+			sites = append(sites, loadedSite)
+			addedSites = append(addedSites, loadedSite)
+			continue
+		}
+
+		liveSite.UpdateLock.Lock()
+		result.Changes = append(result.Changes, app.MergeSiteConfig(liveSite, loadedSite)...)
+		liveSite.UpdateLock.Unlock()
+
+		sites = append(sites, liveSite)
+	}
+
+	for _, liveSite := range data.SireusData.Sites {
+		if findSite(loadedSites, liveSite.Name) == nil {
+			result.Changes = append(result.Changes, fmt.Sprintf("Removed Site: %s", liveSite.Name))
+			liveSite.UpdateLock.Lock()
+			liveSite.IsRemoved = true
+			liveSite.UpdateLock.Unlock()
+		}
+	}
+
+	data.SireusData.Sites = sites
+	data.SireusData.AppConfig = appConfig
+	configFileTimes = app.GetConfigFileTimes(appConfigPath, appConfig, sites)
+
+	data.SireusData.ServerLock.Unlock()
+
+	for _, site := range addedSites {
+		go RunSiteForever(site)
+	}
+
+	result.Success = true
+	return logConfigReloadResult(result)
+}
+
+// Returns the Site with this name, or nil
+func findSite(sites []*data.Site, name string) *data.Site {
+	for _, site := range sites {
+		if site.Name == name {
+			return site
+		}
+	}
+	return nil
+}
+
+// Load the Site configs, returning the errors from PrepareBotGroup and dependency ordering instead of panicking
+func loadSiteConfigsRecover(appConfig data.AppConfig) (sites []*data.Site, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprintf("Site config could not be loaded: %v", recovered))
+		}
+	}()
+
+	sites = app.LoadSiteConfigs(appConfig)
+	return sites, nil
+}
+
+// Log the reload result and all its changes or errors
+func logConfigReloadResult(result data.ConfigReloadResult) data.ConfigReloadResult {
+	if !result.Success {
+		log.Printf("Config Reload (%s): Refused, config is invalid: %d errors", result.Reason, len(result.Errors))
+		for _, reloadError := range result.Errors {
+			log.Printf("Config Reload (%s): Error: %s", result.Reason, reloadError)
+		}
+		return result
+	}
+
+	if len(result.Changes) == 0 {
+		log.Printf("Config Reload (%s): No changes", result.Reason)
+	}
+	for _, change := range result.Changes {
+		log.Printf("Config Reload (%s): %s", result.Reason, change)
+	}
+
+	return result
+}
+
+// Request a config reload when the server gets SIGHUP, until the server quits
+func RunConfigReloadOnSignal() {
+	channel := make(chan os.Signal, 1)
+	signal.Notify(channel, syscall.SIGHUP)
+	defer signal.Stop(channel)
+
+	for {
+		select {
+		case <-channel:
+			RequestConfigReload("SIGHUP")
+		case <-data.SireusData.ServerContext.Done():
+			return
+		}
+	}
+}
+
+// Request a config reload if any config file changed, every AppConfig.ConfigWatchInterval.  Called from RunForever
+func CheckConfigFilesChanged() {
+	interval := time.Duration(data.SireusData.AppConfig.ConfigWatchInterval)
+	if interval <= 0 || util.GetTimeNow().Sub(configWatchLastRun) < interval {
+		return
+	}
+	configWatchLastRun = util.GetTimeNow()
+
+	fileTimes := app.GetConfigFileTimes(appConfigPath, data.SireusData.AppConfig, app.GetSites())
+
+	var changedPaths []string
+	for path, modTime := range fileTimes {
+		if !modTime.Equal(configFileTimes[path]) {
+			changedPaths = append(changedPaths, path)
+		}
+	}
+	if len(changedPaths) == 0 {
+		return
+	}
+	sort.Strings(changedPaths)
+
+	// Keep the new times even if the reload is refused, so an invalid config is only reported once per change
+	configFileTimes = fileTimes
+
+	RequestConfigReload(fmt.Sprintf("File Watch: %s", strings.Join(changedPaths, ", ")))
+}
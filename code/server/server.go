@@ -2,18 +2,35 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"github.com/ghowland/sireus/code/app"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/extdata"
 	"github.com/ghowland/sireus/code/util"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"time"
 )
 
-// TODO(ghowland): Handle config file as CLI arg
-var appConfigPath = "config/config.json"
+var (
+	// Path to the AppConfig, set with "sireus serve -config"
+	appConfigPath = "config/config.json"
+
+	// AppConfig values set on the command line, applied every time the config is loaded
+	appConfigOverrides data.AppConfigOverrides
+)
+
+// Set the AppConfig path, before Configure()
+func SetConfigPath(path string) {
+	appConfigPath = path
+}
+
+// Set the AppConfig command line overrides, before Configure()
+func SetConfigOverrides(overrides data.AppConfigOverrides) {
+	appConfigOverrides = overrides
+}
 
 func Configure() {
 	data.SireusData.IsQuitting = false
@@ -22,31 +39,62 @@ func Configure() {
 
 	// Load for the first time too...
 	LoadConfig()
+
+	// Reload the config on SIGHUP.  Reloads merge into the live Site, see ReloadConfig()
+	go RunConfigReloadOnSignal()
 }
 
-// Load and reload config.  Will set ServerLock so this is safe to do
+// Load the config for the first time, replacing the Sites.  Will set ServerLock so this is safe to do.  Use
+// ReloadConfig() to reload a running server, which keeps the live Bots
 func LoadConfig() {
 	data.SireusData.ServerLock.Lock()
 	defer data.SireusData.ServerLock.Unlock()
 
 	data.SireusData.AppConfig = app.LoadConfig(appConfigPath)
+	app.ApplyConfigOverrides(&data.SireusData.AppConfig, appConfigOverrides)
+
+	data.SireusData.Sites = app.LoadSiteConfigs(data.SireusData.AppConfig)
+
+	configFileTimes = app.GetConfigFileTimes(appConfigPath, data.SireusData.AppConfig, data.SireusData.Sites)
+}
+
+// Validates the AppConfig at the path, or the default config if empty, and its Site and BotGroup configs.  Prints all
+// the errors with their file and JSON path to output.  Returns the process exit code: 0 if valid, 1 if not.
+func ValidateConfig(path string, output io.Writer) int {
+	if path == "" {
+		path = appConfigPath
+	}
+
+	appConfig, err := app.LoadConfigFile(path)
+	if util.Check(err) {
+		_, _ = fmt.Fprintln(output, app.GetConfigParseError(path, err).String())
+		return 1
+	}
 
-	data.SireusData.Site = app.LoadSiteConfig(data.SireusData.AppConfig)
+	validationErrors := app.ValidateAppConfig(appConfig)
+	for _, validationError := range validationErrors {
+		_, _ = fmt.Fprintln(output, validationError.String())
+	}
+
+	if len(validationErrors) > 0 {
+		_, _ = fmt.Fprintf(output, "Config invalid: %d errors\n", len(validationErrors))
+		return 1
+	}
+
+	_, _ = fmt.Fprintf(output, "Config valid: %s\n", path)
+	return 0
 }
 
 // Get the global Server context, so that we can cancel everything in progress
 func GetServerBackgroundContext() context.Context {
 	ctx := context.Background()
 
-	// Trap Ctrl+C and call cancel on the context
+	// Trap Ctrl+C and call cancel on the context.  The context lives until the server quits, as queries use it
 	ctx, cancel := context.WithCancel(ctx)
 	channel := make(chan os.Signal, 1)
 	signal.Notify(channel, os.Interrupt)
-	defer func() {
-		signal.Stop(channel)
-		cancel()
-	}()
 	go func() {
+		defer signal.Stop(channel)
 		select {
 		case <-channel:
 			data.SireusData.IsQuitting = true
@@ -58,27 +106,60 @@ func GetServerBackgroundContext() context.Context {
 	return ctx
 }
 
-// Run forever, until we stop the server
+// Run forever, until we stop the server.  Each Site runs in its own loop, so a slow Site can't delay the others.  This
+// loop handles config reloads, which can add and remove Sites
 func RunForever() {
 	log.Printf("Server: Run Forever: Starting (%v)", data.SireusData.IsQuitting)
 
-	productionSession := app.GetInteractiveSession(data.SireusData.Site.ProductionControl, &data.SireusData.Site)
+	for _, site := range app.GetSites() {
+		go RunSiteForever(site)
+	}
+
+	// Run until we are quitting
+	for !data.SireusData.IsQuitting {
+		// Reload the config if it was requested, or the config files changed
+		CheckConfigFilesChanged()
+		RunConfigReloadRequests()
+
+		if !data.SireusData.IsQuitting {
+			time.Sleep(time.Duration(data.SireusData.AppConfig.ServerLoopDelay))
+		}
+	}
+
+	log.Printf("Server: Run Forever: Stopping (%v)", data.SireusData.IsQuitting)
+}
+
+// Run a Site's queries and BotGroup updates forever, until we stop the server or a config reload removes the Site
+func RunSiteForever(site *data.Site) {
+	log.Printf("Server: Site: %s: Starting", site.Name)
 
 	// Run until we are quitting
 	for !data.SireusData.IsQuitting {
-		// Run all queries that need running
+		// Config reloads merge into the Site's BotGroups, so they wait until this update is done
+		site.UpdateLock.Lock()
+		if site.IsRemoved {
+			site.UpdateLock.Unlock()
+			break
+		}
+
+		// The production session is fetched every loop, so it has the BotGroups from any config reload
+		//NOTE(ghowland): This RunSiteForever version is always production, so interactiveUUID==0
+		productionSession := app.GetInteractiveSession(site.ProductionControl, site)
 
 		// Update the query times to get values now
 		productionSession.QueryStartTime = util.GetTimeNow().Add(time.Duration(-60))
 		productionSession.QueryDuration = data.Duration(60 * time.Second)
 
 		// Run all the queries that have passed their interval, or haven't been set yet
-		//NOTE(ghowland): This RunForever version is always production, so interactiveUUID==0
-		RunAllSiteQueries(&productionSession, &data.SireusData.Site)
+		RunAllSiteQueries(&productionSession, site)
 
 		// Update everything from the queries.  This will need time to warm up, but just let it fail in the beginning
-		//NOTE(ghowland): This RunForever version is always production, so interactiveUUID==0
-		extdata.UpdateSiteBotGroups(&productionSession)
+		extdata.UpdateSiteBotGroups(&productionSession, site)
+
+		// Expire idle Interactive Sessions and keep the QueryResultPool under its caps
+		app.RunSessionJanitor(site)
+
+		site.UpdateLock.Unlock()
 
 		// Pause a short time (~0.8s) to not fully spin lock the CPU ever.  This doesn't need to be more rapid
 		if !data.SireusData.IsQuitting {
@@ -86,7 +167,7 @@ func RunForever() {
 		}
 	}
 
-	log.Printf("Server: Run Forever: Stopping (%v)", data.SireusData.IsQuitting)
+	log.Printf("Server: Site: %s: Stopping (Quitting: %v  Removed: %v)", site.Name, data.SireusData.IsQuitting, site.IsRemoved)
 }
 
 // Requests all the Queries in all the BotGroups, if they are missing or past their freshness Interval.
@@ -95,6 +176,9 @@ func RunForever() {
 func RunAllSiteQueries(session *data.InteractiveSession, site *data.Site) {
 	for _, botGroup := range session.BotGroups {
 		for _, query := range botGroup.Queries {
+			// Watched BotGroups query faster, so the web app is live while users are looking at them
+			query.Interval = app.GetBotQueryInterval(site, &botGroup, query)
+
 			// If this is already locked, then skip until the lock duration passes.  This will clear it when appropriate
 			if extdata.IsQueryLocked(session, site, query) {
 				continue
@@ -103,35 +187,18 @@ func RunAllSiteQueries(session *data.InteractiveSession, site *data.Site) {
 			// If we don't have this query for any reason (first time, or is over the BotQuery.Interval
 			_, err := extdata.GetCachedQueryResult(session, site, query)
 			if util.Check(err) {
+				// Lock before starting, so the next loop can't start the same query again
+				extdata.QueryLockSet(site, extdata.GetQueryKey(session, query))
 				go BackgroundQuery(session, site, query)
 			}
 		}
 	}
 }
 
-// Query in the background with a goroutine
+// Query in the background with a goroutine.  The Query Lock must already be set, and is cleared when done
 func BackgroundQuery(session *data.InteractiveSession, site *data.Site, query data.BotQuery) {
 	queryKey := extdata.GetQueryKey(session, query)
-
-	// Set the lock, and defer to clear it when done
-	extdata.QueryLockSet(site, queryKey)
 	defer extdata.QueryLockClear(site, queryKey)
 
-	// Perform the query
-	queryServer, err := app.GetQueryServer(site, query.QueryServer)
-	util.CheckLog(err)
-
-	startTime := util.GetTimeNow()
-
-	promData := extdata.QueryPrometheus(queryServer.Host, queryServer.Port, query.QueryType, query.Query, session.QueryStartTime, time.Duration(session.QueryDuration))
-
-	// Create the Query Result from
-	newResult := data.QueryResult{
-		QueryServer:        query.QueryServer,
-		QueryType:          query.QueryType,
-		Query:              query.Query,
-		PrometheusResponse: promData,
-	}
-
-	extdata.StoreQueryResult(session, site, query, startTime, newResult)
+	extdata.RunQuery(session, site, query)
 }
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Clock provides the time now.  GetTimeNow() uses the ActiveClock, so tests can replace it with a ManualClock
+	Clock interface {
+		Now() time.Time
+	}
+)
+
+type (
+	// SystemClock is the wall clock, this is the default ActiveClock
+	SystemClock struct{}
+)
+
+type (
+	// ManualClock only changes time when it is Set or Advanced.  Used for deterministic tests
+	ManualClock struct {
+		current time.Time
+		lock    sync.RWMutex
+	}
+)
+
+var (
+	ActiveClock Clock = SystemClock{}
+)
+
+// Replace the ActiveClock.  Returns the previous Clock, so it can be restored
+func SetClock(clock Clock) Clock {
+	previous := ActiveClock
+	ActiveClock = clock
+	return previous
+}
+
+// Returns the wall clock time now
+func (clock SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Create a ManualClock starting at the time
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{current: start}
+}
+
+// Returns the ManualClock's current time
+func (clock *ManualClock) Now() time.Time {
+	clock.lock.RLock()
+	defer clock.lock.RUnlock()
+	return clock.current
+}
+
+// Set the ManualClock's current time
+func (clock *ManualClock) Set(current time.Time) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.current = current
+}
+
+// Move the ManualClock's current time forward by the duration
+func (clock *ManualClock) Advance(duration time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	clock.current = clock.current.Add(duration)
+}
@@ -51,6 +51,15 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// Returns the modification time of a file, to find changed files
+func GetFileModTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if Check(err) {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
 func FileLoad(path string) (string, error) {
 	dat, err := os.ReadFile(path)
 	if Check(err) {
@@ -195,6 +204,14 @@ func BoolToFloatString(value bool) string {
 	}
 }
 
+// Converts a boolean to 0 or 1
+func BoolToFloat64(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
 // Print JSON, for debugging
 func PrintJson(value interface{}) string {
 	output, err := json.MarshalIndent(value, "", "  ")
@@ -227,9 +244,27 @@ func FormatTimeLong(t time.Time) string {
 	return output
 }
 
-// Returns time.Now() in UTC.  Convenience wrapper, so it's never forgotten, because everything must always be in UTC
+// Returns the time now from the ActiveClock in UTC.  Convenience wrapper, so it's never forgotten, because everything
+// must always be in UTC.  Use this instead of time.Now(), so tests can control time with SetClock()
 func GetTimeNow() time.Time {
-	return time.Now().UTC()
+	return ActiveClock.Now().UTC()
+}
+
+// Format a count of bytes for human readability, ex: "1.5 MB"
+func FormatBytes(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	value := float64(bytes)
+	unitIndex := 0
+	for value >= 1024 && unitIndex < len(units)-1 {
+		value /= 1024
+		unitIndex++
+	}
+
+	if unitIndex == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[unitIndex])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unitIndex])
 }
 
 // Replace any characters in unsafeChars with the replace string.  Quickly convert into a safe string
@@ -247,6 +282,15 @@ func CopyStringSlice(src []string) []string {
 	return dst
 }
 
+// Copy a string to float64 map, because direct assignment is a reference
+func CopyMapStringFloat64(src map[string]float64) map[string]float64 {
+	dst := make(map[string]float64, len(src))
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
 func HttpGet(url string) (string, error) {
 	resp, err := http.Get(url)
 	if err != nil {
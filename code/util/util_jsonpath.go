@@ -0,0 +1,110 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// A single step of a JSONPath
+	JsonPathSegment struct {
+		Key        string // Object key, if not IsIndex or IsWildcard
+		Index      int    // List index, if IsIndex
+		IsIndex    bool
+		IsWildcard bool // Selects every item in a list or object
+	}
+)
+
+// Select values from decoded JSON with a JSONPath subset: $, .key, ['key'], [index] and [*].  Keys or indexes that
+// don't exist select nothing, so a path can select 0 or more values.
+func JsonPathSelect(document interface{}, path string) ([]interface{}, error) {
+	segments, err := ParseJsonPath(path)
+	if Check(err) {
+		return nil, err
+	}
+
+	current := []interface{}{document}
+
+	for _, segment := range segments {
+		var next []interface{}
+
+		for _, value := range current {
+			switch {
+			case segment.IsWildcard:
+				switch typed := value.(type) {
+				case []interface{}:
+					next = append(next, typed...)
+				case map[string]interface{}:
+					for _, item := range typed {
+						next = append(next, item)
+					}
+				}
+			case segment.IsIndex:
+				list, ok := value.([]interface{})
+				if ok && segment.Index >= 0 && segment.Index < len(list) {
+					next = append(next, list[segment.Index])
+				}
+			default:
+				object, ok := value.(map[string]interface{})
+				if item, found := object[segment.Key]; ok && found {
+					next = append(next, item)
+				}
+			}
+		}
+
+		current = next
+	}
+
+	return current, nil
+}
+
+// Parse a JSONPath into segments
+func ParseJsonPath(path string) ([]JsonPathSegment, error) {
+	var segments []JsonPathSegment
+
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New(fmt.Sprintf("JSONPath must start with $: %s", path))
+	}
+
+	for position := 1; position < len(path); {
+		switch path[position] {
+		case '.':
+			end := position + 1
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			key := path[position+1 : end]
+			if key == "" {
+				return nil, errors.New(fmt.Sprintf("JSONPath has an empty key at %d: %s", position, path))
+			}
+			segments = append(segments, JsonPathSegment{Key: key})
+			position = end
+		case '[':
+			end := strings.Index(path[position:], "]")
+			if end == -1 {
+				return nil, errors.New(fmt.Sprintf("JSONPath has an unclosed [ at %d: %s", position, path))
+			}
+			inner := path[position+1 : position+end]
+			position += end + 1
+
+			switch {
+			case inner == "*":
+				segments = append(segments, JsonPathSegment{IsWildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, JsonPathSegment{Key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("JSONPath index is not a number: [%s]: %s", inner, path))
+				}
+				segments = append(segments, JsonPathSegment{Index: index, IsIndex: true})
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("JSONPath has an unexpected character at %d: %s", position, path))
+		}
+	}
+
+	return segments, nil
+}
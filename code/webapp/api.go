@@ -0,0 +1,177 @@
+package webapp
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/extdata"
+	"github.com/ghowland/sireus/code/server"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	ConfigReloadTimeout = 30 * time.Second // Longest the config reload API waits for the server loop to reload
+)
+
+// Returns a JSON failure payload for the API, in the same format as the other API calls
+func GetAPIFailure(message string) string {
+	return util.PrintJson(map[string]interface{}{"_failure": message})
+}
+
+// Returns the ConditionExplanation for every Condition of a Bot as JSON, keyed by Condition.Name.  Uses the same
+// params as the RPC pages, "bot_group_id", "bot_id" and "interactive_control".  Optional "condition" returns a single
+// ConditionExplanation.
+func GetAPIExplain(c *fiber.Ctx, site *data.Site) string {
+	input := util.ParseContextBody(c)
+
+	renderMap := GetRenderMapFromRPC(c, site)
+	bot := renderMap["bot"].(*data.Bot)
+	if bot.Name == "" {
+		return GetAPIFailure("Bot not found, aborting")
+	}
+
+	util.LockAcquire(bot.LockKey)
+	defer util.LockRelease(bot.LockKey)
+
+	if conditionName, ok := input["condition"]; ok {
+		conditionData, ok := bot.ConditionData[conditionName]
+		if !ok {
+			return GetAPIFailure("Condition not found, aborting")
+		}
+		return util.PrintJson(conditionData.Explanation)
+	}
+
+	explanations := make(map[string]data.ConditionExplanation)
+	for conditionName, conditionData := range bot.ConditionData {
+		explanations[conditionName] = conditionData.Explanation
+	}
+
+	return util.PrintJson(explanations)
+}
+
+// Returns the ConditionSensitivity for a Bot's Condition as JSON.  Uses the same params as GetAPIExplain(), with a
+// required "condition" and optional "steps" for how many steps each Consideration range is swept, up to
+// app.SensitivityStepsMax.
+func GetAPISensitivity(c *fiber.Ctx, site *data.Site) string {
+	input := util.ParseContextBody(c)
+
+	renderMap := GetRenderMapFromRPC(c, site)
+	botGroup := renderMap["botGroup"].(*data.BotGroup)
+	bot := renderMap["bot"].(*data.Bot)
+	if bot.Name == "" {
+		return GetAPIFailure("Bot not found, aborting")
+	}
+
+	condition, err := app.GetCondition(botGroup, input["condition"])
+	if util.Check(err) {
+		return GetAPIFailure("Condition not found, aborting")
+	}
+
+	steps, err := strconv.Atoi(input["steps"])
+	if err != nil {
+		steps = app.SensitivityStepsDefault
+	}
+
+	// Copy the score maps under the lock, the site update writes them while the sensitivity is computed
+	util.LockAcquire(bot.LockKey)
+	conditionData := bot.ConditionData[condition.Name]
+	conditionData.ConsiderationRawScores = util.CopyMapStringFloat64(conditionData.ConsiderationRawScores)
+	conditionData.ConsiderationCurvedScores = util.CopyMapStringFloat64(conditionData.ConsiderationCurvedScores)
+	util.LockRelease(bot.LockKey)
+
+	return util.PrintJson(app.GetConditionSensitivity(condition, conditionData, steps))
+}
+
+// Runs a Backtest and returns the BacktestResult as JSON.  Params: "bot_group_id" (optional), "start_time" and
+// "end_time" as RFC3339, and "step" as a duration, ex: "60s".  Commands are never sent.  Backtests run in the request,
+// so ranges over extdata.BacktestMaxSteps steps are rejected.
+func GetAPIBacktest(c *fiber.Ctx, site *data.Site) string {
+	input := util.ParseContextBody(c)
+
+	startTime, err := time.Parse(time.RFC3339, input["start_time"])
+	if util.Check(err) {
+		return GetAPIFailure("Invalid start_time, must be RFC3339")
+	}
+	endTime, err := time.Parse(time.RFC3339, input["end_time"])
+	if util.Check(err) {
+		return GetAPIFailure("Invalid end_time, must be RFC3339")
+	}
+	step, err := time.ParseDuration(input["step"])
+	if util.Check(err) {
+		return GetAPIFailure("Invalid step, must be a duration like 60s")
+	}
+
+	backtest := data.Backtest{
+		BotGroupName: input["bot_group_id"],
+		StartTime:    startTime,
+		EndTime:      endTime,
+		Step:         data.Duration(step),
+	}
+
+	result, err := extdata.RunBacktest(site, backtest)
+	if util.Check(err) {
+		return GetAPIFailure(err.Error())
+	}
+
+	return util.PrintJson(result)
+}
+
+// Runs a Query now for the production session, from the Query Health page "Run Now" button.  Params "query_server"
+// and "query".  Returns the QueryStats after it ran, and reloads the page.
+func GetAPIQueryRun(c *fiber.Ctx, site *data.Site) string {
+	input := util.ParseContextBody(c)
+
+	stats, err := extdata.RunQueryNow(site, input["query_server"], input["query"])
+	if util.Check(err) {
+		return GetAPIFailure(err.Error())
+	}
+
+	result := map[string]interface{}{
+		"query_stats":  stats,
+		"_reload_page": true,
+	}
+	if stats.LastErrorTime.Equal(stats.LastRequest) {
+		result["_failure"] = stats.LastError
+	}
+
+	return util.PrintJson(result)
+}
+
+// Terminates an Interactive Session from the Sessions page, and evicts its cached query results.  Param "session_uuid".
+// Reloads the page.
+func GetAPISessionTerminate(c *fiber.Ctx, site *data.Site) string {
+	input := util.ParseContextBody(c)
+
+	uuid, err := strconv.ParseInt(input["session_uuid"], 10, 64)
+	if util.Check(err) {
+		return GetAPIFailure("Invalid session_uuid")
+	}
+
+	err = app.TerminateInteractiveSession(site, data.SessionUUID(uuid))
+	if util.Check(err) {
+		return GetAPIFailure(err.Error())
+	}
+
+	return util.PrintJson(map[string]interface{}{"_reload_page": true})
+}
+
+// Reloads the config, merging it into the live Site, and returns the ConfigReloadResult as JSON.  If the config is
+// invalid, nothing is changed, and "_failure" is set so the web app shows it
+func GetAPIConfigReload() string {
+	result, err := server.RequestConfigReloadAndWait("API", ConfigReloadTimeout)
+	if util.Check(err) {
+		return GetAPIFailure(err.Error())
+	}
+
+	if !result.Success {
+		return util.PrintJson(map[string]interface{}{
+			"_failure": fmt.Sprintf("Config invalid, not reloaded: %d errors", len(result.Errors)),
+			"result":   result,
+		})
+	}
+
+	return util.PrintJson(result)
+}
@@ -33,5 +33,8 @@ func CreateWebApp(engine *handlebars.Engine) *fiber.App {
 		Views: engine,
 	})
 
+	// Every page and API call is scoped to a Site
+	app.Use(SiteHandler)
+
 	return app
 }
@@ -32,7 +32,9 @@ func GetRenderMapFromParams(c *fiber.Ctx, site *data.Site) fiber.Map {
 		util.CheckLog(err)
 	}
 
+	// The Site is passed back in RPC calls, so they stay on this page's Site
 	inputData := make(map[string]interface{})
+	inputData["site_id"] = site.Name
 	inputData["bot_group_id"] = botGroupId
 	inputData["bot_id"] = botId
 
@@ -69,6 +71,14 @@ func GetRenderMapFromRPC(c *fiber.Ctx, site *data.Site) map[string]interface{} {
 		interactiveControl = app.GetProductionInteractiveControl()
 	}
 
+	// Users are looking at this BotGroup, so query it at the fast interval for a while
+	if len(botGroupId) != 0 {
+		app.WatchBotGroup(site, botGroupId)
+	}
+
+	// Updates share the Bots with the server loop, and config reloads merge into them, so wait for the Site's update
+	site.UpdateLock.Lock()
+
 	// Get our interactive session
 	session := app.GetInteractiveSession(interactiveControl, site)
 
@@ -76,11 +86,13 @@ func GetRenderMapFromRPC(c *fiber.Ctx, site *data.Site) map[string]interface{} {
 
 	// Run all the queries that have passed their interval, or haven't been set yet
 	//NOTE(ghowland): This RPC version is either production or not
-	server.RunAllSiteQueries(&session, &data.SireusData.Site)
+	server.RunAllSiteQueries(&session, site)
 
 	// Update everything from the queries.  This will need time to warm up, but just let it fail in the beginning
 	//NOTE(ghowland): This RPC version is either production or not
-	extdata.UpdateSiteBotGroups(&session)
+	extdata.UpdateSiteBotGroups(&session, site)
+
+	site.UpdateLock.Unlock()
 
 	// Bot Groups and Bots come from the Site.  Site is either original or the Interactive data version, but treated the same
 	botGroup := data.BotGroup{}
@@ -97,6 +109,7 @@ func GetRenderMapFromRPC(c *fiber.Ctx, site *data.Site) map[string]interface{} {
 	}
 
 	inputData := make(map[string]interface{})
+	inputData["site_id"] = site.Name
 	inputData["bot_group_id"] = botGroupId
 	inputData["bot_id"] = botId
 
@@ -127,6 +140,8 @@ func BuildRenderMapFiber(session *data.InteractiveSession, site *data.Site, botG
 		"session":                      session,
 		"site":                         site,
 		"site_id":                      site.Name,
+		"site_bot_groups":              app.GetSiteLoadedBotGroups(site),
+		"sites":                        app.GetSiteNames(),
 		"botGroup":                     botGroup,
 		"bot_group_id":                 botGroup.Name,
 		"bot":                          bot,
@@ -165,6 +180,7 @@ func BuildRenderMap(session *data.InteractiveSession, site *data.Site, botGroup
 		"session":             session,
 		"site":                site,
 		"site_id":             site.Name,
+		"site_bot_groups":     app.GetSiteLoadedBotGroups(site),
 		"botGroup":            botGroup,
 		"bot_group_id":        botGroup.Name,
 		"bot":                 bot,
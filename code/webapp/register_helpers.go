@@ -7,6 +7,7 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/ghowland/sireus/code/app"
 	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/fixgo"
 	"github.com/ghowland/sireus/code/util"
 	"log"
 	"sort"
@@ -76,13 +77,25 @@ func RegisterHandlebarsHelpers_WithData() {
 	})
 
 	// With Query Server by Name from Site
-	raymond.RegisterHelper("with_query_server", func(queryServerName string, site data.Site, options *raymond.Options) raymond.SafeString {
-		queryServer, err := app.GetQueryServer(&site, queryServerName)
+	raymond.RegisterHelper("with_query_server", func(queryServerName string, siteName string, options *raymond.Options) raymond.SafeString {
+		queryServer, err := GetSiteQueryServer(siteName, queryServerName)
 		util.CheckLog(err)
 
 		return raymond.SafeString(options.FnWith(queryServer))
 	})
 
+	// With BotGroup Aggregates, formatted for display
+	raymond.RegisterHelper("with_bot_group_aggregate_values", func(botGroup data.BotGroup, options *raymond.Options) raymond.SafeString {
+		aggregates := app.GetBotGroupAggregateValuesFormatted(botGroup)
+		return raymond.SafeString(options.FnWith(aggregates))
+	})
+
+	// With BotGroup Dependency Values, sorted by name
+	raymond.RegisterHelper("with_bot_group_dependency_values", func(botGroup data.BotGroup, options *raymond.Options) raymond.SafeString {
+		dependencyValues := fixgo.SortMapStringFloat64ByKey(botGroup.DependencyValues)
+		return raymond.SafeString(options.FnWith(dependencyValues))
+	})
+
 	// With Query Server by Name from Site
 	raymond.RegisterHelper("with_bot_group_bot_variable_by_name", func(botGroup data.BotGroup, varName string, options *raymond.Options) raymond.SafeString {
 		variables := app.GetBotGroupAllBotVariablesByName(botGroup, varName)
@@ -220,8 +233,8 @@ func RegisterHandlebarsHelpers_GetAppData() {
 // Format data, for Go and our internal data types
 func RegisterHandlebarsHelpers_FormatData() {
 	// Queries
-	raymond.RegisterHelper("format_query_web", func(site data.Site, item data.BotQuery) string {
-		queryServer, err := app.GetQueryServer(&site, item.QueryServer)
+	raymond.RegisterHelper("format_query_web", func(siteName string, item data.BotQuery) string {
+		queryServer, err := GetSiteQueryServer(siteName, item.QueryServer)
 		util.CheckLog(err)
 		mapData := map[string]string{
 			"query": item.Query,
@@ -261,6 +274,10 @@ func RegisterHandlebarsHelpers_FormatData() {
 		return raymond.SafeString(time.Duration(d).String())
 	})
 
+	raymond.RegisterHelper("format_bytes", func(bytes int64) raymond.SafeString {
+		return raymond.SafeString(util.FormatBytes(bytes))
+	})
+
 	raymond.RegisterHelper("format_html_id", func(name string) raymond.SafeString {
 		nameId := util.StringReplaceUnsafeChars(name, " [](){}=-!@#$%^&*()+<>,./?;:'\"`~", "_")
 		return raymond.SafeString(nameId)
@@ -399,6 +416,14 @@ func RegisterHandlebarsHelpers_IfArrayLength() {
 		}
 	})
 
+	raymond.RegisterHelper("if_aggregate_length", func(items []data.BotGroupAggregate, count int, options *raymond.Options) raymond.SafeString {
+		if len(items) >= count {
+			return raymond.SafeString(options.Fn())
+		} else {
+			return raymond.SafeString("")
+		}
+	})
+
 	raymond.RegisterHelper("if_state_length", func(items []data.BotForwardSequenceState, count int, options *raymond.Options) raymond.SafeString {
 		if len(items) >= count {
 			return raymond.SafeString(options.Fn())
@@ -2,7 +2,6 @@ package webapp
 
 import (
 	"github.com/ghowland/sireus/code/app"
-	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/demo"
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,16 +15,40 @@ func RegisterRoutesAPI(web *fiber.App) {
 	})
 
 	web.Post("/api/plot_metrics", func(c *fiber.Ctx) error {
-		return c.SendString(app.GetAPIPlotMetrics(c))
+		return c.SendString(app.GetAPIPlotMetrics(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/explain", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPIExplain(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/sensitivity", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPISensitivity(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/backtest", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPIBacktest(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/query/run", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPIQueryRun(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/session/terminate", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPISessionTerminate(c, GetContextSite(c)))
+	})
+
+	web.Post("/api/config/reload", func(c *fiber.Ctx) error {
+		return c.SendString(GetAPIConfigReload())
 	})
 
 	web.Post("/api/web/bot", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromRPC(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromRPC(c, GetContextSite(c))
 		return c.SendString(RenderRPCHtml("web/bot.hbs", renderMap))
 	})
 
 	web.Post("/api/web/demo_control", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromRPC(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromRPC(c, GetContextSite(c))
 		// Update the Demo Control with demo specific data
 		demo.UpdateRenderMapWithDemoData(renderMap)
 		return c.SendString(RenderRPCHtml("web/demo_control.hbs", renderMap))
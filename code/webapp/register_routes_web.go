@@ -5,6 +5,7 @@ import (
 	"github.com/ghowland/sireus/code/app"
 	"github.com/ghowland/sireus/code/data"
 	"github.com/ghowland/sireus/code/demo"
+	"github.com/ghowland/sireus/code/extdata"
 	"github.com/ghowland/sireus/code/util"
 	"github.com/gofiber/fiber/v2"
 )
@@ -14,44 +15,59 @@ func RegisterRoutesWeb(web *fiber.App) {
 
 	// Raw Data Page - Not an API call
 	web.Get("/raw/metrics", func(c *fiber.Ctx) error {
-		return c.SendString(app.GetRawMetricsJSON(c))
+		return c.SendString(app.GetRawMetricsJSON(c, GetContextSite(c)))
 	})
 
 	// Web Pages
 	web.Get("/", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		// Update the Demo Control with demo specific data
 		demo.UpdateRenderMapWithDemoData(renderMap)
 		return c.Render("demo_control", renderMap, "layouts/main_common")
 	})
 
+	web.Get("/site/select", SelectSite)
+
 	web.Get("/site", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("site", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/bot_group", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("bot_group", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/bot", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("bot", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/site_query", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("site_query", renderMap, "layouts/main_common")
 	})
 
+	web.Get("/query_health", func(c *fiber.Ctx) error {
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
+		renderMap["queryServerHealth"] = extdata.GetQueryServerHealthAll(GetContextSite(c))
+		renderMap["queryStats"] = extdata.GetQueryStatsAll(GetContextSite(c))
+		return c.Render("query_health", renderMap, "layouts/main_common")
+	})
+
+	web.Get("/sessions", func(c *fiber.Ctx) error {
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
+		renderMap["sessions"] = app.GetInteractiveSessionInfoAll(GetContextSite(c))
+		return c.Render("sessions", renderMap, "layouts/main_common")
+	})
+
 	web.Get("/overwatch", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("overwatch", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/show_prom", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		url := fmt.Sprintf("http://localhost:%d/metrics", data.SireusData.AppConfig.PrometheusExportPort)
 		body, err := util.HttpGet(url)
 		if util.Check(err) {
@@ -62,17 +78,17 @@ func RegisterRoutesWeb(web *fiber.App) {
 	})
 
 	web.Get("/show_config", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("show_config", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/demo_info", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("demo_info", renderMap, "layouts/main_common")
 	})
 
 	web.Get("/test", func(c *fiber.Ctx) error {
-		renderMap := GetRenderMapFromParams(c, &data.SireusData.Site)
+		renderMap := GetRenderMapFromParams(c, GetContextSite(c))
 		return c.Render("test", renderMap, "layouts/main_common")
 	})
 }
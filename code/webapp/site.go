@@ -0,0 +1,77 @@
+package webapp
+
+import (
+	"fmt"
+	"github.com/ghowland/sireus/code/app"
+	"github.com/ghowland/sireus/code/data"
+	"github.com/ghowland/sireus/code/util"
+	"github.com/gofiber/fiber/v2"
+	"net/url"
+	"time"
+)
+
+const (
+	SiteCookieName     = "sireus_site_id"     // Cookie set by the Site switcher, so pages and RPCs stay on the selected Site
+	SiteCookieDuration = 365 * 24 * time.Hour // How long the Site switcher remembers the selected Site
+	siteContextKey     = "site"               // Fiber Locals key for the request's Site, see GetContextSite()
+)
+
+// Fiber handler that selects the Site for every request, from the "site_id" query or body param, or the Site switcher
+// cookie.  The first Site is the default.  An unknown "site_id" param is an error, so an API call is never run on the
+// wrong Site.  An unknown cookie uses the default Site, as a config reload may have removed it.
+func SiteHandler(c *fiber.Ctx) error {
+	siteId := c.Query("site_id")
+	if siteId == "" && c.Method() == fiber.MethodPost {
+		siteId = util.ParseContextBody(c)["site_id"]
+	}
+
+	if siteId != "" {
+		site, err := app.GetSite(siteId)
+		if util.Check(err) {
+			return c.Status(fiber.StatusNotFound).SendString(GetAPIFailure(err.Error()))
+		}
+		c.Locals(siteContextKey, site)
+		return c.Next()
+	}
+
+	cookieSiteId, _ := url.QueryUnescape(c.Cookies(SiteCookieName))
+	site, err := app.GetSite(cookieSiteId)
+	if util.Check(err) {
+		site, err = app.GetSite("")
+		if util.Check(err) {
+			return c.Status(fiber.StatusServiceUnavailable).SendString(GetAPIFailure(err.Error()))
+		}
+	}
+	c.Locals(siteContextKey, site)
+
+	return c.Next()
+}
+
+// Returns the Site selected for this request by SiteHandler
+func GetContextSite(c *fiber.Ctx) *data.Site {
+	return c.Locals(siteContextKey).(*data.Site)
+}
+
+// Selects the Site from the Site switcher, remembering it in a cookie, and goes to its Site page
+func SelectSite(c *fiber.Ctx) error {
+	site := GetContextSite(c)
+
+	c.Cookie(&fiber.Cookie{
+		Name:    SiteCookieName,
+		Value:   url.QueryEscape(site.Name),
+		Expires: util.GetTimeNow().Add(SiteCookieDuration),
+	})
+
+	return c.Redirect(fmt.Sprintf("/site?site_id=%s", url.QueryEscape(site.Name)))
+}
+
+// Returns a QueryServer by name from a Site, for template helpers.  Helpers are given the Site name, so the Site isn't
+// copied while a config reload replaces its QueryServers.
+func GetSiteQueryServer(siteName string, queryServerName string) (data.QueryServer, error) {
+	site, err := app.GetSite(siteName)
+	if util.Check(err) {
+		return data.QueryServer{}, err
+	}
+
+	return app.GetQueryServer(site, queryServerName)
+}
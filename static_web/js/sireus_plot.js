@@ -15,6 +15,7 @@ function SetupPlot(data)
     // alert('running Setup Plot: ' + JSON.stringify(data));
 
     CreatePlot('plot', data['title'], data['plot_x'], data['plot_y'], data['plot_selected_x'], data['plot_selected_y']);
+    $('#plot_info').html('').addClass('is-hidden');
 
     $('#modal_plot').addClass('is-active')
 }
@@ -58,4 +59,70 @@ function CreatePlot(element_id, title, plot_x, plot_y, plot_selected_x, plot_sel
         }};
 
     Plotly.newPlot(element_id, data, layout);
+}
+
+function GetSensitivityPlot(conditionName)
+{
+    // Use the same Bot Group, Bot and Interactive Control as the page data reloads
+    var inputData = Object.assign({}, LastInputData);
+    inputData['condition'] = conditionName;
+
+    RPC('/api/sensitivity', inputData, SetupSensitivityPlot);
+}
+
+function SetupSensitivityPlot(data)
+{
+    if (data['_failure'] != undefined)
+    {
+        Toast('danger', 'Sensitivity Failed', data['_failure']);
+        return;
+    }
+
+    // Considerations have different ranges, so plot them all by their position in the range, 0-1
+    var traces = [];
+    var info = '<table class="table is-narrow"><thead><tr><th>Consideration</th><th>Current</th><th>Score Span</th><th>+10% Weight</th><th>Threshold Crossings</th></tr></thead><tbody>';
+
+    $.each(data['considerations'], function(index, consider) {
+        var position = [];
+        var inputs = consider['inputs'] || [];
+        for (var i = 0; i < inputs.length; i++) { position.push(i / Math.max(inputs.length - 1, 1)); }
+
+        traces.push({
+            x: position,
+            y: consider['final_scores'],
+            text: inputs.map(function(value) { return 'Input: ' + value.toFixed(2); }),
+            mode: 'lines',
+            name: EscapeHtml(consider['name']),
+            line: {shape: 'linear'},
+            type: 'scatter'
+        });
+
+        var crossings = (consider['crossings'] || []).map(function(value) { return value.toFixed(2); }).join(', ');
+        info += '<tr><th>' + EscapeHtml(consider['name']) + '</th><td>' + consider['current_value'].toFixed(2) + '</td><td>' + consider['score_span'].toFixed(2) + '</td><td>' + consider['weight_impact'].toFixed(3) + '</td><td>' + crossings + '</td></tr>';
+    });
+    info += '</tbody></table>';
+
+    traces.push({
+        x: [0, 1],
+        y: [data['threshold'], data['threshold']],
+        mode: 'lines',
+        name: 'Threshold',
+        line: {dash: 'dash'},
+        type: 'scatter'
+    });
+
+    var layout = {
+        title: 'Sensitivity: ' + EscapeHtml(data['condition_name']) + '  (Score: ' + data['final_score'].toFixed(2) + ')',
+        xaxis: {title: 'Position in Consideration Range'},
+        yaxis: {title: 'Score'},
+        legend: {
+            y: 0.5,
+            font: {size: 16},
+            yref: 'paper'
+        }};
+
+    Plotly.newPlot('plot', traces, layout);
+
+    $('#plot_info').html(info).removeClass('is-hidden');
+    $('#modal_plot').addClass('is-active')
 }
\ No newline at end of file
@@ -25,3 +25,9 @@ function Toast(style, heading, text, showTime)
         afterHidden: function () {}  // will be triggered after the toast has been hidden
     });
 }
+
+// Escape text so it can be added to HTML, and Plotly names and titles, without being parsed as HTML
+function EscapeHtml(text)
+{
+    return $('<div>').text(String(text)).html().replace(/"/g, '&quot;').replace(/'/g, '&#39;');
+}